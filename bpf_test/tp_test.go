@@ -10,8 +10,11 @@ import (
 	"github.com/ebirukov/bstrace/internal/testutil"
 	"github.com/ebirukov/bstrace/pkg/abi"
 	extbytes "github.com/ebirukov/bstrace/pkg/bytes"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
 	"log"
 	"reflect"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -129,6 +132,85 @@ func TestSyscallTracepointLifecycle(t *testing.T) {
 	}
 }
 
+// TestSyscallWithoutParser проверяет, что системный вызов без парсера в
+// sc_parsers передаётся с шестью аргументами и результатом
+func TestSyscallWithoutParser(t *testing.T) {
+	const FAKE_ADDR = 0x7f0000000000
+
+	numbers, err := sysdesc.Numbers(runtime.GOARCH)
+	if err != nil {
+		t.Skipf("no syscall table: %v", err)
+	}
+
+	var sysMmap uint32
+	for nr, name := range numbers {
+		if name == "mmap" {
+			sysMmap = nr
+		}
+	}
+	if sysMmap == 0 {
+		t.Fatalf("no mmap in syscall table of %s", runtime.GOARCH)
+	}
+
+	testObjs := &strace.BpfObjs{
+		SharedObjs:      &strace.SharedObjs{},
+		TracepointsObjs: &strace.TracepointsObjs{},
+	}
+	l := strace.NewLoader(bpfObjFS)
+	if err := l.LoadBpfObjects(testObjs); err != nil {
+		t.Fatalf("Error loading bpf objects: %v", err)
+	}
+	defer testObjs.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	events, err := testutil.StartWatchRingDecoder(ctx, testObjs.TracepointsObjs.EventBuf, event.Decode)
+	if err != nil {
+		t.Fatalf("startRingReader failed: %v", err)
+	}
+
+	args := [6]uint64{0, 4096, 3, 0x22, 0xffffffffffffffff, 0}
+
+	argsPtr, err := abi.CreateSyscallArgs(uint64(sysMmap), args[:]...)
+	if err != nil {
+		t.Fatalf("error create syscall args: %v", err)
+	}
+
+	builder := extbytes.Builder{}
+
+	enterCtx := builder.Reset().
+		WritePointer(binary.LittleEndian, argsPtr).
+		WriteUint64(binary.LittleEndian, uint64(sysMmap)).
+		Bytes()
+
+	if _, err := testObjs.TracepointsObjs.SyscallEnter.Run(&ebpf.RunOptions{Context: enterCtx}); err != nil {
+		t.Fatalf("SyscallEnter failed: %v", err)
+	}
+
+	exitCtx := builder.Reset().
+		WritePointer(binary.LittleEndian, argsPtr).
+		WriteInt64(binary.LittleEndian, FAKE_ADDR).
+		Bytes()
+
+	if _, err := testObjs.TracepointsObjs.SyscallExit.Run(&ebpf.RunOptions{Context: exitCtx}); err != nil {
+		t.Fatalf("SyscallExit failed: %v", err)
+	}
+
+	select {
+	case ev := <-events:
+		if ev == nil {
+			t.Fatal("Received nil syscall event")
+		}
+		raw := ev.Raw()
+		if raw.Nr != sysMmap || raw.Args != args || raw.RetVal != FAKE_ADDR {
+			t.Errorf("Unexpected syscall event: nr=%d args=%v ret=%#x", raw.Nr, raw.Args, raw.RetVal)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Timeout waiting for syscall event")
+	}
+}
+
 type SyscallInfo struct {
 	Nr   uint64
 	Arg1 uint64
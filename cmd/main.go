@@ -2,12 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"github.com/ebirukov/bstrace/internal/strace"
 	"log"
+	"os"
 )
 
 func main() {
-	if err := strace.Run(context.Background()); err != nil {
+	cfg, err := strace.ParseFlags(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := strace.Run(context.Background(), cfg); err != nil {
 		log.Fatal(err)
 	}
 }
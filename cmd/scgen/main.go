@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// scgen - генератор кода по описаниям системных вызовов pkg/sysdesc/syscalls.sc.
+//
+// По каждому описанию генерирует:
+//   - bpf программу-парсер kprog/src/parser/<имя>.bpf.c, захватывающую аргументы на входе в системный вызов;
+//   - типизированное событие pkg/event, его декодер из записи кольцевого буфера и форматирование аргументов.
+//
+// Пример использования:
+//
+//	go run ./cmd/scgen -out pkg/event/zz_generated_events.go -bpf-dir kprog/src/parser
+func main() {
+	log.SetPrefix("scgen: ")
+
+	out := flag.String("out", "zz_generated_events.go", "Path to generated go file with typed events")
+	bpfDir := flag.String("bpf-dir", "", "Directory for generated bpf parser programs (skipped if empty)")
+
+	flag.Parse()
+
+	src, err := generateEvents(sysdesc.Default)
+	if err != nil {
+		log.Fatalf("error generating events: %v", err)
+	}
+
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		log.Fatalf("error writing %s: %v", *out, err)
+	}
+
+	if *bpfDir == "" {
+		return
+	}
+
+	if err := os.MkdirAll(*bpfDir, 0755); err != nil {
+		log.Fatalf("error creating %s: %v", *bpfDir, err)
+	}
+
+	for _, sc := range sysdesc.Default.Syscalls() {
+		src, err := generateParser(sc)
+		if err != nil {
+			log.Fatalf("error generating parser for %s: %v", sc.Name, err)
+		}
+
+		file := filepath.Join(*bpfDir, sc.Name+".bpf.c")
+		if err := os.WriteFile(file, src, 0644); err != nil {
+			log.Fatalf("error writing %s: %v", file, err)
+		}
+	}
+}
+
+type eventField struct {
+	Name   string
+	GoType string
+	Expr   string
+	Format string
+	Value  string
+	Arg    string
+	// Extra - дополнительный разобранный аргумент, выводимый после аргументов
+	// системного вызова (например, пространство имён дескриптора)
+	Extra *eventArg
+}
+
+type eventArg struct {
+	Name  string
+	Value string
+}
+
+type eventDesc struct {
+	Name   string
+	Type   string
+	Func   string
+	Fields []eventField
+	// EnterArgs - число аргументов до первого выходного
+	EnterArgs int
+	// ModeFlags - поле с флагами open, от которых зависит вывод последнего аргумента mode
+	ModeFlags string
+}
+
+var eventsTmpl = template.Must(template.New("events").Parse(`// Code generated by scgen from pkg/sysdesc/syscalls.sc. DO NOT EDIT.
+
+package event
+
+var decoders = map[string]decodeFunc{
+{{- range .}}
+	"{{.Name}}": {{.Func}},
+{{- end}}
+}
+{{range .}}
+// {{.Type}} - событие системного вызова {{.Name}}
+type {{.Type}} struct {
+	Syscall
+{{- range .Fields}}
+	{{.Name}} {{.GoType}}
+{{- end}}
+}
+
+func (*{{.Type}}) Name() string {
+	return "{{.Name}}"
+}
+
+func (*{{.Type}}) EnterArgs() int {
+	return {{.EnterArgs}}
+}
+
+func (e *{{.Type}}) FormatArgs() []string {
+	{{if .ModeFlags}}args :={{else}}return{{end}} []string{
+{{- range .Fields}}
+		{{.Format}},
+{{- end}}
+	}
+{{- if .ModeFlags}}
+
+	// как и strace, выводим mode только при создании файла
+	if !openFlagsCreate(e.{{.ModeFlags}}) {
+		args = args[:len(args)-1]
+	}
+
+	return args
+{{- end}}
+}
+
+func (e *{{.Type}}) DecodedArgs() []Arg {
+	return []Arg{
+{{- range .Fields}}
+		{"{{.Arg}}", {{.Value}}},
+{{- end}}
+{{- range .Fields}}{{with .Extra}}
+		{"{{.Name}}", {{.Value}}},
+{{- end}}{{end}}
+	}
+}
+
+func {{.Func}}(sc Syscall, data []byte) SyscallEvent {
+	return &{{.Type}}{
+		Syscall: sc,
+{{- range .Fields}}
+		{{.Name}}: {{.Expr}},
+{{- end}}
+	}
+}
+{{end}}`))
+
+func generateEvents(table *sysdesc.Table) ([]byte, error) {
+	var events []eventDesc
+
+	for _, sc := range table.Syscalls() {
+		ev := eventDesc{
+			Name:      sc.Name,
+			Type:      camel(sc.Name) + "Event",
+			Func:      "decode" + camel(sc.Name),
+			EnterArgs: len(sc.Args),
+		}
+
+		for i, arg := range sc.Args {
+			field, err := goField(i, arg)
+			if err != nil {
+				return nil, fmt.Errorf("syscall %s: %w", sc.Name, err)
+			}
+
+			if arg.Out() && i < ev.EnterArgs {
+				ev.EnterArgs = i
+			}
+
+			if arg.Kind == sysdesc.KindFlags && arg.Set == "open_flags" {
+				ev.ModeFlags = field.Name
+			}
+
+			ev.Fields = append(ev.Fields, field)
+		}
+
+		if last := len(sc.Args) - 1; last < 0 || sc.Args[last].Kind != sysdesc.KindMode {
+			ev.ModeFlags = ""
+		}
+
+		events = append(events, ev)
+	}
+
+	var buf bytes.Buffer
+	if err := eventsTmpl.Execute(&buf, events); err != nil {
+		return nil, err
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+func goField(idx int, arg sysdesc.Arg) (eventField, error) {
+	f := eventField{Name: camel(arg.Name), Arg: arg.Name}
+	raw := fmt.Sprintf("sc.Args[%d]", idx)
+	field := "e." + f.Name
+	f.Value = field
+
+	switch arg.Kind {
+	case sysdesc.KindInt:
+		f.GoType, f.Expr = "int64", "int64("+raw+")"
+		f.Format = "formatInt(" + field + ")"
+	case sysdesc.KindUint:
+		f.GoType, f.Expr = "uint64", raw
+		f.Format = "formatUint(" + field + ")"
+	case sysdesc.KindFlags:
+		f.GoType, f.Expr = "uint64", raw
+		f.Format = lowerCamel(arg.Set) + ".Format(" + field + ")"
+		f.Value = f.Format
+	case sysdesc.KindPtr:
+		f.GoType, f.Expr = "uint64", raw
+		f.Format = "formatPtr(" + field + ")"
+	case sysdesc.KindFd:
+		f.GoType, f.Expr = "int32", "int32("+raw+")"
+		f.Format = "formatFd(" + field + ")"
+
+		if arg.Ns {
+			// разобранное значение остаётся номером дескриптора для фильтров
+			f.GoType = "NsFd"
+			f.Expr = fmt.Sprintf("newNsFd(int32(%s), data[%d:%d])", raw, arg.Offset, arg.Offset+arg.Size)
+			f.Format = field + ".String()"
+			f.Value = field + ".Fd"
+			f.Extra = &eventArg{Name: arg.Name + "_ns", Value: field + ".Namespace()"}
+		}
+	case sysdesc.KindMode:
+		f.GoType, f.Expr = "uint32", "uint32("+raw+")"
+		f.Format = "formatMode(" + field + ")"
+	case sysdesc.KindPath:
+		f.GoType = "string"
+		f.Expr = fmt.Sprintf("cstring(data[%d:%d])", arg.Offset, arg.Offset+arg.Size)
+		f.Format = "formatPath(" + field + ")"
+	case sysdesc.KindStruct:
+		f.GoType = camel(arg.Struct)
+		f.Expr = fmt.Sprintf("new%s(data[%d:%d])", f.GoType, arg.Offset, arg.Offset+arg.Size)
+		f.Format = fmt.Sprintf("formatStruct(e.Args[%d], %s)", idx, field)
+	case sysdesc.KindBuf:
+		length := "sc.RetVal"
+		if arg.LenArg > 0 {
+			length = fmt.Sprintf("int64(sc.Args[%d])", arg.LenArg-1)
+		}
+
+		f.GoType = "[]byte"
+		f.Expr = fmt.Sprintf("capturedBuf(data, %d, %d, %s)", arg.Offset, arg.Size, length)
+		f.Format = fmt.Sprintf("formatBuf(e.Args[%d], %s, %s)", idx, field, strings.Replace(length, "sc.", "e.", 1))
+		f.Value = "Buffer(" + field + ")"
+	case sysdesc.KindStrv:
+		f.GoType = "StrArray"
+		f.Expr = fmt.Sprintf("newStrArray(data[%d:%d])", arg.Offset, arg.Offset+arg.Size)
+		f.Format = fmt.Sprintf("formatStrArray(e.Args[%d], %s)", idx, field)
+	default:
+		return f, fmt.Errorf("arg %s: unsupported kind %s", arg.Name, arg.Kind)
+	}
+
+	return f, nil
+}
+
+// structReaders - функции захвата структур, которым недостаточно копирования
+// sc_read_mem: они дочитывают данные, на которые ссылаются поля структуры
+var structReaders = map[string]string{
+	"clone_args": "sc_read_clone_args",
+}
+
+type parserArch struct {
+	Macro string
+	Nr    uint32
+}
+
+type parserCapture struct {
+	Call string
+	Arg  string
+}
+
+type parserDesc struct {
+	Name     string
+	Arches   []parserArch
+	Captures []parserCapture
+}
+
+var parserTmpl = template.Must(template.New("parser").Parse(`// Code generated by scgen from pkg/sysdesc/syscalls.sc. DO NOT EDIT.
+
+#include "vmlinux.h"
+#include "common.h"
+#include "parser.h"
+#include "testing.h"
+#include <bpf/bpf_helpers.h>
+#include <bpf/bpf_core_read.h>
+#include <bpf/bpf_tracing.h>
+
+{{range $i, $a := .Arches -}}
+#{{if $i}}elif{{else}}if{{end}} defined(__TARGET_ARCH_{{$a.Macro}})
+const int SC_NR = {{$a.Nr}};
+{{end -}}
+#else
+const int SC_NR = -1;
+#endif
+
+SEC("raw_tracepoint/sys_enter")
+int BPF_PROG({{.Name}}_syscall, struct pt_regs *pt_regs, __s64 syscall_nr) {
+    struct syscall_args sc_args = {};
+    fill_syscall_args(pt_regs, &sc_args);
+
+    struct cdata *info = sc_data_start(syscall_nr, &sc_args);
+    if (!info)
+        return 0;
+{{if .Captures}}
+{{range .Captures}}    {{.Call}}; // {{.Arg}}
+{{end}}{{end}}
+    sc_submit_enter(info);
+
+    return 0;
+}
+
+char LICENSE[] SEC("license") = "GPL";
+`))
+
+func generateParser(sc sysdesc.Syscall) ([]byte, error) {
+	desc := parserDesc{Name: sc.Name}
+
+	arches := make([]string, 0, len(sc.Nr))
+	for arch := range sc.Nr {
+		arches = append(arches, arch)
+	}
+
+	sort.Strings(arches)
+
+	for _, arch := range arches {
+		macro, ok := sysdesc.ArchMacro(arch)
+		if !ok {
+			return nil, fmt.Errorf("unknown arch %s", arch)
+		}
+
+		desc.Arches = append(desc.Arches, parserArch{Macro: macro, Nr: sc.Nr[arch]})
+	}
+
+	for i, arg := range sc.Args {
+		ptr := fmt.Sprintf("sc_args.arg%d", i+1)
+
+		var call string
+
+		switch arg.Kind {
+		case sysdesc.KindPath:
+			desc.Captures = append(desc.Captures, parserCapture{
+				Call: fmt.Sprintf("sc_read_str(info, %d, %s)", arg.Offset, ptr),
+				Arg:  arg.Name,
+			})
+
+			call = fmt.Sprintf("sc_match_path(info, %d)", arg.Offset)
+		case sysdesc.KindFd:
+			call = fmt.Sprintf("sc_match_fd(info, %s)", ptr)
+			if arg.Close {
+				// дескриптор освобождается даже при ошибке close, поэтому связь с путём забывается на входе
+				desc.Captures = append(desc.Captures, parserCapture{Call: call, Arg: arg.Name})
+				call = fmt.Sprintf("sc_forget_fd(%s)", ptr)
+			}
+
+			if arg.Ns {
+				desc.Captures = append(desc.Captures, parserCapture{Call: call, Arg: arg.Name})
+				call = fmt.Sprintf("sc_read_ns_fd(info, %d, %s)", arg.Offset, ptr)
+			}
+		case sysdesc.KindStruct:
+			reader, ok := structReaders[arg.Struct]
+			if !ok {
+				reader = "sc_read_mem"
+			}
+
+			call = fmt.Sprintf("%s(info, %d, %d, %s)", reader, arg.Offset, arg.Size, ptr)
+		case sysdesc.KindBuf:
+			if arg.LenArg == 0 {
+				call = fmt.Sprintf("sc_read_on_exit(info, %d, %d, %s)", arg.Offset, arg.Size, ptr)
+			} else {
+				call = fmt.Sprintf("sc_read_buf(info, %d, %d, %s, sc_args.arg%d)", arg.Offset, arg.Size, ptr, arg.LenArg)
+			}
+		case sysdesc.KindStrv:
+			count := fmt.Sprint(arg.Count)
+			if arg.Env {
+				count = "capture_env ? " + count + " : 0"
+			}
+
+			call = fmt.Sprintf("sc_read_strv(info, %d, %d, %s, %d, %s)", arg.Offset, arg.Size, count, arg.StrSize, ptr)
+		default:
+			continue
+		}
+
+		desc.Captures = append(desc.Captures, parserCapture{Call: call, Arg: arg.Name})
+	}
+
+	if sc.RetFd {
+		desc.Captures = append(desc.Captures, parserCapture{Call: "sc_ret_fd(info)", Arg: "ret"})
+	}
+
+	var buf bytes.Buffer
+	if err := parserTmpl.Execute(&buf, desc); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// camel преобразует имя в стиле snake_case в CamelCase
+func camel(name string) string {
+	var sb strings.Builder
+
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+
+		sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+
+	return sb.String()
+}
+
+// lowerCamel преобразует имя в стиле snake_case в lowerCamelCase
+func lowerCamel(name string) string {
+	c := camel(name)
+	if c == "" {
+		return c
+	}
+
+	return strings.ToLower(c[:1]) + c[1:]
+}
@@ -5,6 +5,5 @@ go 1.24
 require (
 	github.com/cavaliergopher/cpio v1.0.1
 	github.com/cilium/ebpf v0.19.0
+	golang.org/x/sys v0.35.0
 )
-
-require golang.org/x/sys v0.35.0 // indirect; indirect=
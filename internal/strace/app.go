@@ -2,50 +2,184 @@ package strace
 
 import (
 	"context"
+	"fmt"
+	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 	"github.com/ebirukov/bstrace"
+	"github.com/ebirukov/bstrace/pkg/container"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/output"
+	"github.com/ebirukov/bstrace/pkg/stack"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
 	"log"
+	"os"
+	"runtime"
 )
 
-func Run(_ context.Context) error {
-	bpfObjs := &BpfObjs{
-		SharedObjs:      &SharedObjs{},
-		TracepointsObjs: &TracepointsObjs{},
+func Run(_ context.Context, cfg *Config) error {
+	switch cfg.Command {
+	case CommandRecord:
+		return Record(cfg)
+	case CommandRead:
+		return Replay(cfg)
+	case CommandFlight:
+		return Flight(cfg)
+	}
+
+	table, err := sysdesc.LoadKernel(sysdesc.Default, runtime.GOARCH)
+	if err != nil {
+		log.Printf("can't derive syscalls from kernel btf, only syscalls with parsers will be named: %v", err)
+
+		table = sysdesc.Default
 	}
 
+	sel := newSelector(cfg, table)
+	// объекты, собранные без pid_exclude, передают и события самого трассировщика
+	sel.self = uint32(os.Getpid())
+
 	l := NewLoader(bstrace.BpfObjFS)
+	// с фильтром события входа не передаются: по ним нельзя решить, пройдёт ли системный вызов фильтр
+	l.SetConst("emit_enter", output.NeedsEntry(cfg.OutputFormat) && !sel.exitOnly())
+	l.SetConst("capture_stacks", cfg.StackTraces || output.NeedsStacks(cfg.OutputFormat))
+	l.SetConst("capture_kstacks", cfg.KernelStacks)
+	l.SetConst("capture_env", cfg.CaptureEnv)
+	l.SetConst("kstack_min_duration", uint64(cfg.KernelStackMin))
+
+	if cfg.Filter != nil {
+		pushDown(l, cfg.Filter.Pushdown(), table)
+	}
 
-	defer bpfObjs.SharedObjs.Close()
-	defer bpfObjs.TracepointsObjs.Close()
+	pushDownRet(l, cfg)
 
-	err := l.LoadBpfObjects(bpfObjs)
+	if err := pushDownScope(l, cfg); err != nil {
+		return err
+	}
+
+	// условия проверяются и в ядре, и в user-space: объекты, собранные
+	// без поддержки фильтров, передают все события
+	if len(cfg.Paths) > 0 {
+		pushDownPaths(l, cfg.Paths)
+	}
+
+	bpfObjs, detach, err := attach(l, attachOptions{kernelStacks: cfg.KernelStacks, exec: len(cfg.ExecNames) > 0})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	lnk, err := link.AttachRawTracepoint(link.RawTracepointOptions{
-		Name:    "sys_exit",
-		Program: bpfObjs.TracepointsObjs.SyscallExit,
-	})
+	defer detach()
+
+	decoder := event.NewDecoder(runtime.GOARCH, table)
+
+	opts := cfg.OutputOptions()
+	opts.Stacks = stack.NewResolver(bpfObjs.Stacks())
+	// идентификаторы cgroup имеют смысл только на этой машине, поэтому контейнеры
+	// определяются при трассировке, а не при чтении записи
+	opts.Containers = container.NewResolver("")
+
+	out, err := output.New(cfg.OutputFormat, os.Stdout, opts)
 	if err != nil {
-		log.Fatalf("failed to attach raw tracepoint: %v", err)
+		return err
 	}
 
-	defer lnk.Close()
+	if err := Trace(bpfObjs.TracepointsObjs.EventBuf, printEvents(decoder, out, sel, opts.Stacks)); err != nil {
+		return err
+	}
 
-	lnk, err = link.AttachRawTracepoint(link.RawTracepointOptions{
-		Name:    "sys_enter",
-		Program: bpfObjs.TracepointsObjs.SyscallEnter,
-	})
-	if err != nil {
-		log.Fatalf("failed to attach raw tracepoint: %v", err)
+	return output.Close(out)
+}
+
+// attachOptions - необязательные точки трассировки
+type attachOptions struct {
+	// kernelStacks - переключение задач для захвата стеков ядра (--kstack)
+	kernelStacks bool
+	// exec - запуск исполняемых файлов для --exec-name
+	exec bool
+}
+
+// attach загружает bpf программы и подключает их к точкам трассировки
+// входа и выхода из системных вызовов и к необязательным точкам из opts
+func attach(l *BPFLoader, opts attachOptions) (*BpfObjs, func(), error) {
+	bpfObjs := &BpfObjs{
+		SharedObjs:      &SharedObjs{},
+		TracepointsObjs: &TracepointsObjs{},
 	}
 
-	defer lnk.Close()
+	var closers []func() error
 
-	if err := Trace(bpfObjs.TracepointsObjs.EventBuf); err != nil {
-		return err
+	detach := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+
+	closers = append(closers, bpfObjs.Close)
+
+	// трассировщик не отслеживает себя: чтение evt_buf и вывод событий порождали бы новые события
+	pushDownSet(l, "exclude_pids", "pid_exclude", []uint32{uint32(os.Getpid())})
+
+	if err := l.LoadBpfObjects(bpfObjs); err != nil {
+		detach()
+
+		return nil, nil, err
+	}
+
+	type tracepoint struct {
+		name string
+		prog *ebpf.Program
+	}
+
+	tracepoints := []tracepoint{
+		{"sys_exit", bpfObjs.TracepointsObjs.SyscallExit},
+		{"sys_enter", bpfObjs.TracepointsObjs.SyscallEnter},
+	}
+
+	// без sc_sched_fork исключается только сам трассировщик, но не порождённые им процессы;
+	// без программ sched и signal не передаются события процессов и сигналов
+	if bpfObjs.ForkObjs != nil {
+		tracepoints = append(tracepoints, tracepoint{"sched_process_fork", bpfObjs.ForkObjs.SchedFork})
+	}
+
+	if bpfObjs.ExitObjs != nil {
+		tracepoints = append(tracepoints, tracepoint{"sched_process_exit", bpfObjs.ExitObjs.SchedExit})
+	}
+
+	if so := bpfObjs.SignalObjs; so != nil {
+		tracepoints = append(tracepoints,
+			tracepoint{"signal_generate", so.SignalGenerate},
+			tracepoint{"signal_deliver", so.SignalDeliver},
+		)
+	}
+
+	switch {
+	case bpfObjs.ExecObjs != nil:
+		tracepoints = append(tracepoints, tracepoint{"sched_process_exec", bpfObjs.ExecObjs.SchedExec})
+	case opts.exec:
+		detach()
+
+		return nil, nil, fmt.Errorf("bpf programs are built without sched_process_exec handler required by --exec-name")
+	}
+
+	if opts.kernelStacks {
+		if bpfObjs.SchedObjs != nil {
+			tracepoints = append(tracepoints, tracepoint{"sched_switch", bpfObjs.SchedObjs.SchedSwitch})
+		} else {
+			log.Printf("bpf programs are built without sched_switch handler, kernel stacks will be captured at syscall exit")
+		}
+	}
+
+	for _, tp := range tracepoints {
+		lnk, err := link.AttachRawTracepoint(link.RawTracepointOptions{
+			Name:    tp.name,
+			Program: tp.prog,
+		})
+		if err != nil {
+			detach()
+
+			return nil, nil, fmt.Errorf("failed to attach raw tracepoint %s: %w", tp.name, err)
+		}
+
+		closers = append(closers, lnk.Close)
 	}
 
-	return nil
+	return bpfObjs, detach, nil
 }
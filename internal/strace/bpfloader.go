@@ -5,12 +5,23 @@ import (
 	"embed"
 	"fmt"
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
 	"github.com/ebirukov/bstrace"
+	"github.com/ebirukov/bstrace/pkg/event"
 	"io/fs"
 	"log"
 	"path/filepath"
 )
 
+// optionalMaps - карты, которые есть не во всех версиях объектов программ
+// трассировки: стеки и фильтры по путям, cgroup, имени задачи, пользователю,
+// процессам и системным вызовам. Карты создаются до загрузки программ и общие
+// для sc_enter, sc_exit и необязательных программ sched и signal.
+var optionalMaps = []string{
+	"stacks", "path_filter", "fd_paths", "cgroup_filter", "comm_filter", "uid_filter", "gid_filter",
+	"pid_filter", "exec_filter", "pid_exclude", "syscall_filter", "sc_interrupted",
+}
+
 func (l *BPFLoader) LoadBpfObjects(bpfObjs *BpfObjs) error {
 	sharedSpec, err := l.LoadObjSpec("kprog/obj/common/shared.bpf.o")
 	if err != nil {
@@ -27,13 +38,82 @@ func (l *BPFLoader) LoadBpfObjects(bpfObjs *BpfObjs) error {
 		return fmt.Errorf("error reading ebpf program file: %w", err)
 	}
 
+	if err := checkRecordLayout(tpProgSpec); err != nil {
+		return err
+	}
+
+	replacements := bpfObjs.SharedObjs.Maps()
+
+	// необязательные карты объявлены только в программах, собранных с их поддержкой
+	bpfObjs.Maps = make(map[string]*ebpf.Map)
+
+	for _, name := range optionalMaps {
+		mapSpec, ok := tpProgSpec.Maps[name]
+		if !ok {
+			continue
+		}
+
+		m, err := ebpf.NewMap(mapSpec)
+		if err != nil {
+			return fmt.Errorf("error creating %s map: %w", name, err)
+		}
+
+		bpfObjs.Maps[name] = m
+		replacements[name] = m
+	}
+
+	for name := range l.required {
+		if _, ok := bpfObjs.Maps[name]; !ok {
+			return fmt.Errorf("bpf programs are built without %s map", name)
+		}
+	}
+
 	if err = tpProgSpec.LoadAndAssign(bpfObjs.TracepointsObjs, &ebpf.CollectionOptions{
-		MapReplacements: bpfObjs.SharedObjs.Maps(),
+		MapReplacements: replacements,
 	}); err != nil {
 		return fmt.Errorf("error loading ebpf tracepoint programs: %w", err)
 	}
 
-	parserCollections, err := l.LoadParsers("kprog/obj/parser", bpfObjs.SharedObjs)
+	replacements["sc_parsers"] = bpfObjs.TracepointsObjs.ProgMap
+	replacements["evt_buf"] = bpfObjs.TracepointsObjs.EventBuf
+
+	// sc_sched_switch есть только в программах, собранных с захватом стеков ядра,
+	// sc_sched_exec, sc_sched_fork и sc_sched_exit - с событиями процессов,
+	// sc_signal_generate и sc_signal_deliver - с событиями сигналов
+	schedObjs, execObjs, forkObjs, exitObjs := &SchedObjs{}, &ExecObjs{}, &ForkObjs{}, &ExitObjs{}
+	signalObjs := &SignalObjs{}
+
+	if ok, err := loadOptional(tpProgSpec, "sc_sched_switch", schedObjs, replacements); err != nil {
+		return err
+	} else if ok {
+		bpfObjs.SchedObjs = schedObjs
+	}
+
+	if ok, err := loadOptional(tpProgSpec, "sc_sched_exec", execObjs, replacements); err != nil {
+		return err
+	} else if ok {
+		bpfObjs.ExecObjs = execObjs
+	}
+
+	if ok, err := loadOptional(tpProgSpec, "sc_sched_fork", forkObjs, replacements); err != nil {
+		return err
+	} else if ok {
+		bpfObjs.ForkObjs = forkObjs
+	}
+
+	if ok, err := loadOptional(tpProgSpec, "sc_sched_exit", exitObjs, replacements); err != nil {
+		return err
+	} else if ok {
+		bpfObjs.ExitObjs = exitObjs
+	}
+
+	if ok, err := loadOptional(tpProgSpec, "sc_signal_deliver", signalObjs, replacements); err != nil {
+		return err
+	} else if ok {
+		bpfObjs.SignalObjs = signalObjs
+	}
+
+	parserCollections, err := l.LoadParsers("kprog/obj/parser", bpfObjs)
 	if err != nil {
 		return fmt.Errorf("error loading parser programs: %w", err)
 	}
@@ -51,16 +131,56 @@ func (l *BPFLoader) LoadBpfObjects(bpfObjs *BpfObjs) error {
 	return nil
 }
 
+// checkRecordLayout сверяет размер записи struct cdata в объектах программ с
+// записью, которую ожидает декодер. Объекты, собранные из старых исходников,
+// иначе загружаются, но все их события отбрасываются при декодировании.
+func checkRecordLayout(spec *ebpf.CollectionSpec) error {
+	var cdata *btf.Struct
+	if err := spec.Types.TypeByName("cdata", &cdata); err != nil {
+		return fmt.Errorf("error reading struct cdata from bpf objects: %w", err)
+	}
+
+	if int(cdata.Size) != event.RecordSize {
+		return fmt.Errorf("bpf objects record size %d differs from decoder record size %d, rebuild them with task bpf-compile", cdata.Size, event.RecordSize)
+	}
+
+	return nil
+}
+
+// loadOptional загружает из spec необязательную программу prog в objs.
+// Возвращает false, если программы нет в спецификации.
+func loadOptional(spec *ebpf.CollectionSpec, prog string, objs any, replacements map[string]*ebpf.Map) (bool, error) {
+	if _, ok := spec.Programs[prog]; !ok {
+		return false, nil
+	}
+
+	if err := spec.LoadAndAssign(objs, &ebpf.CollectionOptions{
+		MapReplacements: replacements,
+	}); err != nil {
+		return false, fmt.Errorf("error loading ebpf program %s: %w", prog, err)
+	}
+
+	return true, nil
+}
+
+// fillProgArray заполняет карту парсеров программами для системных вызовов
 func fillProgArray(pc []*ebpf.Collection, progArray *ebpf.Map) error {
 	for _, parserCollection := range pc {
 		for name, program := range parserCollection.Programs {
-			var syscallNR uint32
+			var syscallNR int32
 
 			if err := Variables(parserCollection.Variables).Get("SC_NR", &syscallNR); err != nil {
 				return fmt.Errorf("can't get prog syscall number; err: %w", err)
 			}
 
-			if err := progArray.Put(syscallNR, program); err != nil {
+			// парсер собран для архитектуры, на которой нет такого системного вызова
+			if syscallNR < 0 {
+				log.Printf("Skipping program %s: syscall is not supported on this arch", name)
+
+				continue
+			}
+
+			if err := progArray.Put(uint32(syscallNR), program); err != nil {
 				return fmt.Errorf("error putting program %s to map: %w", name, err)
 			}
 
@@ -72,7 +192,7 @@ func fillProgArray(pc []*ebpf.Collection, progArray *ebpf.Map) error {
 }
 
 // LoadParsers load syscall parser programs
-func (l *BPFLoader) LoadParsers(path string, sharedObjs *SharedObjs) ([]*ebpf.Collection, error) {
+func (l *BPFLoader) LoadParsers(path string, bpfObjs *BpfObjs) ([]*ebpf.Collection, error) {
 	dir, err := fs.ReadDir(bstrace.BpfObjFS, path)
 	if err != nil {
 		return nil, fmt.Errorf("error reading ebpf program directory: %w", err)
@@ -93,7 +213,9 @@ func (l *BPFLoader) LoadParsers(path string, sharedObjs *SharedObjs) ([]*ebpf.Co
 		}
 
 		parserCollection, err := ebpf.NewCollectionWithOptions(spec, ebpf.CollectionOptions{
-			MapReplacements: sharedObjs.Maps(),
+			MapReplacements: usedMaps(spec, bpfObjs.SharedObjs.Maps(), bpfObjs.Maps, map[string]*ebpf.Map{
+				"evt_buf": bpfObjs.TracepointsObjs.EventBuf,
+			}),
 		})
 		if err != nil {
 			return nil, fmt.Errorf("error loading parser collection %s: %w", parserCollection, err)
@@ -105,12 +227,60 @@ func (l *BPFLoader) LoadParsers(path string, sharedObjs *SharedObjs) ([]*ebpf.Co
 	return parserCollections, nil
 }
 
+// usedMaps отбирает карты для замены, объявленные в спецификации.
+// Парсеры, собранные без передачи событий, не объявляют evt_buf.
+func usedMaps(spec *ebpf.CollectionSpec, maps ...map[string]*ebpf.Map) map[string]*ebpf.Map {
+	used := make(map[string]*ebpf.Map)
+
+	for _, m := range maps {
+		for name, bpfMap := range m {
+			if _, ok := spec.Maps[name]; ok {
+				used[name] = bpfMap
+			}
+		}
+	}
+
+	return used
+}
+
 type BPFLoader struct {
-	fs embed.FS
+	fs       embed.FS
+	consts   map[string]any
+	contents map[string][]ebpf.MapKV
+	// required - необязательные карты, без которых трассировка невозможна
+	required map[string]bool
 }
 
 func NewLoader(fs embed.FS) *BPFLoader {
-	return &BPFLoader{fs: fs}
+	return &BPFLoader{
+		fs:       fs,
+		consts:   make(map[string]any),
+		contents: make(map[string][]ebpf.MapKV),
+		required: make(map[string]bool),
+	}
+}
+
+// SetMapContents задаёт начальное содержимое карты для всех загружаемых bpf
+// программ, в которых она объявлена
+func (l *BPFLoader) SetMapContents(name string, contents []ebpf.MapKV) *BPFLoader {
+	l.contents[name] = contents
+
+	return l
+}
+
+// RequireMap требует, чтобы программы трассировки объявляли необязательную карту name
+func (l *BPFLoader) RequireMap(name string) *BPFLoader {
+	l.required[name] = true
+
+	return l
+}
+
+// SetConst задаёт значение константы (const volatile) для всех загружаемых bpf программ,
+// в которых она объявлена
+func (l *BPFLoader) SetConst(name string, value any) *BPFLoader {
+	l.consts[name] = value
+
+	return l
 }
 
 func (l *BPFLoader) LoadObjSpec(file string) (*ebpf.CollectionSpec, error) {
@@ -124,5 +294,26 @@ func (l *BPFLoader) LoadObjSpec(file string) (*ebpf.CollectionSpec, error) {
 		return nil, fmt.Errorf("error reading ebpf program file: %w", err)
 	}
 
+	for name, value := range l.consts {
+		v, ok := spec.Variables[name]
+		if !ok {
+			continue
+		}
+
+		if err := v.Set(value); err != nil {
+			return nil, fmt.Errorf("error setting const %s in %s: %w", name, file, err)
+		}
+	}
+
+	for name, contents := range l.contents {
+		m, ok := spec.Maps[name]
+		if !ok {
+			continue
+		}
+
+		m.Contents = contents
+		m.MaxEntries = max(m.MaxEntries, uint32(len(contents)))
+	}
+
 	return spec, err
 }
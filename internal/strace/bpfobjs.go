@@ -37,9 +37,116 @@ func (tpo *TracepointsObjs) Close() error {
 	)
 }
 
+// SchedObjs - необязательные программы, собранные не во всех версиях объектов
+type SchedObjs struct {
+	SchedSwitch *ebpf.Program `ebpf:"sc_sched_switch"`
+}
+
+func (so *SchedObjs) Close() error {
+	return close(so.SchedSwitch)
+}
+
+// ExecObjs - программа отслеживания exec: события запуска файлов и фильтр
+// --exec-name; собрана не во всех версиях объектов
+type ExecObjs struct {
+	SchedExec *ebpf.Program `ebpf:"sc_sched_exec"`
+}
+
+func (eo *ExecObjs) Close() error {
+	return close(eo.SchedExec)
+}
+
+// ForkObjs - программа отслеживания fork: события создания задач и исключение
+// процессов, порождённых трассировщиком; собрана не во всех версиях объектов
+type ForkObjs struct {
+	SchedFork *ebpf.Program `ebpf:"sc_sched_fork"`
+}
+
+func (fo *ForkObjs) Close() error {
+	return close(fo.SchedFork)
+}
+
+// ExitObjs - программа отслеживания завершения задач, собранная не во всех
+// версиях объектов
+type ExitObjs struct {
+	SchedExit *ebpf.Program `ebpf:"sc_sched_exit"`
+}
+
+func (eo *ExitObjs) Close() error {
+	return close(eo.SchedExit)
+}
+
+// SignalObjs - программы отслеживания отправки и доставки сигналов, собранные
+// не во всех версиях объектов
+type SignalObjs struct {
+	SignalGenerate *ebpf.Program `ebpf:"sc_signal_generate"`
+	SignalDeliver  *ebpf.Program `ebpf:"sc_signal_deliver"`
+}
+
+func (so *SignalObjs) Close() error {
+	return close(so.SignalGenerate, so.SignalDeliver)
+}
+
 type BpfObjs struct {
 	SharedObjs      *SharedObjs
 	TracepointsObjs *TracepointsObjs
+	// Maps - необязательные карты (optionalMaps), объявленные в программах трассировки
+	Maps map[string]*ebpf.Map
+	// SchedObjs - программа захвата стеков ядра, nil если её нет в объектах
+	SchedObjs *SchedObjs
+	// ExecObjs - программа отслеживания exec, nil если её нет в объектах
+	ExecObjs *ExecObjs
+	// ForkObjs - программа отслеживания fork, nil если её нет в объектах
+	ForkObjs *ForkObjs
+	// ExitObjs - программа отслеживания завершения задач, nil если её нет в объектах
+	ExitObjs *ExitObjs
+	// SignalObjs - программы отслеживания сигналов, nil если их нет в объектах
+	SignalObjs *SignalObjs
+}
+
+func (o *BpfObjs) Close() error {
+	if o.SignalObjs != nil {
+		if err := o.SignalObjs.Close(); err != nil {
+			return err
+		}
+	}
+
+	if o.ExitObjs != nil {
+		if err := o.ExitObjs.Close(); err != nil {
+			return err
+		}
+	}
+
+	if o.ForkObjs != nil {
+		if err := o.ForkObjs.Close(); err != nil {
+			return err
+		}
+	}
+
+	if o.ExecObjs != nil {
+		if err := o.ExecObjs.Close(); err != nil {
+			return err
+		}
+	}
+
+	if o.SchedObjs != nil {
+		if err := o.SchedObjs.Close(); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range o.Maps {
+		if err := m.Close(); err != nil {
+			return err
+		}
+	}
+
+	return close(o.SharedObjs, o.TracepointsObjs)
+}
+
+// Stacks возвращает карту стеков, nil если программы трассировки собраны без неё
+func (o *BpfObjs) Stacks() *ebpf.Map {
+	return o.Maps["stacks"]
 }
 
 func close(closers ...io.Closer) error {
@@ -0,0 +1,53 @@
+package strace
+
+import (
+	"github.com/cilium/ebpf"
+	"github.com/ebirukov/bstrace/pkg/container"
+)
+
+// pushDownCgroups ограничивает трассировку процессами из cgroups и их
+// вложенных cgroup. Фильтр работает только в ядре, поэтому карта
+// cgroup_filter обязательна.
+func pushDownCgroups(l *BPFLoader, cgroups []string) error {
+	if len(cgroups) == 0 {
+		return nil
+	}
+
+	contents := make([]ebpf.MapKV, len(cgroups))
+
+	for i, path := range cgroups {
+		id, err := container.CgroupID(path)
+		if err != nil {
+			return err
+		}
+
+		contents[i] = ebpf.MapKV{Key: id, Value: uint8(1)}
+	}
+
+	l.SetConst("filter_cgroup", true)
+	l.SetMapContents("cgroup_filter", contents)
+	l.RequireMap("cgroup_filter")
+
+	return nil
+}
+
+// cgroupSet возвращает идентификаторы cgroups и вложенных в них cgroup для
+// отбора событий в user-space. Идентификаторы cgroup локальны для машины,
+// поэтому при чтении записи они совпадают, только если запись сделана здесь
+// же и cgroup с тех пор не пересоздавались.
+func cgroupSet(cgroups []string) (map[uint64]bool, error) {
+	set := make(map[uint64]bool)
+
+	for _, path := range cgroups {
+		ids, err := container.CgroupTree(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range ids {
+			set[id] = true
+		}
+	}
+
+	return set, nil
+}
@@ -0,0 +1,346 @@
+package strace
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/filter"
+	"github.com/ebirukov/bstrace/pkg/output"
+	"golang.org/x/sys/unix"
+	"io"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Команды bstrace
+const (
+	// CommandTrace - трассировка с выводом событий (по умолчанию)
+	CommandTrace = ""
+	// CommandRecord - запись сырых событий в файл
+	CommandRecord = "record"
+	// CommandRead - разбор файла, записанного командой record
+	CommandRead = "read"
+	// CommandFlight - бортовой самописец: события за последнее окно сбрасываются в файл по триггеру
+	CommandFlight = "flight"
+)
+
+// Config - параметры трассировки, задаваемые из командной строки
+type Config struct {
+	// Command - выполняемая команда: трассировка, record или read
+	Command string
+	// WriteFile - файл записи для команды record
+	WriteFile string
+	// ReadFile - файл записи для команды read
+	ReadFile string
+	// Force - разбирать запись, сделанную с другими описаниями системных вызовов
+	Force bool
+	// Window - окно, за которое команда flight хранит события в памяти
+	Window time.Duration
+	// FlightMaxMem - ограничение памяти под события команды flight в байтах
+	FlightMaxMem int
+	// DumpDir - каталог для файлов записи, сбрасываемых командой flight
+	DumpDir string
+	// TriggerErrnos - коды ошибок системных вызовов, по которым flight сбрасывает события
+	TriggerErrnos []unix.Errno
+	// TriggerLatency - длительность системного вызова, по которой flight сбрасывает события
+	TriggerLatency time.Duration
+	// TriggerCooldown - пауза, в течение которой повторные срабатывания триггера flight не сбрасывают события
+	TriggerCooldown time.Duration
+	// PostWindow - окно после триггера, события которого flight добавляет в сброс
+	PostWindow time.Duration
+	// OutputFormat - формат вывода событий: text или json
+	OutputFormat string
+	// Durations - выводить длительность системных вызовов (как strace -T)
+	Durations bool
+	// Template - пользовательский шаблон вывода text/template
+	Template string
+	// Filter - выражение для отбора событий, nil - все события
+	Filter *filter.Filter
+	// Ret - отбор по знаку возвращаемого значения: filter.RetAny, filter.RetFailed (-Z) или filter.RetSuccess (-z)
+	Ret int
+	// Errnos - выводить только системные вызовы, завершившиеся с одной из этих ошибок
+	Errnos []unix.Errno
+	// Cgroups - каталоги cgroup v2: трассируются только процессы из них и вложенных cgroup
+	Cgroups []string
+	// PidNs - inode пространства имён PID: трассируются только его процессы (0 - все)
+	PidNs uint32
+	// Comms - имена задач (comm): трассируются только задачи с этими именами
+	Comms []string
+	// Uids и Gids - трассируются только задачи этих пользователей и групп
+	Uids []uint32
+	Gids []uint32
+	// ExecNames - имена или полные пути исполняемых файлов: запустившие их
+	// процессы трассируются с момента exec
+	ExecNames []string
+	// Paths - префиксы путей: отбираются только системные вызовы, затрагивающие их (как strace -P)
+	Paths []string
+	// StackTraces - выводить стек пользовательского пространства каждого события (как strace -k)
+	StackTraces bool
+	// KernelStacks - выводить стек ядра медленных и неудачных системных вызовов
+	KernelStacks bool
+	// KernelStackMin - длительность, начиная с которой системный вызов считается медленным
+	KernelStackMin time.Duration
+	// CaptureEnv - захватывать окружение (envp) execve, а не только число переменных (как strace -v)
+	CaptureEnv bool
+}
+
+// ParseFlags разбирает параметры командной строки
+func ParseFlags(name string, args []string) (*Config, error) {
+	cfg := &Config{}
+
+	var (
+		maxMem        int
+		triggerErrnos string
+		filterExpr    string
+		failedOnly    bool
+		successOnly   bool
+		errnos        string
+	)
+
+	if len(args) > 0 {
+		switch args[0] {
+		case CommandRecord, CommandRead, CommandFlight:
+			cfg.Command = args[0]
+			name += " " + args[0]
+			args = args[1:]
+		}
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&cfg.OutputFormat, "output-format", output.FormatText, "Output format: text (strace compatible), json (one JSON object per line) chrome (Chrome Trace Event JSON for Perfetto UI) or pprof (syscall time by user stack for go tool pprof)")
+	fs.BoolVar(&cfg.Durations, "T", false, "Show time spent in syscalls")
+	fs.BoolVar(&cfg.StackTraces, "k", false, "Print the user-space stack trace of each syscall (text and json output)")
+	fs.BoolVar(&cfg.CaptureEnv, "env", false, "Capture environment strings of execve, not only the number of variables")
+	fs.BoolVar(&cfg.KernelStacks, "kstack", false, "Print the kernel stack of failing syscalls and syscalls slower than --kstack-min (text and json output)")
+	fs.DurationVar(&cfg.KernelStackMin, "kstack-min", time.Millisecond, "Minimum syscall duration to capture the kernel stack with --kstack")
+	fs.StringVar(&filterExpr, "filter", "", `Show only events matching the expression, e.g. 'pid == 123 && name in (openat, read) && ret < 0 && path =~ "^/etc/"'`)
+	fs.BoolVar(&failedOnly, "Z", false, "Show only syscalls that returned an error")
+	fs.BoolVar(&successOnly, "z", false, "Show only syscalls that returned without an error")
+	fs.StringVar(&errnos, "errno", "", "Show only syscalls that failed with one of the comma separated errors, e.g. ENOENT,EACCES")
+	fs.Func("cgroup", "Trace only processes in the cgroup v2 directory and its descendants, e.g. /sys/fs/cgroup/system.slice/nginx.service (can be repeated; when reading, only captures recorded on this machine match)", func(path string) error {
+		cfg.Cgroups = append(cfg.Cgroups, path)
+
+		return nil
+	})
+	fs.Func("pidns", "Trace only processes of the PID namespace given by inode number or path, e.g. /proc/1234/ns/pid", func(ns string) (err error) {
+		cfg.PidNs, err = pidNamespace(ns)
+
+		return err
+	})
+	fs.Func("comm", "Trace only tasks with the command name, e.g. nginx (can be repeated)", func(comm string) error {
+		if comm == "" {
+			return fmt.Errorf("empty command name")
+		}
+
+		// ядро хранит имя задачи обрезанным до TASK_COMM_LEN-1 байт
+		cfg.Comms = append(cfg.Comms, comm[:min(len(comm), commLen-1)])
+
+		return nil
+	})
+	fs.Func("uid", "Trace only tasks of the user given by name or uid (can be repeated)", func(name string) error {
+		uid, err := lookupID(name, user.Lookup, func(u *user.User) string { return u.Uid })
+		if err != nil {
+			return err
+		}
+
+		cfg.Uids = append(cfg.Uids, uid)
+
+		return nil
+	})
+	fs.Func("gid", "Trace only tasks of the group given by name or gid (can be repeated)", func(name string) error {
+		gid, err := lookupID(name, user.LookupGroup, func(g *user.Group) string { return g.Gid })
+		if err != nil {
+			return err
+		}
+
+		cfg.Gids = append(cfg.Gids, gid)
+
+		return nil
+	})
+	fs.Func("exec-name", "Trace processes from the moment they exec the binary given by name or full path, e.g. myworker (can be repeated)", func(name string) error {
+		if name == "" || len(name) >= maxPathPrefix {
+			return fmt.Errorf("binary name length must be between 1 and %d", maxPathPrefix-1)
+		}
+
+		cfg.ExecNames = append(cfg.ExecNames, name)
+
+		return nil
+	})
+	fs.Func("P", "Trace only syscalls accessing paths with the prefix, directly or through file descriptors opened on them (can be repeated)", func(path string) error {
+		if path == "" || len(path) >= maxPathPrefix {
+			return fmt.Errorf("path prefix length must be between 1 and %d", maxPathPrefix-1)
+		}
+
+		cfg.Paths = append(cfg.Paths, path)
+
+		return nil
+	})
+	fs.StringVar(&cfg.Template, "format", "", "Custom output format as go text/template, e.g. '{{.Time}} {{.Comm}}[{{.Pid}}] {{.Name}} {{.Ret}}'")
+
+	switch cfg.Command {
+	case CommandRecord:
+		fs.StringVar(&cfg.WriteFile, "w", "", "Write raw events to the capture file")
+	case CommandRead:
+		fs.StringVar(&cfg.ReadFile, "r", "", "Read events from the capture file written by record")
+		fs.BoolVar(&cfg.Force, "force", false, "Read the capture even if it was recorded with different syscall descriptions")
+	case CommandFlight:
+		fs.DurationVar(&cfg.Window, "window", 30*time.Second, "Keep events of the last window in memory")
+		fs.IntVar(&maxMem, "max-mem", 256, "Memory limit for kept events in MiB")
+		fs.StringVar(&cfg.DumpDir, "dump-dir", ".", "Directory for capture files dumped on trigger")
+		fs.StringVar(&triggerErrnos, "trigger-errno", "", "Dump events when a syscall fails with one of the comma separated errors, e.g. EIO,ENOSPC")
+		fs.DurationVar(&cfg.TriggerLatency, "trigger-latency", 0, "Dump events when a syscall takes longer than the duration")
+		fs.DurationVar(&cfg.TriggerCooldown, "trigger-cooldown", 30*time.Second, "Ignore repeated firings of the same trigger within the duration")
+		fs.DurationVar(&cfg.PostWindow, "post-window", 2*time.Second, "Keep collecting events for the duration after a trigger before dumping them")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg.FlightMaxMem = maxMem << 20
+
+	if filterExpr != "" {
+		f, err := filter.Parse(filterExpr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+
+		cfg.Filter = f
+	}
+
+	var err error
+
+	if cfg.TriggerErrnos, err = parseErrnos(triggerErrnos); err != nil {
+		return nil, err
+	}
+
+	if cfg.Errnos, err = parseErrnos(errnos); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case failedOnly && successOnly:
+		return nil, fmt.Errorf("-Z and -z can't be used together")
+	case successOnly && len(cfg.Errnos) > 0:
+		return nil, fmt.Errorf("--errno can't be used with -z")
+	case failedOnly || len(cfg.Errnos) > 0:
+		cfg.Ret = filter.RetFailed
+	case successOnly:
+		cfg.Ret = filter.RetSuccess
+	}
+
+	switch {
+	case cfg.Filter != nil && (cfg.Command == CommandRecord || cfg.Command == CommandFlight):
+		return nil, fmt.Errorf("%s stores all events, apply --filter when reading the capture", cfg.Command)
+	case len(cfg.Paths) > 0 && (cfg.Command == CommandRecord || cfg.Command == CommandFlight):
+		return nil, fmt.Errorf("%s stores all events, apply -P when reading the capture", cfg.Command)
+	case cfg.Ret != filter.RetAny && (cfg.Command == CommandRecord || cfg.Command == CommandFlight):
+		return nil, fmt.Errorf("%s stores all events, apply -Z, -z and --errno when reading the capture", cfg.Command)
+	case len(cfg.Paths) > maxPathFilters:
+		return nil, fmt.Errorf("at most %d -P paths are supported", maxPathFilters)
+	case len(cfg.ExecNames) > 0 && cfg.Command == CommandRead:
+		return nil, fmt.Errorf("--exec-name can be used only when tracing")
+	case (len(cfg.Uids) > 0 || len(cfg.Gids) > 0) && cfg.Command == CommandRead:
+		return nil, fmt.Errorf("captures have no user information, --uid and --gid can be used only when tracing")
+	case cfg.Command == CommandFlight && cfg.Window <= 0:
+		return nil, fmt.Errorf("flight requires positive --window")
+	case cfg.Command == CommandRecord && cfg.WriteFile == "":
+		return nil, fmt.Errorf("record requires -w file")
+	case cfg.Command == CommandRead && cfg.ReadFile == "":
+		return nil, fmt.Errorf("read requires -r file")
+	}
+
+	switch cfg.OutputFormat {
+	case output.FormatText, output.FormatJSON, output.FormatChrome, output.FormatPprof:
+	default:
+		return nil, fmt.Errorf("unknown output format %q", cfg.OutputFormat)
+	}
+
+	if cfg.Template != "" {
+		if cfg.OutputFormat != output.FormatText {
+			return nil, fmt.Errorf("--format can't be used with --output-format %s", cfg.OutputFormat)
+		}
+
+		cfg.OutputFormat = output.FormatTemplate
+	}
+
+	if cfg.OutputFormat != output.FormatText && cfg.OutputFormat != output.FormatJSON {
+		switch {
+		case cfg.StackTraces:
+			return nil, fmt.Errorf("-k can't be used with --output-format %s", cfg.OutputFormat)
+		case cfg.KernelStacks:
+			return nil, fmt.Errorf("--kstack can't be used with --output-format %s", cfg.OutputFormat)
+		}
+	}
+
+	// проверяем шаблон до загрузки bpf программ
+	if _, err := output.New(cfg.OutputFormat, io.Discard, cfg.OutputOptions()); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// lookupID возвращает числовой идентификатор пользователя или группы, заданных
+// числом или именем
+func lookupID[T any](name string, lookup func(string) (T, error), id func(T) string) (uint32, error) {
+	if n, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(n), nil
+	}
+
+	v, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.ParseUint(id(v), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id of %s: %w", name, err)
+	}
+
+	return uint32(n), nil
+}
+
+// pidNamespace возвращает inode пространства имён PID, заданного номером или путём
+func pidNamespace(ns string) (uint32, error) {
+	if ino, err := strconv.ParseUint(ns, 10, 32); err == nil {
+		return uint32(ino), nil
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(ns, &st); err != nil {
+		return 0, fmt.Errorf("error reading pid namespace: %w", err)
+	}
+
+	return uint32(st.Ino), nil
+}
+
+// parseErrnos разбирает список кодов ошибок через запятую
+func parseErrnos(list string) ([]unix.Errno, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	var errnos []unix.Errno
+
+	for _, name := range strings.Split(list, ",") {
+		errno, ok := event.ParseErrno(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown errno %q", name)
+		}
+
+		errnos = append(errnos, errno)
+	}
+
+	return errnos, nil
+}
+
+// OutputOptions возвращает параметры форматирования вывода
+func (cfg *Config) OutputOptions() output.Options {
+	return output.Options{
+		Durations: cfg.Durations,
+		Template:  cfg.Template,
+	}
+}
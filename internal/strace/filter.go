@@ -0,0 +1,253 @@
+package strace
+
+import (
+	"github.com/cilium/ebpf"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/filter"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"golang.org/x/sys/unix"
+	"log"
+	"runtime"
+	"strings"
+)
+
+// selector отбирает выводимые события по условиям командной строки:
+// выражению --filter, путям -P, пространству имён PID, имени задачи, cgroup
+// и результату системного вызова (-Z, -z, --errno)
+type selector struct {
+	filter *filter.Filter
+	// self - процесс трассировщика, события которого пропускаются (0 - нет)
+	self  uint32
+	pidns uint32
+	comms map[string]bool
+	// cgroups - идентификаторы cgroup задач (nil - любые); при трассировке
+	// cgroup проверяется в ядре, а в user-space только при чтении записи
+	cgroups map[uint64]bool
+	paths   *filter.Paths
+	ret     int
+	errnos  map[unix.Errno]bool
+}
+
+// newSelector создаёт selector по параметрам cfg, аргументы системных вызовов
+// определяются по описаниям из table
+func newSelector(cfg *Config, table *sysdesc.Table) *selector {
+	s := &selector{filter: cfg.Filter, pidns: cfg.PidNs, ret: cfg.Ret}
+
+	if len(cfg.Paths) > 0 {
+		s.paths = filter.NewPaths(cfg.Paths, table)
+	}
+
+	if len(cfg.Comms) > 0 {
+		s.comms = make(map[string]bool, len(cfg.Comms))
+		for _, comm := range cfg.Comms {
+			s.comms[comm] = true
+		}
+	}
+
+	if len(cfg.Errnos) > 0 {
+		s.errnos = make(map[unix.Errno]bool, len(cfg.Errnos))
+		for _, errno := range cfg.Errnos {
+			s.errnos[errno] = true
+		}
+	}
+
+	return s
+}
+
+// exitOnly сообщает, что события отбираются по результату системного вызова:
+// событие входа проверить нельзя, поэтому строки выводятся целиком по событию выхода
+func (s *selector) exitOnly() bool {
+	return s.filter != nil || s.ret != filter.RetAny || s.errnos != nil
+}
+
+func (s *selector) match(ev event.SyscallEvent) bool {
+	// события процессов освобождают дескрипторы фильтра -P, даже если сами не выводятся
+	if pe, ok := ev.(*event.ProcessEvent); ok && s.paths != nil {
+		s.paths.Process(pe)
+	}
+
+	if s.exitOnly() && ev.Raw().Entry {
+		return false
+	}
+
+	hdr := ev.Raw().Hdr
+	if (s.self != 0 && hdr.Pid == s.self) || (s.pidns != 0 && hdr.PidNs != s.pidns) || (s.comms != nil && !s.comms[hdr.Comm]) || (s.cgroups != nil && !s.cgroups[hdr.CgroupID]) {
+		return false
+	}
+
+	// у событий процессов и сигналов нет результата и аргументов системного
+	// вызова: выражение --filter проверяется только по полям заголовка
+	if !event.IsSyscall(ev) {
+		return s.filter == nil || s.filter.MatchHeader(ev)
+	}
+
+	switch ret := ev.Ret(); {
+	case s.ret == filter.RetFailed && ret >= 0, s.ret == filter.RetSuccess && ret < 0:
+		return false
+	case s.errnos != nil:
+		errno, ok := event.Errno(ret)
+		if !ok || !s.errnos[errno] {
+			return false
+		}
+	}
+
+	if s.filter != nil && !s.filter.Match(ev) {
+		return false
+	}
+
+	// фильтр по путям проверяется последним: он отслеживает дескрипторы
+	// только по прошедшим остальные условия событиям, как и в ядре
+	return s.paths == nil || s.paths.Match(ev)
+}
+
+// pushDown передаёт простые условия фильтра в bpf программы, чтобы не
+// передавать в user-space события, которые заведомо не пройдут фильтр
+func pushDown(l *BPFLoader, pd filter.Pushdown, table *sysdesc.Table) {
+	if pd.Pids != nil {
+		contents := make([]ebpf.MapKV, len(pd.Pids))
+		for i, pid := range pd.Pids {
+			contents[i] = ebpf.MapKV{Key: pid, Value: uint8(1)}
+		}
+
+		l.SetConst("filter_pids", true)
+		l.SetMapContents("pid_filter", contents)
+	}
+
+	if pd.Syscalls != nil {
+		seen := make(map[uint32]bool)
+		var nrs []uint32
+
+		for _, name := range pd.Syscalls {
+			sc, ok := table.ByName(name)
+			if !ok {
+				log.Printf("filter: unknown syscall %s", name)
+
+				continue
+			}
+
+			if nr, ok := sc.Nr[runtime.GOARCH]; ok && !seen[nr] {
+				seen[nr] = true
+				nrs = append(nrs, nr)
+			}
+		}
+
+		// фильтр включается, даже если ни одно имя не известно: тогда ядро
+		// не передаёт системных вызовов вовсе
+		if !pushDownSet(l, "filter_syscalls", "syscall_filter", nrs) {
+			l.SetConst("filter_syscalls", true)
+		}
+	}
+
+	l.SetConst("filter_ret", int32(pd.Ret))
+}
+
+// pushDownScope ограничивает трассировку задачами из --cgroup, --pidns,
+// --comm, --uid, --gid и --exec-name
+func pushDownScope(l *BPFLoader, cfg *Config) error {
+	if cfg.PidNs != 0 {
+		l.SetConst("filter_pidns", cfg.PidNs)
+	}
+
+	comms := make([][commLen]byte, len(cfg.Comms))
+	for i, comm := range cfg.Comms {
+		copy(comms[i][:commLen-1], comm)
+	}
+
+	// имя задачи проверяется и в user-space, а пользователь и группа - только в ядре
+	pushDownSet(l, "filter_comm", "comm_filter", comms)
+
+	if pushDownSet(l, "filter_uid", "uid_filter", cfg.Uids) {
+		l.RequireMap("uid_filter")
+	}
+
+	if pushDownSet(l, "filter_gid", "gid_filter", cfg.Gids) {
+		l.RequireMap("gid_filter")
+	}
+
+	names := make([][maxPathPrefix]byte, len(cfg.ExecNames))
+	for i, name := range cfg.ExecNames {
+		// имя без каталога сравнивается с именем задачи, обрезанным ядром до TASK_COMM_LEN-1 байт
+		if !strings.Contains(name, "/") {
+			name = name[:min(len(name), commLen-1)]
+		}
+
+		copy(names[i][:], name)
+	}
+
+	// процессы добавляются в pid_filter при exec, поэтому фильтр по процессам
+	// включается, даже если он пуст
+	if pushDownSet(l, "filter_exec", "exec_filter", names) {
+		l.SetConst("filter_pids", true)
+		l.RequireMap("pid_filter")
+	}
+
+	return pushDownCgroups(l, cfg.Cgroups)
+}
+
+// commLen - размер имени задачи (TASK_COMM_LEN) с завершающим нулём
+const commLen = 16
+
+// pushDownSet включает фильтр constName по множеству keys, хранящемуся в карте
+// mapName. Возвращает false, если множество пусто и фильтр не нужен.
+func pushDownSet[K any](l *BPFLoader, constName, mapName string, keys []K) bool {
+	if len(keys) == 0 {
+		return false
+	}
+
+	contents := make([]ebpf.MapKV, len(keys))
+	for i, key := range keys {
+		contents[i] = ebpf.MapKV{Key: key, Value: uint8(1)}
+	}
+
+	l.SetConst(constName, true)
+	l.SetMapContents(mapName, contents)
+
+	return true
+}
+
+// pushDownRet передаёт в bpf программы условия -Z, -z и --errno на результат
+// системного вызова, чтобы отбрасывать события до резервирования места в evt_buf
+func pushDownRet(l *BPFLoader, cfg *Config) {
+	if cfg.Ret != filter.RetAny {
+		l.SetConst("filter_ret", int32(cfg.Ret))
+	}
+
+	if len(cfg.Errnos) == 0 {
+		return
+	}
+
+	contents := make([]ebpf.MapKV, len(cfg.Errnos))
+	for i, errno := range cfg.Errnos {
+		contents[i] = ebpf.MapKV{Key: uint32(errno), Value: uint8(1)}
+	}
+
+	l.SetConst("filter_errno", true)
+	l.SetMapContents("errno_filter", contents)
+}
+
+// Ограничения фильтра по путям (MAX_PATH_FILTERS и SC_STR_SIZE в common.h)
+const (
+	maxPathFilters = 8
+	maxPathPrefix  = 256
+)
+
+// pathPrefix - раскладка struct path_prefix из common.h
+type pathPrefix struct {
+	Len    uint32
+	Prefix [maxPathPrefix]byte
+}
+
+// pushDownPaths передаёт префиксы путей фильтра -P в bpf программы
+func pushDownPaths(l *BPFLoader, paths []string) {
+	contents := make([]ebpf.MapKV, len(paths))
+	for i, path := range paths {
+		value := pathPrefix{Len: uint32(len(path))}
+		copy(value.Prefix[:], path)
+
+		contents[i] = ebpf.MapKV{Key: uint32(i), Value: value}
+	}
+
+	l.SetConst("filter_path", true)
+	l.SetConst("path_filter_count", uint32(len(paths)))
+	l.SetMapContents("path_filter", contents)
+}
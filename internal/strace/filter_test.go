@@ -0,0 +1,140 @@
+package strace
+
+import (
+	"embed"
+	"github.com/cilium/ebpf"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/filter"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"golang.org/x/sys/unix"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestSelectorMatch(t *testing.T) {
+	f, err := filter.Parse(`pid == 10 && name == openat`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sel := newSelector(&Config{Filter: f, Ret: filter.RetFailed, Comms: []string{"cat"}}, sysdesc.Default)
+	sel.cgroups = map[uint64]bool{42: true}
+
+	hdr := func(pid uint32, comm string, cgroup uint64) event.Header {
+		return event.Header{Pid: pid, Tid: pid, Comm: comm, CgroupID: cgroup}
+	}
+
+	openat := func(h event.Header, entry bool, ret int64) event.SyscallEvent {
+		return &event.OpenatEvent{Syscall: event.Syscall{Hdr: h, Entry: entry, Nr: 257, RetVal: ret}, Path: "/etc/hosts"}
+	}
+
+	events := []struct {
+		name  string
+		ev    event.SyscallEvent
+		match bool
+	}{
+		{"failed openat", openat(hdr(10, "cat", 42), false, -2), true},
+		{"successful openat", openat(hdr(10, "cat", 42), false, 3), false},
+		{"openat entry", openat(hdr(10, "cat", 42), true, 0), false},
+		{"openat of other pid", openat(hdr(11, "cat", 42), false, -2), false},
+		{"openat of other comm", openat(hdr(10, "sh", 42), false, -2), false},
+		{"openat of other cgroup", openat(hdr(10, "cat", 7), false, -2), false},
+		{"close", &event.CloseEvent{Syscall: event.Syscall{Hdr: hdr(10, "cat", 42), Nr: 3, RetVal: -9}}, false},
+		// у событий процессов и сигналов фильтр проверяется по заголовку
+		{"exit", &event.ProcessEvent{Syscall: event.Syscall{Hdr: hdr(10, "cat", 42)}, Kind: event.ProcessExit}, true},
+		{"exit of other pid", &event.ProcessEvent{Syscall: event.Syscall{Hdr: hdr(11, "cat", 42)}, Kind: event.ProcessExit}, false},
+		{"signal", &event.SignalEvent{Syscall: event.Syscall{Hdr: hdr(10, "cat", 42)}, Kind: event.SignalDeliver}, true},
+		{"signal of other pid", &event.SignalEvent{Syscall: event.Syscall{Hdr: hdr(11, "cat", 42)}, Kind: event.SignalDeliver}, false},
+		{"signal of other comm", &event.SignalEvent{Syscall: event.Syscall{Hdr: hdr(10, "sh", 42)}, Kind: event.SignalDeliver}, false},
+	}
+
+	for _, tt := range events {
+		if got := sel.match(tt.ev); got != tt.match {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.match)
+		}
+	}
+}
+
+func TestSelectorErrnos(t *testing.T) {
+	sel := newSelector(&Config{Errnos: []unix.Errno{unix.ENOENT}}, sysdesc.Default)
+
+	for ret, want := range map[int64]bool{-2: true, -13: false, 0: false} {
+		ev := &event.CloseEvent{Syscall: event.Syscall{Nr: 3, RetVal: ret}}
+		if got := sel.match(ev); got != want {
+			t.Errorf("ret %d: match = %v, want %v", ret, got, want)
+		}
+	}
+}
+
+func TestPushDown(t *testing.T) {
+	nr := func(name string) uint32 {
+		sc, ok := sysdesc.Default.ByName(name)
+		if !ok {
+			t.Fatalf("no syscall %s", name)
+		}
+
+		return sc.Nr[runtime.GOARCH]
+	}
+
+	l := NewLoader(embed.FS{})
+	pushDown(l, filter.Pushdown{
+		Pids:     []uint32{10, 20},
+		Syscalls: []string{"openat", "read", "openat", "no_such_syscall"},
+		Ret:      filter.RetFailed,
+	}, sysdesc.Default)
+
+	wantConsts := map[string]any{"filter_pids": true, "filter_syscalls": true, "filter_ret": int32(filter.RetFailed)}
+	if !reflect.DeepEqual(l.consts, wantConsts) {
+		t.Errorf("consts = %v, want %v", l.consts, wantConsts)
+	}
+
+	wantContents := map[string][]ebpf.MapKV{
+		"pid_filter": {{Key: uint32(10), Value: uint8(1)}, {Key: uint32(20), Value: uint8(1)}},
+		// повторы и неизвестные имена не попадают в карту
+		"syscall_filter": {{Key: nr("openat"), Value: uint8(1)}, {Key: nr("read"), Value: uint8(1)}},
+	}
+	if !reflect.DeepEqual(l.contents, wantContents) {
+		t.Errorf("contents = %v, want %v", l.contents, wantContents)
+	}
+
+	// фильтр без известных системных вызовов не пропускает ни одного
+	l = NewLoader(embed.FS{})
+	pushDown(l, filter.Pushdown{Syscalls: []string{"no_such_syscall"}}, sysdesc.Default)
+
+	if l.consts["filter_syscalls"] != true || len(l.contents["syscall_filter"]) != 0 {
+		t.Errorf("unknown syscalls: consts = %v, contents = %v", l.consts, l.contents)
+	}
+
+	// без условий фильтры не включаются
+	l = NewLoader(embed.FS{})
+	pushDown(l, filter.Pushdown{}, sysdesc.Default)
+
+	if want := map[string]any{"filter_ret": int32(filter.RetAny)}; !reflect.DeepEqual(l.consts, want) || len(l.contents) != 0 {
+		t.Errorf("empty pushdown: consts = %v, contents = %v", l.consts, l.contents)
+	}
+}
+
+func TestPushDownRet(t *testing.T) {
+	l := NewLoader(embed.FS{})
+	pushDownRet(l, &Config{Ret: filter.RetFailed, Errnos: []unix.Errno{unix.ENOENT, unix.EACCES}})
+
+	wantConsts := map[string]any{"filter_ret": int32(filter.RetFailed), "filter_errno": true}
+	if !reflect.DeepEqual(l.consts, wantConsts) {
+		t.Errorf("consts = %v, want %v", l.consts, wantConsts)
+	}
+
+	wantContents := map[string][]ebpf.MapKV{
+		"errno_filter": {{Key: uint32(unix.ENOENT), Value: uint8(1)}, {Key: uint32(unix.EACCES), Value: uint8(1)}},
+	}
+	if !reflect.DeepEqual(l.contents, wantContents) {
+		t.Errorf("contents = %v, want %v", l.contents, wantContents)
+	}
+
+	l = NewLoader(embed.FS{})
+	pushDownRet(l, &Config{})
+
+	if len(l.consts) != 0 || len(l.contents) != 0 {
+		t.Errorf("no conditions: consts = %v, contents = %v", l.consts, l.contents)
+	}
+}
@@ -0,0 +1,275 @@
+package strace
+
+import (
+	"context"
+	"fmt"
+	"github.com/ebirukov/bstrace"
+	"github.com/ebirukov/bstrace/pkg/capture"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// flight - бортовой самописец: хранит события за последнее окно в памяти
+// и сбрасывает их в файл записи по сигналу SIGUSR1 или по событию-триггеру
+type flight struct {
+	cfg     *Config
+	header  *capture.Header
+	ring    *capture.Ring
+	decoder *event.Decoder
+	// seq - номер сброса в имени файла: сбросы в одну миллисекунду не совпадают по имени
+	seq atomic.Uint64
+	// writes - сбросы, которые ещё записываются в файлы
+	writes sync.WaitGroup
+
+	// mu защищает сбросы и состояние триггеров
+	mu sync.Mutex
+	// fired - время последнего срабатывания каждого триггера: повторные
+	// срабатывания в пределах TriggerCooldown не приводят к новым сбросам
+	fired map[string]time.Time
+	// reasons - причины сработавших триггеров, сброс по которым ждёт окончания окна PostWindow
+	reasons []string
+	// timer - таймер сброса по окончании окна после триггера
+	timer *time.Timer
+	// closed - трассировка завершена, новые сбросы не начинаются
+	closed bool
+}
+
+// Flight непрерывно читает события в ограниченный буфер в памяти и сбрасывает
+// его в файл записи (формат команды record) при срабатывании триггера
+func Flight(cfg *Config) error {
+	// как и record, сохраняем события входа, чтобы дамп можно было вывести в любом формате
+	l := NewLoader(bstrace.BpfObjFS)
+	l.SetConst("emit_enter", true)
+	l.SetConst("capture_env", cfg.CaptureEnv)
+
+	hdr, err := captureHeader(l)
+	if err != nil {
+		return err
+	}
+
+	if err := pushDownScope(l, cfg); err != nil {
+		return err
+	}
+
+	f := &flight{
+		cfg:    cfg,
+		header: hdr,
+		// события окна перед триггером не должны вытесняться, пока идёт окно после него
+		ring:    capture.NewRing(cfg.Window+cfg.PostWindow, cfg.FlightMaxMem),
+		decoder: event.NewDecoder(runtime.GOARCH, sysdesc.Default),
+		fired:   make(map[string]time.Time),
+	}
+
+	bpfObjs, detach, err := attach(l, attachOptions{exec: len(cfg.ExecNames) > 0})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer detach()
+
+	// дампы дописываются до выхода, даже если трассировка завершилась
+	defer f.stop()
+
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer func() {
+		signal.Stop(usr1)
+		cancel()
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-usr1:
+				f.dumpNow("SIGUSR1")
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Printf("Flight recorder keeps the last %s of events, send SIGUSR1 to pid %d to dump them", cfg.Window, os.Getpid())
+
+	return Trace(bpfObjs.TracepointsObjs.EventBuf, f.handle)
+}
+
+func (f *flight) handle(sample []byte) error {
+	now := time.Now()
+	f.ring.Add(now, sample)
+
+	if key, reason, ok := f.trigger(sample); ok {
+		f.fire(key, reason, now)
+	}
+
+	return nil
+}
+
+// trigger проверяет, является ли событие триггером сброса. Возвращает
+// сработавший триггер (код ошибки или "latency") и причину сброса для журнала.
+// Триггерами могут быть только завершённые системные вызовы: у событий
+// процессов и сигналов поле результата означает другое.
+func (f *flight) trigger(sample []byte) (string, string, bool) {
+	if len(f.cfg.TriggerErrnos) == 0 && f.cfg.TriggerLatency == 0 {
+		return "", "", false
+	}
+
+	ev, err := f.decoder.Decode(sample)
+	if err != nil || !event.IsSyscall(ev) || ev.Raw().Entry || ev.Raw().NoReturn {
+		return "", "", false
+	}
+
+	if errno, ok := event.Errno(ev.Ret()); ok {
+		for _, trigger := range f.cfg.TriggerErrnos {
+			if errno == trigger {
+				name := event.ErrnoName(errno)
+
+				return name, fmt.Sprintf("%s returned %s", ev.Name(), name), true
+			}
+		}
+	}
+
+	if d := ev.Raw().Duration; f.cfg.TriggerLatency > 0 && d >= f.cfg.TriggerLatency {
+		return "latency", fmt.Sprintf("%s took %s", ev.Name(), d), true
+	}
+
+	return "", "", false
+}
+
+// fire откладывает сброс по сработавшему в момент at триггеру key до окончания
+// окна PostWindow, чтобы в дамп попали и события после триггера. Триггеры,
+// сработавшие за это время, попадают в тот же сброс, а повторные срабатывания
+// триггера в пределах TriggerCooldown пропускаются.
+func (f *flight) fire(key, reason string, at time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if last, ok := f.fired[key]; ok && at.Sub(last) < f.cfg.TriggerCooldown {
+		return
+	}
+
+	f.fired[key] = at
+	f.reasons = append(f.reasons, reason)
+
+	if f.timer == nil {
+		f.timer = time.AfterFunc(f.cfg.PostWindow, f.flush)
+	}
+}
+
+// flush сбрасывает события по сработавшим триггерам по окончании окна после них
+func (f *flight) flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.flushLocked()
+}
+
+// dumpNow сбрасывает события сразу, вместе с ожидающими окончания окна триггерами
+func (f *flight) dumpNow(reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reasons = append(f.reasons, reason)
+	f.flushLocked()
+}
+
+// stop сбрасывает события по сработавшим триггерам, не дожидаясь окончания
+// окна после них, и ждёт записи всех сбросов
+func (f *flight) stop() {
+	f.mu.Lock()
+	f.flushLocked()
+	f.closed = true
+	f.mu.Unlock()
+
+	f.writes.Wait()
+}
+
+// flushLocked сбрасывает события по накопленным причинам; вызывается под mu
+func (f *flight) flushLocked() {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+
+	if len(f.reasons) == 0 {
+		return
+	}
+
+	f.dump(strings.Join(f.reasons, ", "))
+	f.reasons = nil
+}
+
+// dump забирает события из памяти и записывает их в новый файл записи в
+// отдельной горутине, чтобы не задерживать чтение кольцевого буфера.
+// Вызывается под mu; после stop сбросы не начинаются.
+func (f *flight) dump(reason string) {
+	if f.closed {
+		return
+	}
+
+	samples := f.ring.Take()
+	if len(samples) == 0 {
+		log.Printf("Flight recorder triggered by %s, no events to dump", reason)
+
+		return
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("flight-%s-%d.bst", now.Format("20060102-150405.000"), f.seq.Add(1))
+	path := filepath.Join(f.cfg.DumpDir, name)
+
+	f.writes.Add(1)
+
+	go func() {
+		defer f.writes.Done()
+
+		if err := f.write(path, now, samples); err != nil {
+			log.Printf("Failed to dump flight recorder triggered by %s: %v", reason, err)
+
+			return
+		}
+
+		log.Printf("Flight recorder triggered by %s, %d events dumped to %s", reason, len(samples), path)
+	}()
+}
+
+// write записывает samples в файл path; существующий файл не перезаписывается
+func (f *flight) write(path string, created time.Time, samples [][]byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hdr := *f.header
+	hdr.Created = created
+
+	cw, err := capture.NewWriter(file, &hdr)
+	if err != nil {
+		return err
+	}
+
+	for _, sample := range samples {
+		if err := cw.WriteRecord(sample); err != nil {
+			return err
+		}
+	}
+
+	if err := cw.Flush(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
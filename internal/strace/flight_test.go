@@ -0,0 +1,86 @@
+package strace
+
+import (
+	"encoding/binary"
+	"github.com/ebirukov/bstrace/pkg/capture"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"golang.org/x/sys/unix"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// flightSample строит запись struct cdata вида kind с результатом ret
+func flightSample(kind uint32, ret int64) []byte {
+	sample := make([]byte, event.RecordSize)
+	binary.LittleEndian.PutUint32(sample[4:], kind)
+	binary.LittleEndian.PutUint64(sample[112:], uint64(ret))
+
+	return sample
+}
+
+func TestFlightTrigger(t *testing.T) {
+	f := &flight{
+		cfg:     &Config{TriggerErrnos: []unix.Errno{unix.EINTR}},
+		decoder: event.NewDecoder(runtime.GOARCH, sysdesc.Default),
+	}
+
+	if key, _, ok := f.trigger(flightSample(0, -int64(unix.EINTR))); !ok || key != "EINTR" {
+		t.Errorf("failed syscall: trigger = %q, %v", key, ok)
+	}
+
+	// доставка сигнала, прервавшего системный вызов, - не триггер
+	if key, _, ok := f.trigger(flightSample(6, -int64(unix.EINTR))); ok {
+		t.Errorf("signal delivery: trigger = %q", key)
+	}
+
+	if key, _, ok := f.trigger(flightSample(1, -int64(unix.EINTR))); ok {
+		t.Errorf("syscall entry: trigger = %q", key)
+	}
+}
+
+func TestFlightFire(t *testing.T) {
+	dir := t.TempDir()
+
+	f := &flight{
+		cfg:    &Config{DumpDir: dir, TriggerCooldown: time.Minute, PostWindow: time.Hour},
+		header: &capture.Header{},
+		ring:   capture.NewRing(time.Hour, 1<<20),
+		fired:  make(map[string]time.Time),
+	}
+
+	now := time.Now()
+	f.ring.Add(now, []byte{1})
+
+	f.fire("EIO", "read returned EIO", now)
+	// повтор того же триггера в пределах паузы пропускается
+	f.fire("EIO", "read returned EIO", now.Add(time.Second))
+	// другой триггер попадает в тот же сброс
+	f.fire("latency", "write took 2s", now.Add(time.Second))
+
+	if want := []string{"read returned EIO", "write took 2s"}; len(f.reasons) != len(want) || f.reasons[0] != want[0] || f.reasons[1] != want[1] {
+		t.Errorf("reasons = %q, want %q", f.reasons, want)
+	}
+
+	// по завершении сброс не ждёт окончания окна после триггера
+	f.stop()
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || f.ring.Len() != 0 {
+		t.Errorf("dumped %d files, %d events left", len(files), f.ring.Len())
+	}
+
+	// после паузы триггер снова срабатывает, но после stop сбросов нет
+	f.fire("EIO", "read returned EIO", now.Add(2*time.Minute))
+	f.flush()
+
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("dumped %d files after stop", len(files))
+	}
+}
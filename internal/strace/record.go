@@ -0,0 +1,187 @@
+package strace
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ebirukov/bstrace"
+	"github.com/ebirukov/bstrace/pkg/capture"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/output"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"golang.org/x/sys/unix"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Record записывает сырые события в файл для последующего разбора командой read
+func Record(cfg *Config) error {
+	// события входа записываются всегда, чтобы запись можно было вывести в любом формате
+	l := NewLoader(bstrace.BpfObjFS)
+	l.SetConst("emit_enter", true)
+	l.SetConst("capture_env", cfg.CaptureEnv)
+
+	hdr, err := captureHeader(l)
+	if err != nil {
+		return err
+	}
+
+	if err := pushDownScope(l, cfg); err != nil {
+		return err
+	}
+
+	f, err := os.Create(cfg.WriteFile)
+	if err != nil {
+		return fmt.Errorf("error creating capture file: %w", err)
+	}
+	defer f.Close()
+
+	cw, err := capture.NewWriter(f, hdr)
+	if err != nil {
+		return fmt.Errorf("error writing capture header: %w", err)
+	}
+
+	bpfObjs, detach, err := attach(l, attachOptions{exec: len(cfg.ExecNames) > 0})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer detach()
+
+	var records int
+
+	err = Trace(bpfObjs.TracepointsObjs.EventBuf, func(sample []byte) error {
+		records++
+
+		return cw.WriteRecord(sample)
+	})
+	if err != nil {
+		return fmt.Errorf("error writing capture record: %w", err)
+	}
+
+	if err := cw.Flush(); err != nil {
+		return fmt.Errorf("error writing capture file: %w", err)
+	}
+
+	log.Printf("Recorded %d events to %s", records, cfg.WriteFile)
+
+	return f.Close()
+}
+
+// captureHeader описывает текущее ядро и раскладку записей кольцевого буфера
+func captureHeader(l *BPFLoader) (*capture.Header, error) {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return nil, fmt.Errorf("error getting kernel release: %w", err)
+	}
+
+	spec, err := l.LoadObjSpec("kprog/obj/tp/strace.bpf.o")
+	if err != nil {
+		return nil, fmt.Errorf("error reading ebpf program file: %w", err)
+	}
+
+	eventBTF, err := capture.EventBTF(spec.Types)
+	if err != nil {
+		return nil, err
+	}
+
+	return &capture.Header{
+		KernelRelease:    unix.ByteSliceToString(uts.Release[:]),
+		Arch:             runtime.GOARCH,
+		BootTime:         event.BootTime(),
+		SyscallTableHash: sysdesc.Default.Hash(),
+		EventBTF:         eventBTF,
+		Created:          time.Now(),
+	}, nil
+}
+
+// Replay разбирает файл, записанный командой record, и выводит события
+// в выбранном формате
+func Replay(cfg *Config) error {
+	f, err := os.Open(cfg.ReadFile)
+	if err != nil {
+		return fmt.Errorf("error opening capture file: %w", err)
+	}
+	defer f.Close()
+
+	cr, err := capture.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", cfg.ReadFile, err)
+	}
+
+	hdr := cr.Header()
+
+	if st, err := hdr.EventType(); err != nil {
+		log.Printf("can't check event layout: %v", err)
+	} else if int(st.Size) != event.RecordSize {
+		return fmt.Errorf("capture event size %d doesn't match decoder record size %d", st.Size, event.RecordSize)
+	}
+
+	if hash := sysdesc.Default.Hash(); hdr.SyscallTableHash != hash {
+		if !cfg.Force {
+			return fmt.Errorf("capture was recorded with different syscall descriptions (hash %s, expected %s), use -force to read it anyway", hdr.SyscallTableHash, hash)
+		}
+
+		log.Printf("capture was recorded with different syscall descriptions, some events may be decoded incorrectly")
+	}
+
+	log.Printf("Reading capture of %s/%s recorded at %s", hdr.KernelRelease, hdr.Arch, hdr.Created.Format(time.RFC3339))
+
+	// времена событий отсчитываются от загрузки ядра, на котором сделана запись
+	event.SetBootTime(hdr.BootTime)
+
+	table := replayTable(hdr.Arch)
+	decoder := event.NewDecoder(hdr.Arch, table)
+
+	out, err := output.New(cfg.OutputFormat, os.Stdout, cfg.OutputOptions())
+	if err != nil {
+		return err
+	}
+
+	sel := newSelector(cfg, table)
+
+	if len(cfg.Cgroups) > 0 {
+		if sel.cgroups, err = cgroupSet(cfg.Cgroups); err != nil {
+			return err
+		}
+	}
+
+	handle := printEvents(decoder, out, sel, nil)
+
+	for {
+		sample, err := cr.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			return output.Close(out)
+		}
+
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", cfg.ReadFile, err)
+		}
+
+		if err := handle(sample); err != nil {
+			return err
+		}
+	}
+}
+
+// replayTable дополняет описания системных вызовов именами из таблицы
+// номеров архитектуры записи, т.к. BTF ядра, на котором она сделана, недоступен
+func replayTable(arch string) *sysdesc.Table {
+	syscalls, err := sysdesc.FromNumbers(arch)
+	if err != nil {
+		log.Printf("only syscalls with parsers will be named: %v", err)
+
+		return sysdesc.Default
+	}
+
+	table, err := sysdesc.Default.Merge(syscalls)
+	if err != nil {
+		log.Printf("only syscalls with parsers will be named: %v", err)
+
+		return sysdesc.Default
+	}
+
+	return table
+}
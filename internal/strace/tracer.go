@@ -1,19 +1,23 @@
 package strace
 
 import (
-	"bytes"
-	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/perf"
 	"github.com/cilium/ebpf/ringbuf"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/output"
+	"github.com/ebirukov/bstrace/pkg/stack"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 )
 
-func Trace(evtBuf *ebpf.Map) error {
+// Trace читает записи из кольцевого буфера и передаёт их в handle до получения
+// сигнала завершения
+func Trace(evtBuf *ebpf.Map, handle func(sample []byte) error) error {
 	// Открываем ringbuffer для чтения событий
 	rd, err := ringbuf.NewReader(evtBuf)
 	if err != nil {
@@ -22,18 +26,6 @@ func Trace(evtBuf *ebpf.Map) error {
 	defer rd.Close()
 
 	log.Println("Waiting for events... Press Ctrl+C to exit")
-	//u32 syscall_nr;
-	//u64 sc_arg1;
-	//u64 sc_arg2;
-	//u64 sc_arg3;
-	//union bpf_attr attr;
-	//s32 syscall_ret;
-	var event struct {
-		SyscallNR uint32
-		Arg1      uint64
-		Arg2      uint64
-		Arg3      uint64
-	}
 
 	// Ждем сигнала завершения
 	sig := make(chan os.Signal, 1)
@@ -58,12 +50,41 @@ func Trace(evtBuf *ebpf.Map) error {
 			continue
 		}
 
+		if err := handle(record.RawSample); err != nil {
+			return err
+		}
+	}
+}
+
+// printEvents возвращает обработчик записей, который декодирует их и выводит в out
+// события, отобранные sel. Отображения процессов, запустивших новый исполняемый
+// файл или завершившихся, удаляются из stacks (nil - стеки не символизируются).
+func printEvents(decoder *event.Decoder, out output.Writer, sel *selector, stacks *stack.Resolver) func(sample []byte) error {
+	return func(sample []byte) error {
 		// Парсим бинарные данные в структуру
-		if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
+		ev, err := decoder.Decode(sample)
+		if err != nil {
 			log.Printf("Failed to parse event: %v", err)
-			continue
+
+			return nil
+		}
+
+		// события процессов не имеют стеков, поэтому отображения можно удалить
+		// до вывода, в том числе для событий, не прошедших фильтр
+		if proc, ok := ev.(*event.ProcessEvent); ok && stacks != nil {
+			if proc.Kind == event.ProcessExec || proc.Kind == event.ProcessExit {
+				stacks.Forget(proc.Hdr.Pid)
+			}
+		}
+
+		if !sel.match(ev) {
+			return nil
+		}
+
+		if err := out.WriteEvent(ev); err != nil {
+			return fmt.Errorf("error writing event: %w", err)
 		}
 
-		log.Printf("New process started: Syscall=%d, Arg1=%d, Arg2=%d, Arg3=%d", event.SyscallNR, event.Arg1, event.Arg2, event.Arg3)
+		return nil
 	}
 }
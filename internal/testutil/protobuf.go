@@ -0,0 +1,87 @@
+package testutil
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Типы полей protobuf (wire type), которые разбирает ParseProto
+const (
+	WireVarint = 0
+	WireBytes  = 2
+)
+
+// ProtoField - поле сообщения protobuf
+type ProtoField struct {
+	Num  int
+	Wire int
+	// Varint - значение поля типа WireVarint
+	Varint uint64
+	// Bytes - содержимое поля типа WireBytes: строка, вложенное сообщение
+	// или упакованное повторяющееся поле
+	Bytes []byte
+}
+
+// ParseProto разбирает сообщение protobuf на поля в порядке их записи.
+// Поддерживаются только типы WireVarint и WireBytes.
+func ParseProto(data []byte) ([]ProtoField, error) {
+	var fields []ProtoField
+
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid field key")
+		}
+
+		data = data[n:]
+
+		f := ProtoField{Num: int(key >> 3), Wire: int(key & 7)}
+
+		switch f.Wire {
+		case WireVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("field %d: invalid varint", f.Num)
+			}
+
+			f.Varint = v
+			data = data[n:]
+		case WireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return nil, fmt.Errorf("field %d: invalid length", f.Num)
+			}
+
+			f.Bytes = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			return nil, fmt.Errorf("field %d: unsupported wire type %d", f.Num, f.Wire)
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+// Uints возвращает значения повторяющегося поля varint: одно значение для
+// неупакованного поля или все значения упакованного
+func (f ProtoField) Uints() ([]uint64, error) {
+	if f.Wire == WireVarint {
+		return []uint64{f.Varint}, nil
+	}
+
+	var vs []uint64
+
+	for data := f.Bytes; len(data) > 0; {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("field %d: invalid packed varint", f.Num)
+		}
+
+		vs = append(vs, v)
+		data = data[n:]
+	}
+
+	return vs, nil
+}
@@ -10,13 +10,26 @@ import (
 	"log"
 )
 
+// StartWatchRingReader читает записи кольцевого буфера в структуры T
 func StartWatchRingReader[T any](ctx context.Context, ringBuf *ebpf.Map) (chan *T, error) {
+	return StartWatchRingDecoder(ctx, ringBuf, func(sample []byte) (*T, error) {
+		var info T
+		if err := binary.Read(bytes.NewBuffer(sample), binary.LittleEndian, &info); err != nil {
+			return nil, err
+		}
+
+		return &info, nil
+	})
+}
+
+// StartWatchRingDecoder читает записи кольцевого буфера и разбирает их функцией decode
+func StartWatchRingDecoder[T any](ctx context.Context, ringBuf *ebpf.Map, decode func(sample []byte) (T, error)) (chan T, error) {
 	rd, err := ringbuf.NewReader(ringBuf)
 	if err != nil {
 		return nil, err
 	}
 
-	res := make(chan *T)
+	res := make(chan T)
 
 	go func(ctx context.Context) {
 		ctx, cancel := context.WithCancelCause(ctx)
@@ -45,8 +58,8 @@ func StartWatchRingReader[T any](ctx context.Context, ringBuf *ebpf.Map) (chan *
 
 			log.Printf("rec: %v", record)
 
-			var info T
-			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &info); err != nil {
+			info, err := decode(record.RawSample)
+			if err != nil {
 				err := fmt.Errorf("error parsing ringbuf event: %w", err)
 				log.Println(err)
 
@@ -56,7 +69,7 @@ func StartWatchRingReader[T any](ctx context.Context, ringBuf *ebpf.Map) (chan *
 			}
 
 			select {
-			case res <- &info:
+			case res <- info:
 			case <-ctx.Done():
 				cancel(ctx.Err())
 
@@ -1,15 +1,131 @@
 #include "vmlinux.h"
 #include <bpf/bpf_helpers.h>
+#include <bpf/bpf_core_read.h>
 
 #pragma once
 
+#ifndef TASK_COMM_LEN
+#define TASK_COMM_LEN 16
+#endif
+
+// Размер области данных, захваченных парсером из памяти пользовательского процесса
+#define SC_DATA_SIZE 1024
+// Максимальная длина строки (пути), захватываемой парсером
+#define SC_STR_SIZE 256
+// Максимальное число подсчитываемых элементов массива строк (argv, envp)
+#define SC_STRV_MAX_COUNT 128
+
+/*
+ * strv_header - заголовок массива строк в области данных записи,
+ * за которым подряд следуют захваченные строки с завершающими нулями
+ * @count: число элементов массива (не больше SC_STRV_MAX_COUNT)
+ * @captured: число захваченных строк
+ * @truncated: битовая маска строк, обрезанных до ограничения длины
+ */
+struct strv_header {
+    u32 count;
+    u32 captured;
+    u32 truncated;
+    u32 __reserved;
+};
+
+// Магическое число файловой системы nsfs, файлы которой - пространства имён
+#define NSFS_MAGIC 0x6e736673
+
+/*
+ * ns_fd - пространство имён, на которое ссылается файловый дескриптор
+ * @type: тип пространства имён CLONE_NEW*; 0 - дескриптор не из nsfs
+ * @inum: inode пространства имён (как в ссылках /proc/PID/ns)
+ */
+struct ns_fd {
+    u32 type;
+    u32 inum;
+};
+
+/*
+ * ns_common___ns_type - struct ns_common ядер с 6.18, где тип пространства
+ * имён хранится в самой структуре, а не в proc_ns_operations
+ */
+struct ns_common___ns_type {
+    u32 ns_type;
+} __attribute__((preserve_access_index));
+
+// Размеры struct clone_args первой и текущей версий (CLONE_ARGS_SIZE_VER0/VER2)
+#define CLONE_ARGS_SIZE_VER0 64
+#define CLONE_ARGS_SIZE 88
+// Максимальная длина массива set_tid clone3: глубина вложенности пространств имён PID
+#define MAX_PID_NS_LEVEL 32
+
+/*
+ * evt_header - общий заголовок события
+ * @ts: время входа в системный вызов (bpf_ktime_get_ns)
+ * @pid: идентификатор процесса (tgid)
+ * @tid: идентификатор потока
+ * @comm: имя исполняемой задачи
+ * @ns_pid: идентификатор процесса в его пространстве имён PID
+ * @ns_tid: идентификатор потока в его пространстве имён PID
+ * @pidns: inode пространства имён PID задачи (как у /proc/PID/ns/pid)
+ * @uid: идентификатор пользователя задачи (реальный uid)
+ * @cgroup_id: идентификатор cgroup v2 задачи (bpf_get_current_cgroup_id)
+ */
+struct evt_header {
+    u64 ts;
+    u32 pid;
+    u32 tid;
+    char comm[TASK_COMM_LEN];
+    u32 ns_pid;
+    u32 ns_tid;
+    u32 pidns;
+    u32 uid;
+    u64 cgroup_id;
+};
+
+// Тип записи в кольцевом буфере evt_buf
+enum evt_kind {
+    EVT_SYSCALL       = 0, // завершённый системный вызов
+    EVT_SYSCALL_ENTER = 1, // вход в системный вызов
+    EVT_PROC_EXEC     = 2, // успешный exec: data - путь исполняемого файла, sc_arg1 - tid до exec, sc_arg2 - родитель
+    EVT_PROC_FORK     = 3, // создание процесса или потока: sc_arg1 - pid, sc_arg2 - tid потомка
+    EVT_PROC_EXIT     = 4, // завершение процесса: sc_arg1 - код завершения (status wait), sc_arg2 - родитель
+    EVT_SIG_GENERATE  = 5, // сигнал отправлен задаче из заголовка: sc_arg1 - сигнал, sc_arg2, sc_arg3 - процесс и поток отправителя, sc_arg4 - group, sc_arg5 - result, data - siginfo и имя отправителя
+    EVT_SIG_DELIVER   = 6, // сигнал доставлен текущей задаче: sc_arg1 - сигнал, sc_arg2 - прерванный системный вызов
+};
+
+// Признаки записи о системном вызове, выставляемые парсером
+enum sc_flags {
+    SC_F_PATH_MATCH = 1 << 0, // системный вызов затрагивает путь из path_filter
+    SC_F_RET_FD     = 1 << 1, // системный вызов возвращает новый файловый дескриптор
+    SC_F_NORETURN   = 1 << 2, // поток завершился, не вернувшись из системного вызова (exit_group)
+};
+
+/*
+ * cdata - данные о системном вызове, собираемые парсером на входе и
+ * дополняемые в sc_exit. В таком же виде запись передаётся в user-space,
+ * поэтому раскладка структуры должна совпадать с декодером pkg/event.
+ */
 struct cdata {
     u32 syscall_nr;
+    u32 kind; // enum evt_kind
     u64 sc_arg1;
     u64 sc_arg2;
     u64 sc_arg3;
-    union bpf_attr attr;
-    s32 syscall_ret;
+    u64 sc_arg4;
+    u64 sc_arg5;
+    u64 sc_arg6;
+    struct evt_header hdr;
+    s64 syscall_ret;
+    u64 duration;
+    u64 out_ptr;  // адрес буфера, который копируется на выходе из системного вызова
+    u32 out_off;  // смещение буфера out_ptr в области данных
+    u32 out_size; // максимальный размер буфера out_ptr
+    s32 user_stack_id;   // стек пользовательского пространства в карте stacks (отрицательный, если не захвачен)
+    s32 kernel_stack_id; // стек ядра в карте stacks (отрицательный, если не захвачен)
+    u32 flags;           // enum sc_flags
+    u32 __reserved;
+    union {
+        union bpf_attr attr;
+        char data[SC_DATA_SIZE];
+    };
 };
 
 struct syscall_args {
@@ -26,4 +142,147 @@ struct {
     __uint(max_entries, 10240);
     __type(key, u32);      // tid
     __type(value, struct cdata);    // информация о syscall
-} sc_data SEC(".maps");
\ No newline at end of file
+} sc_data SEC(".maps");
+
+/**
+ * sc_copy - скопировать запись о системном вызове
+ * @dst: запись в карте или в кольцевом буфере
+ * @src: копируемая запись
+ *
+ * Запись больше, чем clang разворачивает присваивание структур для bpf
+ * (вызов memcpy не поддерживается), поэтому копируется через
+ * bpf_probe_read_kernel().
+ */
+static __always_inline void sc_copy(struct cdata *dst, const struct cdata *src) {
+    bpf_probe_read_kernel(dst, sizeof(*dst), src);
+}
+
+// кольцевой буфер для передачи событий в user-space
+struct {
+    __uint(type, BPF_MAP_TYPE_RINGBUF);
+    __uint(max_entries, 1 << 22);
+} evt_buf SEC(".maps");
+
+// Максимальное число префиксов путей в фильтре -P
+#define MAX_PATH_FILTERS 8
+
+/*
+ * path_prefix - префикс пути фильтра -P
+ * @len: длина префикса без завершающего нуля
+ * @prefix: префикс
+ */
+struct path_prefix {
+    u32 len;
+    char prefix[SC_STR_SIZE];
+};
+
+// префиксы путей, системные вызовы с которыми отслеживаются при включённом filter_path
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, MAX_PATH_FILTERS);
+    __type(key, u32);
+    __type(value, struct path_prefix);
+} path_filter SEC(".maps");
+
+// fd_key - файловый дескриптор процесса
+struct fd_key {
+    u32 tgid;
+    s32 fd;
+};
+
+// файловые дескрипторы, открытые на путях из path_filter
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 65536);
+    __type(key, struct fd_key);
+    __type(value, u8);
+} fd_paths SEC(".maps");
+
+// Отслеживать только системные вызовы, затрагивающие пути из path_filter
+const volatile bool filter_path = false;
+// Число заданных префиксов в path_filter
+const volatile u32 path_filter_count = 0;
+
+/**
+ * task_upid - идентификатор задачи в её пространстве имён PID
+ * @task: задача
+ * @upid: результат: номер и пространство имён
+ *
+ * Пространство имён задачи - последний уровень task->thread_pid, а не
+ * nsproxy->pid_ns_for_children: после unshare(CLONE_NEWPID) они различаются,
+ * и второе относится только к будущим потомкам.
+ */
+static __always_inline void task_upid(struct task_struct *task, struct upid *upid) {
+    struct pid *pid = BPF_CORE_READ(task, thread_pid);
+    unsigned int level = BPF_CORE_READ(pid, level);
+
+    bpf_core_read(upid, sizeof(*upid), &pid->numbers[level]);
+}
+
+/**
+ * task_pidns - inode пространства имён PID задачи
+ * @task: задача
+ */
+static __always_inline u32 task_pidns(struct task_struct *task) {
+    struct upid upid = {};
+
+    task_upid(task, &upid);
+
+    return BPF_CORE_READ(upid.ns, ns.inum);
+}
+
+/**
+ * current_pidns - inode пространства имён PID текущей задачи
+ */
+static __always_inline u32 current_pidns(void) {
+    return task_pidns((struct task_struct *)bpf_get_current_task());
+}
+
+/**
+ * fill_task_ns_ids - заполнить идентификаторы задачи в её пространстве имён PID
+ * @hdr: заголовок события
+ * @task: задача
+ */
+static __always_inline void fill_task_ns_ids(struct evt_header *hdr, struct task_struct *task) {
+    struct upid upid = {};
+
+    task_upid(task, &upid);
+    hdr->ns_tid = upid.nr;
+    hdr->pidns  = BPF_CORE_READ(upid.ns, ns.inum);
+
+    task_upid(BPF_CORE_READ(task, group_leader), &upid);
+    hdr->ns_pid = upid.nr;
+}
+
+/**
+ * fill_ns_ids - заполнить идентификаторы текущей задачи в её пространстве имён PID
+ * @hdr: заголовок события
+ */
+static __always_inline void fill_ns_ids(struct evt_header *hdr) {
+    fill_task_ns_ids(hdr, (struct task_struct *)bpf_get_current_task());
+}
+
+/**
+ * sc_read_out - скопировать буфер, заполненный системным вызовом
+ * @info: запись о системном вызове
+ * @ret: возвращаемое значение системного вызова (число записанных байт)
+ *
+ * Вызывается в sc_exit для буферов, длина которых известна только после
+ * завершения системного вызова (например, read). Копирует не более out_size байт.
+ */
+static __always_inline void sc_read_out(struct cdata *info, s64 ret) {
+    u32 off = info->out_off;
+    u64 n = ret;
+
+    if (!info->out_ptr || ret <= 0)
+        return;
+
+    if (n > info->out_size)
+        n = info->out_size;
+    if (n > SC_STR_SIZE)
+        n = SC_STR_SIZE;
+    if (off > SC_DATA_SIZE - SC_STR_SIZE)
+        return;
+
+    bpf_probe_read_user(&info->data[off], n, (void *)info->out_ptr);
+}
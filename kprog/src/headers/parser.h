@@ -0,0 +1,356 @@
+/*
+ * Этот файл содержит общие функции для программ-парсеров системных вызовов.
+ *
+ * Каждый парсер вызывается из sc_enter через bpf_tail_call(), подготавливает
+ * запись struct cdata в карте sc_data для текущего потока и заполняет в ней
+ * специфичные для системного вызова данные. Остальную работу выполняет sc_exit.
+ */
+
+#include "vmlinux.h"
+#include "common.h"
+#include "testing.h"
+#include <bpf/bpf_helpers.h>
+
+#pragma once
+
+// Инициализируем память под большую структуру в read-only map
+const struct cdata zero_cdata = {};
+
+// Передавать ли событие входа в системный вызов (задаётся из user-space перед загрузкой)
+const volatile bool emit_enter = false;
+// Захватывать ли строки окружения процессов (envp), а не только их число
+const volatile bool capture_env = false;
+
+/**
+ * sc_data_start - подготовить запись о системном вызове для текущего потока
+ * @syscall_nr: номер системного вызова
+ * @args: аргументы системного вызова
+ *
+ * Очищает (или создаёт) запись в карте sc_data, заполняет заголовок события
+ * и аргументы системного вызова.
+ * Возвращает указатель на запись в карте или NULL, если её не удалось создать.
+ */
+static __always_inline struct cdata *sc_data_start(u32 syscall_nr, struct syscall_args *args) {
+    u64 pid_tgid = bpf_get_current_pid_tgid();
+    u32 tid = (u32)pid_tgid;
+
+    struct cdata *info = bpf_map_lookup_elem(&sc_data, &tid);
+    if (!info) {
+        // копируем zero_cdata из read-only map в map sc_data
+        bpf_map_update_elem(&sc_data, &tid, &zero_cdata, BPF_ANY);
+        info = bpf_map_lookup_elem(&sc_data, &tid);
+        if (!info)
+            return NULL;
+    } else {
+        // очищаем существующую структуру копированием zero_cdata
+        sc_copy(info, &zero_cdata);
+    }
+
+    info->syscall_nr = syscall_nr;
+    info->sc_arg1    = args->arg1;
+    info->sc_arg2    = args->arg2;
+    info->sc_arg3    = args->arg3;
+    info->sc_arg4    = args->arg4;
+    info->sc_arg5    = args->arg5;
+    info->sc_arg6    = args->arg6;
+
+    // стек ядра ещё не захвачен: 0 - допустимый идентификатор стека
+    info->kernel_stack_id = -1;
+
+    info->hdr.ts  = bpf_ktime_get_ns();
+    info->hdr.pid = pid_tgid >> 32;
+    info->hdr.tid = tid;
+    bpf_get_current_comm(&info->hdr.comm, sizeof(info->hdr.comm));
+    fill_ns_ids(&info->hdr);
+    info->hdr.uid = bpf_get_current_uid_gid();
+    info->hdr.cgroup_id = bpf_get_current_cgroup_id();
+
+    return info;
+}
+
+/**
+ * sc_read_str - прочитать строку из памяти пользовательского процесса
+ * @info: запись о системном вызове
+ * @off: смещение в области данных записи
+ * @ptr: адрес строки в пользовательском пространстве
+ *
+ * Строка обрезается до SC_STR_SIZE байт, включая завершающий ноль.
+ */
+static __always_inline void sc_read_str(struct cdata *info, u32 off, u64 ptr) {
+    if (off > SC_DATA_SIZE - SC_STR_SIZE)
+        return;
+
+    bpf_probe_read_user_str(&info->data[off], SC_STR_SIZE, (void *)ptr);
+}
+
+/**
+ * sc_read_mem - прочитать структуру из памяти пользовательского процесса
+ * @info: запись о системном вызове
+ * @off: смещение в области данных записи
+ * @size: размер структуры
+ * @ptr: адрес структуры в пользовательском пространстве
+ */
+static __always_inline void sc_read_mem(struct cdata *info, u32 off, u32 size, u64 ptr) {
+    if (off + size > SC_DATA_SIZE)
+        return;
+
+    bpf_probe_read_user(&info->data[off], size, (void *)ptr);
+}
+
+/**
+ * sc_read_buf - прочитать буфер известной на входе длины
+ * @info: запись о системном вызове
+ * @off: смещение в области данных записи
+ * @size: максимальный размер буфера
+ * @ptr: адрес буфера в пользовательском пространстве
+ * @len: длина буфера из аргумента системного вызова
+ */
+static __always_inline void sc_read_buf(struct cdata *info, u32 off, u32 size, u64 ptr, u64 len) {
+    if (len > size)
+        len = size;
+    if (len > SC_STR_SIZE)
+        len = SC_STR_SIZE;
+    if (off > SC_DATA_SIZE - SC_STR_SIZE)
+        return;
+
+    bpf_probe_read_user(&info->data[off], len, (void *)ptr);
+}
+
+/**
+ * sc_read_strv - прочитать массив строк, завершённый NULL (argv, envp)
+ * @info: запись о системном вызове
+ * @off: смещение в области данных записи
+ * @size: размер области под массив, включая struct strv_header
+ * @max: максимальное число захватываемых строк (не больше 32); 0 - только подсчитать
+ * @str: максимальная длина каждой строки, включая завершающий ноль
+ * @ptr: адрес массива указателей в пользовательском пространстве
+ *
+ * Строки записываются подряд после заголовка, пока хватает места. Элементы
+ * массива подсчитываются до SC_STRV_MAX_COUNT, даже если их строки не захвачены.
+ */
+static __always_inline void sc_read_strv(struct cdata *info, u32 off, u32 size, u32 max, u32 str, u64 ptr) {
+    if (!ptr || off > SC_DATA_SIZE - size || size < sizeof(struct strv_header) + str || str > SC_STR_SIZE)
+        return;
+
+    struct strv_header *h = (struct strv_header *)&info->data[off];
+    // 64-битные смещения: при расширении u32 верификатор теряет проверенную границу
+    u64 pos = sizeof(*h);
+
+    for (u32 i = 0; i < SC_STRV_MAX_COUNT; i++) {
+        u64 p = 0;
+        if (bpf_probe_read_user(&p, sizeof(p), (void *)(ptr + i * sizeof(p))) || !p)
+            break;
+
+        h->count = i + 1;
+
+        if (i >= max || i >= 32 || pos > size - str)
+            continue;
+
+        // явная граница для верификатора: смещение строки переменное
+        u64 at = off + pos;
+        if (at > SC_DATA_SIZE - str)
+            continue;
+
+        long n = bpf_probe_read_user_str(&info->data[at], str, (void *)p);
+        if (n <= 0) {
+            info->data[at] = 0;
+            n = 1;
+        }
+
+        // строка длиной ровно str - 1 тоже считается обрезанной: конец не виден
+        if (n == str)
+            h->truncated |= 1U << i;
+
+        pos += n;
+        h->captured = i + 1;
+    }
+}
+
+/**
+ * sc_read_clone_args - прочитать аргументы clone3 с массивом set_tid
+ * @info: запись о системном вызове
+ * @off: смещение в области данных записи
+ * @size: размер области: struct clone_args и MAX_PID_NS_LEVEL идентификаторов
+ * @ptr: адрес struct clone_args в пользовательском пространстве
+ *
+ * Структура читается не больше размера из второго аргумента clone3: старые
+ * версии структуры короче, а недостающие поля остаются нулевыми. Массив
+ * set_tid записывается сразу за структурой.
+ */
+static __always_inline void sc_read_clone_args(struct cdata *info, u32 off, u32 size, u64 ptr) {
+    if (off > SC_DATA_SIZE - size || size < CLONE_ARGS_SIZE + MAX_PID_NS_LEVEL * sizeof(pid_t))
+        return;
+
+    u64 usize = info->sc_arg2;
+    if (usize < CLONE_ARGS_SIZE_VER0)
+        return;
+    if (usize > CLONE_ARGS_SIZE)
+        usize = CLONE_ARGS_SIZE;
+
+    struct clone_args *args = (struct clone_args *)&info->data[off];
+    if (bpf_probe_read_user(args, usize, (void *)ptr))
+        return;
+
+    u64 n = args->set_tid_size;
+    if (!args->set_tid || !n)
+        return;
+    if (n > MAX_PID_NS_LEVEL)
+        n = MAX_PID_NS_LEVEL;
+
+    bpf_probe_read_user(&info->data[off + CLONE_ARGS_SIZE], n * sizeof(pid_t), (void *)args->set_tid);
+}
+
+/**
+ * sc_read_ns_fd - определить пространство имён, на которое ссылается дескриптор
+ * @info: запись о системном вызове
+ * @off: смещение struct ns_fd в области данных записи
+ * @fd: файловый дескриптор из аргумента системного вызова
+ *
+ * Файл дескриптора берётся из таблицы файлов текущей задачи. Для файлов nsfs
+ * (открытых через /proc/PID/ns) записываются тип и inode пространства имён, для
+ * остальных (например, pidfd) запись остаётся нулевой.
+ */
+static __always_inline void sc_read_ns_fd(struct cdata *info, u32 off, u64 fd) {
+    if (off > SC_DATA_SIZE - sizeof(struct ns_fd))
+        return;
+
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    struct fdtable *fdt = BPF_CORE_READ(task, files, fdt);
+    if (!fdt || fd >= BPF_CORE_READ(fdt, max_fds))
+        return;
+
+    struct file **fds = BPF_CORE_READ(fdt, fd);
+    struct file *file = NULL;
+    if (bpf_probe_read_kernel(&file, sizeof(file), &fds[fd]) || !file)
+        return;
+
+    struct inode *inode = BPF_CORE_READ(file, f_inode);
+    if (BPF_CORE_READ(inode, i_sb, s_magic) != NSFS_MAGIC)
+        return;
+
+    // i_private файла nsfs указывает на struct ns_common пространства имён
+    struct ns_common *ns = BPF_CORE_READ(inode, i_private);
+
+    struct ns_fd *dst = (struct ns_fd *)&info->data[off];
+    if (bpf_core_field_exists(((struct ns_common___ns_type *)ns)->ns_type))
+        dst->type = BPF_CORE_READ((struct ns_common___ns_type *)ns, ns_type);
+    else
+        dst->type = BPF_CORE_READ(ns, ops, type);
+    dst->inum = BPF_CORE_READ(ns, inum);
+}
+
+/**
+ * sc_read_on_exit - отложить чтение буфера до выхода из системного вызова
+ * @info: запись о системном вызове
+ * @off: смещение в области данных записи
+ * @size: максимальный размер буфера
+ * @ptr: адрес буфера в пользовательском пространстве
+ *
+ * Буфер будет скопирован в sc_exit с длиной, равной возвращаемому значению.
+ */
+static __always_inline void sc_read_on_exit(struct cdata *info, u32 off, u32 size, u64 ptr) {
+    info->out_ptr  = ptr;
+    info->out_off  = off;
+    info->out_size = size;
+}
+
+/**
+ * sc_has_prefix - проверить, начинается ли захваченная строка с префикса
+ * @str: строка в области данных записи
+ * @p: префикс из path_filter
+ */
+static __always_inline bool sc_has_prefix(const char *str, const struct path_prefix *p) {
+    for (u32 i = 0; i < SC_STR_SIZE; i++) {
+        if (i >= p->len)
+            return true;
+        if (str[i] != p->prefix[i])
+            return false;
+    }
+
+    return true;
+}
+
+/**
+ * sc_match_path - сравнить захваченный путь с префиксами фильтра -P
+ * @info: запись о системном вызове
+ * @off: смещение пути, захваченного sc_read_str, в области данных записи
+ *
+ * Относительные пути сравниваются с префиксами как есть: рабочий каталог
+ * процесса в bpf программе недоступен.
+ */
+static __always_inline void sc_match_path(struct cdata *info, u32 off) {
+    if (!filter_path || off > SC_DATA_SIZE - SC_STR_SIZE)
+        return;
+
+    for (u32 i = 0; i < MAX_PATH_FILTERS; i++) {
+        if (i >= path_filter_count)
+            return;
+
+        struct path_prefix *p = bpf_map_lookup_elem(&path_filter, &i);
+        if (p && sc_has_prefix(&info->data[off], p)) {
+            info->flags |= SC_F_PATH_MATCH;
+            return;
+        }
+    }
+}
+
+/**
+ * sc_match_fd - проверить, открыт ли файловый дескриптор на пути из фильтра -P
+ * @info: запись о системном вызове
+ * @fd: файловый дескриптор из аргумента системного вызова
+ */
+static __always_inline void sc_match_fd(struct cdata *info, u64 fd) {
+    if (!filter_path)
+        return;
+
+    struct fd_key key = {.tgid = info->hdr.pid, .fd = fd};
+    if (bpf_map_lookup_elem(&fd_paths, &key))
+        info->flags |= SC_F_PATH_MATCH;
+}
+
+/**
+ * sc_forget_fd - забыть связь освобождаемого файлового дескриптора с путём
+ * @fd: файловый дескриптор из аргумента системного вызова
+ */
+static __always_inline void sc_forget_fd(u64 fd) {
+    if (!filter_path)
+        return;
+
+    struct fd_key key = {.tgid = bpf_get_current_pid_tgid() >> 32, .fd = fd};
+    bpf_map_delete_elem(&fd_paths, &key);
+}
+
+/**
+ * sc_ret_fd - отметить, что системный вызов возвращает новый файловый дескриптор
+ * @info: запись о системном вызове
+ *
+ * Если системный вызов затрагивает путь из фильтра -P, sc_exit запомнит
+ * возвращённый дескриптор в fd_paths, и последующие read/write/close
+ * на нём тоже пройдут фильтр.
+ */
+static __always_inline void sc_ret_fd(struct cdata *info) {
+    info->flags |= SC_F_RET_FD;
+}
+
+/**
+ * sc_submit_enter - передать в user-space событие входа в системный вызов
+ * @info: запись о системном вызове с захваченными на входе данными
+ *
+ * Нужна для вывода в формате strace, где начало строки печатается на входе
+ * в системный вызов, а результат - на выходе.
+ */
+static __always_inline void sc_submit_enter(struct cdata *info) {
+    if (!emit_enter)
+        return;
+    if (filter_path && !(info->flags & SC_F_PATH_MATCH))
+        return;
+
+    struct cdata *event = bpf_ringbuf_reserve(&evt_buf, sizeof(*event), 0);
+    if (!event)
+        return;
+
+    sc_copy(event, info);
+    event->kind = EVT_SYSCALL_ENTER;
+
+    bpf_ringbuf_submit(event, 0);
+}
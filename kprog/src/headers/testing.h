@@ -23,6 +23,8 @@
 #include <bpf/bpf_core_read.h>
 #include <bpf/bpf_tracing.h>
 
+#pragma once
+
 #ifdef __TEST_RUN
 #define BPF_CORE_READ_AUTO(ptr, field) BPF_CORE_READ_USER(ptr, field)
 #else
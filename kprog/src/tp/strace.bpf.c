@@ -14,16 +14,84 @@
  *      - легко управлять набором обрабатываемых вызовов: чтобы исключить
  *        ненужный системный вызов — достаточно не добавлять его в карту.
  *
- * 2. Карта evt_buf:
+ * 2. Карта evt_buf (объявлена в common.h):
  *    Тип: BPF_MAP_TYPE_RINGBUF
  *    Используется для передачи данных из eBPF в пользовательское пространство
- *    через кольцевой буфер.
+ *    через кольцевой буфер. Парсеры также передают через неё события входа
+ *    в системный вызов, если это включено из user-space.
  *
- * 3. Точка входа sc_enter:
+ * 3. Карта stacks:
+ *    Тип: BPF_MAP_TYPE_STACK_TRACE
+ *    Хранит стеки пользовательского пространства, из которых сделаны
+ *    системные вызовы. Стек захватывается в sc_exit, если это включено
+ *    из user-space константой capture_stacks: на выходе из системного вызова
+ *    пользовательский стек тот же, что и на входе.
+ *    Там же хранятся стеки ядра медленных и завершившихся ошибкой системных
+ *    вызовов (константа capture_kstacks). Стек ядра на выходе из системного
+ *    вызова не показывает, где он ждал, поэтому sc_sched_switch запоминает
+ *    стек ядра в момент, когда поток в системном вызове уступает процессор.
+ *    В sc_exit этот стек оставляется только для медленных или неудачных
+ *    вызовов, а если поток не засыпал, захватывается текущий стек ядра.
+ *
+ * 4. Карты pid_filter и errno_filter:
+ *    Тип: BPF_MAP_TYPE_LRU_HASH, BPF_MAP_TYPE_HASH
+ *    Процессы (tgid), системные вызовы которых отслеживаются, если включён
+ *    фильтр по процессам (filter_pids), и коды ошибок, с которыми должен
+ *    завершиться системный вызов, если включён фильтр filter_errno.
+ *    Вместе с filter_ret и набором парсеров в sc_parsers реализуют простые
+ *    условия фильтра событий в ядре. Условия на результат проверяются в sc_exit
+ *    до резервирования места в evt_buf, чтобы ненужные события не переполняли его.
+ *    sc_sched_exec добавляет в pid_filter процессы, запустившие исполняемый
+ *    файл из exec_filter, и они отслеживаются с первой инструкции после exec.
+ *    sc_sched_exit удаляет процессы из pid_filter при завершении, чтобы фильтр
+ *    не пропускал процесс, получивший тот же идентификатор.
+ *    Карта pid_exclude содержит сам трассировщик: его чтение evt_buf и вывод
+ *    событий иначе порождали бы новые события. sc_sched_fork добавляет в неё
+ *    процессы, порождённые исключёнными, а sc_sched_exit удаляет завершённые.
+ *
+ * 5. Карта cgroup_filter:
+ *    Тип: BPF_MAP_TYPE_HASH
+ *    Идентификаторы cgroup v2, процессы которых (включая вложенные cgroup)
+ *    отслеживаются, если включён фильтр filter_cgroup. sc_enter сравнивает
+ *    с ней cgroup текущей задачи и всех её предков.
+ *
+ * 6. Карты comm_filter, uid_filter и gid_filter:
+ *    Тип: BPF_MAP_TYPE_HASH
+ *    Имена задач и идентификаторы пользователей и групп, системные вызовы
+ *    которых отслеживаются, если включены фильтры filter_comm, filter_uid
+ *    и filter_gid. Позволяют следить за сервисом или учётной записью без
+ *    знания PID, в том числе после перезапусков.
+ *
+ * 7. Карты path_filter и fd_paths (объявлены в common.h):
+ *    Префиксы путей фильтра -P и файловые дескрипторы процессов, открытые
+ *    на этих путях. Парсеры отмечают системные вызовы, затрагивающие такие
+ *    пути или дескрипторы; sc_exit пропускает только их и запоминает
+ *    дескрипторы, возвращённые при открытии подходящих путей.
+ *
+ * 8. Точка входа sc_enter:
  *    Подписана на raw tracepoint `sys_enter`.
  *    Получает регистры (pt_regs) и номер системного вызова (syscall_nr),
  *    после чего делегирует выполнение соответствующей eBPF-программе из карты
- *    `sc_parsers` с помощью bpf_tail_call().
+ *    `sc_parsers` с помощью bpf_tail_call(). Для системных вызовов без
+ *    парсера сама записывает в sc_data номер и шесть аргументов, которые
+ *    sc_exit передаёт вместе с результатом.
+ *    Карта syscall_filter ограничивает отслеживаемые системные вызовы, если
+ *    включён фильтр filter_syscalls.
+ *
+ * 9. События процессов sc_sched_exec, sc_sched_fork и sc_sched_exit:
+ *    Подписаны на raw tracepoint `sched_process_exec`, `sched_process_fork`
+ *    и `sched_process_exit` и передают через evt_buf записи EVT_PROC_* о
+ *    запуске файла, создании задачи и завершении процесса. sc_sched_exit
+ *    также передаёт системные вызовы, из которых поток не вернулся
+ *    (exit_group), и удаляет их записи из sc_data.
+ *
+ * 10. Сигналы sc_signal_generate и sc_signal_deliver:
+ *    Подписаны на raw tracepoint `signal_generate` и `signal_deliver` и
+ *    передают записи EVT_SIG_* с siginfo об отправке сигнала отслеживаемой
+ *    задаче и о его доставке ей. Отправка проверяется по получателю
+ *    (sc_task_traced), а не по отправителю. sc_exit запоминает в карте
+ *    sc_interrupted системный вызов, прерванный сигналом (EINTR, ERESTART*),
+ *    и при доставке сигнала sc_signal_deliver передаёт его вместе с событием.
  *
  * Этот файл работает совместно с поддержкой тестирования, реализованной
  * в `testing.h`, которая позволяет использовать eBPF-программы в
@@ -32,6 +100,7 @@
 
 #include "vmlinux.h"
 #include "common.h"
+#include "parser.h"
 #include "testing.h"
 #include <bpf/bpf_helpers.h>
 #include <bpf/bpf_core_read.h>
@@ -40,14 +109,294 @@
 struct {
      __uint(type, BPF_MAP_TYPE_PROG_ARRAY);
      __uint(key_size, sizeof(u32));
-     __uint(max_entries, 400);
+     __uint(max_entries, 512);
      __array(values, u32 (void *));
 } sc_parsers SEC(".maps");
 
+// глубина стека, как PERF_MAX_STACK_DEPTH
+#define MAX_STACK_DEPTH 127
+
+struct {
+    __uint(type, BPF_MAP_TYPE_STACK_TRACE);
+    __uint(key_size, sizeof(u32));
+    __uint(value_size, MAX_STACK_DEPTH * sizeof(u64));
+    __uint(max_entries, 16384);
+} stacks SEC(".maps");
+
+// LRU: если процессов, добавленных sc_sched_exec, больше, чем мест в карте,
+// вытесняются самые давние; завершённые удаляет sc_sched_exit
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 1024);
+    __type(key, u32);  // tgid
+    __type(value, u8);
+} pid_filter SEC(".maps");
+
+// процессы (tgid), которые никогда не отслеживаются: сам трассировщик и
+// порождённые им процессы (sc_sched_fork); удаляются при завершении (sc_sched_exit)
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 64);
+    __type(key, u32);  // tgid
+    __type(value, u8);
+} pid_exclude SEC(".maps");
+
+// имена исполняемых файлов (полный путь или имя задачи), процессы которых
+// добавляются в pid_filter при exec
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 64);
+    __type(key, char[SC_STR_SIZE]);
+    __type(value, u8);
+} exec_filter SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 256);
+    __type(key, u32);  // errno
+    __type(value, u8);
+} errno_filter SEC(".maps");
+
+// максимальная глубина вложенности cgroup, проверяемая фильтром
+#define MAX_CGROUP_LEVEL 16
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 64);
+    __type(key, u64);  // cgroup id
+    __type(value, u8);
+} cgroup_filter SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 64);
+    __type(key, char[TASK_COMM_LEN]);
+    __type(value, u8);
+} comm_filter SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 64);
+    __type(key, u32);  // uid
+    __type(value, u8);
+} uid_filter SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 64);
+    __type(key, u32);  // gid
+    __type(value, u8);
+} gid_filter SEC(".maps");
+
+// номера системных вызовов, которые отслеживаются, если включён фильтр filter_syscalls
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 512);
+    __type(key, u32);  // номер системного вызова
+    __type(value, u8);
+} syscall_filter SEC(".maps");
+
+// Отслеживать только системные вызовы из syscall_filter
+const volatile bool filter_syscalls = false;
+// Отслеживать только процессы из pid_filter
+const volatile bool filter_pids = false;
+// Добавлять в pid_filter процессы, запустившие исполняемый файл из exec_filter
+const volatile bool filter_exec = false;
+// Не отслеживать процессы из pid_exclude
+const volatile bool exclude_pids = false;
+// Передавать только системные вызовы, завершившиеся с ошибкой из errno_filter
+const volatile bool filter_errno = false;
+// Отслеживать только процессы из cgroup_filter и вложенных в них cgroup
+const volatile bool filter_cgroup = false;
+// Отслеживать только процессы пространства имён PID с этим inode (0 - все)
+const volatile u32 filter_pidns = 0;
+// Отслеживать только задачи с именами из comm_filter
+const volatile bool filter_comm = false;
+// Отслеживать только задачи пользователей из uid_filter и групп из gid_filter
+const volatile bool filter_uid = false;
+const volatile bool filter_gid = false;
+// Знак возвращаемого значения передаваемых событий: 0 - любой, <0 - только ошибки, >0 - только успешные
+const volatile s32 filter_ret = 0;
+
+// Захватывать ли стек пользовательского пространства (задаётся из user-space перед загрузкой)
+const volatile bool capture_stacks = false;
+// Захватывать ли стек ядра для завершившихся ошибкой системных вызовов
+// и вызовов длительностью не меньше kstack_min_duration нс
+const volatile bool capture_kstacks = false;
+const volatile u64 kstack_min_duration = 0;
+
+// Коды ядра, с которыми системный вызов прерывается сигналом (include/linux/errno.h)
+#define EINTR                 4
+#define ERESTARTSYS           512
+#define ERESTARTNOINTR        513
+#define ERESTARTNOHAND        514
+#define ERESTART_RESTARTBLOCK 516
+
+/*
+ * sc_interrupt - системный вызов, прерванный сигналом
+ * @nr: номер системного вызова
+ * @ret: код прерывания (-EINTR, -ERESTART*)
+ */
+struct sc_interrupt {
+    s32 nr;
+    u32 __reserved;
+    s64 ret;
+};
+
+// Прерванные сигналом системные вызовы потоков до доставки сигнала
 struct {
-    __uint(type, BPF_MAP_TYPE_RINGBUF);
-    __uint(max_entries, 1 << 12);
-} evt_buf SEC(".maps");
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 10240);
+    __type(key, u32);  // tid
+    __type(value, struct sc_interrupt);
+} sc_interrupted SEC(".maps");
+
+/**
+ * sc_is_interrupt - проверить, прерван ли системный вызов сигналом
+ * @ret: возвращаемое значение системного вызова
+ */
+static __always_inline bool sc_is_interrupt(s64 ret) {
+    switch (ret) {
+    case -EINTR:
+    case -ERESTARTSYS:
+    case -ERESTARTNOINTR:
+    case -ERESTARTNOHAND:
+    case -ERESTART_RESTARTBLOCK:
+        return true;
+    }
+
+    return false;
+}
+
+/**
+ * sc_in_cgroup - проверить, входит ли текущая задача в cgroup из cgroup_filter
+ *
+ * Проверяет cgroup задачи и её предков: bpf_get_current_ancestor_cgroup_id()
+ * возвращает 0 для уровней глубже cgroup задачи.
+ */
+static __always_inline bool sc_in_cgroup(void) {
+    for (int level = 0; level < MAX_CGROUP_LEVEL; level++) {
+        u64 id = bpf_get_current_ancestor_cgroup_id(level);
+        if (!id)
+            return false;
+        if (bpf_map_lookup_elem(&cgroup_filter, &id))
+            return true;
+    }
+
+    return false;
+}
+
+/**
+ * sc_traced - проверить, отслеживается ли текущая задача
+ *
+ * Пропускает исключённые процессы (pid_exclude) и задачи, не проходящие
+ * включённые фильтры: по процессам (pid_filter), cgroup (cgroup_filter),
+ * пространству имён PID (filter_pidns), имени задачи (comm_filter) и
+ * пользователю или группе (uid_filter, gid_filter).
+ */
+static __always_inline bool sc_traced(void) {
+    if (exclude_pids) {
+        u32 tgid = bpf_get_current_pid_tgid() >> 32;
+        if (bpf_map_lookup_elem(&pid_exclude, &tgid))
+            return false;
+    }
+
+    if (filter_pids) {
+        u32 tgid = bpf_get_current_pid_tgid() >> 32;
+        if (!bpf_map_lookup_elem(&pid_filter, &tgid))
+            return false;
+    }
+
+    if (filter_cgroup && !sc_in_cgroup())
+        return false;
+
+    if (filter_pidns && current_pidns() != filter_pidns)
+        return false;
+
+    if (filter_comm) {
+        char comm[TASK_COMM_LEN] = {};
+        bpf_get_current_comm(comm, sizeof(comm));
+        if (!bpf_map_lookup_elem(&comm_filter, comm))
+            return false;
+    }
+
+    if (filter_uid || filter_gid) {
+        u64 uid_gid = bpf_get_current_uid_gid();
+        u32 uid = uid_gid;
+        u32 gid = uid_gid >> 32;
+
+        if (filter_uid && !bpf_map_lookup_elem(&uid_filter, &uid))
+            return false;
+        if (filter_gid && !bpf_map_lookup_elem(&gid_filter, &gid))
+            return false;
+    }
+
+    return true;
+}
+
+/**
+ * sc_task_in_cgroup - проверить, входит ли задача в cgroup из cgroup_filter
+ * @task: задача
+ *
+ * Как sc_in_cgroup, но для произвольной задачи: cgroup v2 задачи и её предки
+ * проверяются от самой задачи к корню.
+ */
+static __always_inline bool sc_task_in_cgroup(struct task_struct *task) {
+    struct cgroup *cgrp = BPF_CORE_READ(task, cgroups, dfl_cgrp);
+
+    for (int level = 0; level < MAX_CGROUP_LEVEL && cgrp; level++) {
+        u64 id = BPF_CORE_READ(cgrp, kn, id);
+        if (bpf_map_lookup_elem(&cgroup_filter, &id))
+            return true;
+
+        cgrp = BPF_CORE_READ(cgrp, self.parent, cgroup);
+    }
+
+    return false;
+}
+
+/**
+ * sc_task_traced - проверить, отслеживается ли задача
+ * @task: задача
+ *
+ * Те же условия, что в sc_traced, для задачи, которая не является текущей:
+ * например, для получателя сигнала в signal_generate.
+ */
+static __always_inline bool sc_task_traced(struct task_struct *task) {
+    u32 tgid = BPF_CORE_READ(task, tgid);
+
+    if (exclude_pids && bpf_map_lookup_elem(&pid_exclude, &tgid))
+        return false;
+
+    if (filter_pids && !bpf_map_lookup_elem(&pid_filter, &tgid))
+        return false;
+
+    if (filter_cgroup && !sc_task_in_cgroup(task))
+        return false;
+
+    if (filter_pidns && task_pidns(task) != filter_pidns)
+        return false;
+
+    if (filter_comm) {
+        char comm[TASK_COMM_LEN] = {};
+        BPF_CORE_READ_STR_INTO(&comm, task, comm);
+        if (!bpf_map_lookup_elem(&comm_filter, comm))
+            return false;
+    }
+
+    if (filter_uid || filter_gid) {
+        const struct cred *cred = BPF_CORE_READ(task, cred);
+        u32 uid = BPF_CORE_READ(cred, uid.val);
+        u32 gid = BPF_CORE_READ(cred, gid.val);
+
+        if (filter_uid && !bpf_map_lookup_elem(&uid_filter, &uid))
+            return false;
+        if (filter_gid && !bpf_map_lookup_elem(&gid_filter, &gid))
+            return false;
+    }
+
+    return true;
+}
 
 /**
  * sc_enter - обработчик события входа в системный вызов
@@ -55,16 +404,45 @@ struct {
  * @syscall_nr: номер системного вызова
  *
  * Используется как точка входа на tracepoint `raw_tp/sys_enter`.
+ * Пропускает задачи, которые не отслеживаются (sc_traced), и системные вызовы
+ * не из syscall_filter, если включён фильтр filter_syscalls.
  * Выполняет хвостовой вызов в карту `sc_parsers` в зависимости от номера системного вызова.
  * Это позволяет перенаправить выполнение на eBPF-программу, отвечающую за обработку
  * конкретного системного вызова. Если программа не добавлена в `sc_parsers`,
- * функция завершает выполнение без дальнейшей обработки.
+ * хвостовой вызов возвращает управление, и запись заполняется только
+ * аргументами системного вызова; результат добавляет sc_exit.
  */
 SEC("raw_tp/sys_enter")
 int BPF_PROG(sc_enter, struct pt_regs *pt_regs, __s64 syscall_nr)
 {
+    if (!sc_traced())
+        return 0;
+
+    // сигнал, прервавший прошлый системный вызов, уже доставлен или не доставлялся
+    u32 tid = bpf_get_current_pid_tgid();
+    bpf_map_delete_elem(&sc_interrupted, &tid);
+
+    if (filter_syscalls) {
+        u32 nr = syscall_nr;
+        if (!bpf_map_lookup_elem(&syscall_filter, &nr))
+            return 0;
+    }
+
     bpf_tail_call(ctx, &sc_parsers, syscall_nr);
 
+    // парсера нет: без него не проверить пути фильтра -P, и sc_exit такую запись всё равно отбросит
+    if (filter_path)
+        return 0;
+
+    struct syscall_args sc_args = {};
+    fill_syscall_args(pt_regs, &sc_args);
+
+    struct cdata *info = sc_data_start(syscall_nr, &sc_args);
+    if (!info)
+        return 0;
+
+    sc_submit_enter(info);
+
     return 0;
 }
 
@@ -86,6 +464,12 @@ int BPF_PROG(sc_exit, struct pt_regs *regs, __s64 ret)
     u64 pid_tgid = bpf_get_current_pid_tgid();
     u32 tid = pid_tgid;
 
+    // сигнал доставляется после sys_exit: sc_signal_deliver возьмёт прерванный вызов из карты
+    if (sc_is_interrupt(ret) && sc_traced()) {
+        struct sc_interrupt intr = {.nr = bpf_get_syscall_nr(regs), .ret = ret};
+        bpf_map_update_elem(&sc_interrupted, &tid, &intr, BPF_ANY);
+    }
+
     struct cdata *info = bpf_map_lookup_elem(&sc_data, &tid);
     if (!info) {
         return 0;
@@ -97,9 +481,46 @@ int BPF_PROG(sc_exit, struct pt_regs *regs, __s64 ret)
         return 0;
     }
 
+    if ((filter_ret < 0 && ret >= 0) || (filter_ret > 0 && ret < 0)) {
+        bpf_map_delete_elem(&sc_data, &tid);
+        return 0;
+    }
+
+    if (filter_errno) {
+        u32 errno = -ret;
+        if (ret >= 0 || !bpf_map_lookup_elem(&errno_filter, &errno)) {
+            bpf_map_delete_elem(&sc_data, &tid);
+            return 0;
+        }
+    }
+
+    if (filter_path) {
+        if (!(info->flags & SC_F_PATH_MATCH)) {
+            bpf_map_delete_elem(&sc_data, &tid);
+            return 0;
+        }
+
+        if ((info->flags & SC_F_RET_FD) && ret >= 0) {
+            struct fd_key key = {.tgid = pid_tgid >> 32, .fd = ret};
+            u8 one = 1;
+            bpf_map_update_elem(&fd_paths, &key, &one, BPF_ANY);
+        }
+    }
+
     info->syscall_ret = ret;
+    info->duration = bpf_ktime_get_ns() - info->hdr.ts;
+    sc_read_out(info, ret);
 
-    bpf_printk("syscall %lu returned %ld cmd %lu", info->syscall_nr, info->syscall_ret, info->sc_arg1);
+    info->user_stack_id = -1;
+    if (capture_stacks)
+        info->user_stack_id = bpf_get_stackid(ctx, &stacks, BPF_F_USER_STACK);
+
+    if (capture_kstacks && (ret < 0 || info->duration >= kstack_min_duration)) {
+        if (info->kernel_stack_id < 0)
+            info->kernel_stack_id = bpf_get_stackid(ctx, &stacks, 0);
+    } else {
+        info->kernel_stack_id = -1;
+    }
 
     struct cdata *event = bpf_ringbuf_reserve(&evt_buf, sizeof(*event), 0);
     if (!event) {
@@ -107,7 +528,7 @@ int BPF_PROG(sc_exit, struct pt_regs *regs, __s64 ret)
         return 0;
     }
 
-    *event = *info;  // копируем данные о системном вызове из map sc_data в кольцевой буфер
+    sc_copy(event, info); // копируем данные о системном вызове из map sc_data в кольцевой буфер
     bpf_map_delete_elem(&sc_data, &tid); //возможно лишним будет удалять временные данные из карты?
 
     bpf_ringbuf_submit(event, 0);
@@ -115,4 +536,392 @@ int BPF_PROG(sc_exit, struct pt_regs *regs, __s64 ret)
     return 0;
 }
 
+/**
+ * sc_sched_switch - обработчик переключения задач
+ * @preempt: задача вытеснена, а не уступила процессор сама
+ * @prev: задача, уступающая процессор (текущая)
+ * @next: задача, получающая процессор
+ *
+ * Подписан на tracepoint `raw_tp/sched_switch`. Если текущий поток заснул внутри
+ * отслеживаемого системного вызова, запоминает стек ядра в его записи sc_data:
+ * этот стек показывает, где системный вызов ждёт (файловая система, сеть, блокировка).
+ */
+SEC("raw_tp/sched_switch")
+int BPF_PROG(sc_sched_switch, bool preempt, struct task_struct *prev, struct task_struct *next)
+{
+    if (!capture_kstacks || preempt)
+        return 0;
+
+    u32 tid = bpf_get_current_pid_tgid();
+
+    struct cdata *info = bpf_map_lookup_elem(&sc_data, &tid);
+    if (!info)
+        return 0;
+
+    info->kernel_stack_id = bpf_get_stackid(ctx, &stacks, 0);
+
+    return 0;
+}
+
+/**
+ * task_event_start - зарезервировать в evt_buf запись о событии задачи
+ * @kind: тип события (EVT_PROC_* или EVT_SIG_*)
+ *
+ * Заполняет заголовок по текущей задаче и обнуляет поля системного вызова.
+ * Возвращает NULL, если в evt_buf нет места.
+ */
+static __always_inline struct cdata *task_event_start(u32 kind) {
+    struct cdata *event = bpf_ringbuf_reserve(&evt_buf, sizeof(*event), 0);
+    if (!event)
+        return NULL;
+
+    u64 pid_tgid = bpf_get_current_pid_tgid();
+
+    event->syscall_nr = 0;
+    event->kind       = kind;
+    event->sc_arg1    = 0;
+    event->sc_arg2    = 0;
+    event->sc_arg3    = 0;
+    event->sc_arg4    = 0;
+    event->sc_arg5    = 0;
+    event->sc_arg6    = 0;
+
+    event->hdr.ts  = bpf_ktime_get_ns();
+    event->hdr.pid = pid_tgid >> 32;
+    event->hdr.tid = pid_tgid;
+    bpf_get_current_comm(&event->hdr.comm, sizeof(event->hdr.comm));
+    fill_ns_ids(&event->hdr);
+    event->hdr.uid        = bpf_get_current_uid_gid();
+    event->hdr.cgroup_id  = bpf_get_current_cgroup_id();
+
+    event->syscall_ret     = 0;
+    event->duration        = 0;
+    event->out_ptr         = 0;
+    event->out_off         = 0;
+    event->out_size        = 0;
+    event->user_stack_id   = -1;
+    event->kernel_stack_id = -1;
+    event->flags           = 0;
+    event->__reserved      = 0;
+    event->data[0]         = 0;
+
+    return event;
+}
+
+/**
+ * sc_exec_match - проверить, запущен ли исполняемый файл из exec_filter
+ * @bprm: параметры запуска исполняемого файла
+ *
+ * Сравнивает с exec_filter имя задачи (уже заменённое на имя файла) и полный путь файла.
+ */
+static __always_inline bool sc_exec_match(struct linux_binprm *bprm) {
+    char name[SC_STR_SIZE] = {};
+
+    bpf_get_current_comm(name, TASK_COMM_LEN);
+    if (bpf_map_lookup_elem(&exec_filter, name))
+        return true;
+
+    __builtin_memset(name, 0, sizeof(name));
+    bpf_probe_read_kernel_str(name, sizeof(name), BPF_CORE_READ(bprm, filename));
+
+    return bpf_map_lookup_elem(&exec_filter, name) != NULL;
+}
+
+/**
+ * sc_sched_exec - обработчик успешного exec
+ * @p: задача, выполнившая exec (текущая)
+ * @old_pid: идентификатор задачи до exec
+ * @bprm: параметры запуска исполняемого файла
+ *
+ * Подписан на tracepoint `raw_tp/sched_process_exec`. Добавляет процесс
+ * в pid_filter, если запущенный файл есть в exec_filter (filter_exec).
+ * Поток, выполнивший exec не из главного потока, получает идентификатор
+ * главного, поэтому его запись sc_data переносится под новый идентификатор:
+ * иначе sc_exit не найдёт незавершённый execve.
+ * Для отслеживаемых процессов передаёт в evt_buf событие EVT_PROC_EXEC.
+ */
+SEC("raw_tp/sched_process_exec")
+int BPF_PROG(sc_sched_exec, struct task_struct *p, pid_t old_pid, struct linux_binprm *bprm)
+{
+    u64 pid_tgid = bpf_get_current_pid_tgid();
+    u32 tid = pid_tgid;
+
+    if (filter_exec && sc_exec_match(bprm)) {
+        u32 tgid = pid_tgid >> 32;
+        u8 one = 1;
+        bpf_map_update_elem(&pid_filter, &tgid, &one, BPF_ANY);
+    }
+
+    u32 old_tid = old_pid;
+    if (old_tid != tid) {
+        struct cdata *info = bpf_map_lookup_elem(&sc_data, &old_tid);
+        if (info) {
+            bpf_map_update_elem(&sc_data, &tid, info, BPF_ANY);
+            bpf_map_delete_elem(&sc_data, &old_tid);
+        }
+    }
+
+    if (!sc_traced())
+        return 0;
+
+    struct cdata *event = task_event_start(EVT_PROC_EXEC);
+    if (!event)
+        return 0;
+
+    event->sc_arg1 = old_tid;
+    event->sc_arg2 = BPF_CORE_READ(p, real_parent, tgid);
+    bpf_probe_read_kernel_str(event->data, SC_STR_SIZE, BPF_CORE_READ(bprm, filename));
+
+    bpf_ringbuf_submit(event, 0);
+
+    return 0;
+}
+
+/**
+ * sc_sched_fork - обработчик создания процесса или потока
+ * @parent: родительская задача (текущая)
+ * @child: созданная задача
+ *
+ * Подписан на tracepoint `raw_tp/sched_process_fork`. Процессы, порождённые
+ * исключёнными из трассировки, тоже исключаются. Для отслеживаемых процессов
+ * передаёт в evt_buf событие EVT_PROC_FORK от имени родителя.
+ */
+SEC("raw_tp/sched_process_fork")
+int BPF_PROG(sc_sched_fork, struct task_struct *parent, struct task_struct *child)
+{
+    u32 ctgid = BPF_CORE_READ(child, tgid);
+
+    if (exclude_pids) {
+        u32 ptgid = BPF_CORE_READ(parent, tgid);
+        if (bpf_map_lookup_elem(&pid_exclude, &ptgid)) {
+            u8 one = 1;
+            bpf_map_update_elem(&pid_exclude, &ctgid, &one, BPF_ANY);
+
+            return 0;
+        }
+    }
+
+    if (!sc_traced())
+        return 0;
+
+    struct cdata *event = task_event_start(EVT_PROC_FORK);
+    if (!event)
+        return 0;
+
+    event->sc_arg1 = ctgid;
+    event->sc_arg2 = BPF_CORE_READ(child, pid);
+
+    bpf_ringbuf_submit(event, 0);
+
+    return 0;
+}
+
+/**
+ * sc_submit_noreturn - передать системный вызов, из которого поток не вернулся
+ * @info: запись о системном вызове из sc_data
+ *
+ * Возвращаемое значение неизвестно; память процесса уже освобождена,
+ * поэтому пользовательский стек не захватывается.
+ */
+static __always_inline void sc_submit_noreturn(struct cdata *info) {
+    struct cdata *event = bpf_ringbuf_reserve(&evt_buf, sizeof(*event), 0);
+    if (!event)
+        return;
+
+    info->flags |= SC_F_NORETURN;
+    info->duration = bpf_ktime_get_ns() - info->hdr.ts;
+    info->user_stack_id = -1;
+    if (!capture_kstacks)
+        info->kernel_stack_id = -1;
+
+    sc_copy(event, info);
+    bpf_ringbuf_submit(event, 0);
+}
+
+/**
+ * sc_sched_exit - обработчик завершения задачи
+ * @p: завершающаяся задача (текущая)
+ *
+ * Подписан на tracepoint `raw_tp/sched_process_exit`. Системный вызов, из
+ * которого поток не вернулся (exit, exit_group или вызов, прерванный
+ * завершением процесса), не дойдёт до sc_exit: его запись sc_data передаётся
+ * в evt_buf с признаком SC_F_NORETURN, если возвращаемое значение не нужно
+ * фильтрам, и удаляется.
+ * Когда завершается последний поток процесса, передаёт событие EVT_PROC_EXIT
+ * с кодом завершения в формате status wait(2) и удаляет процесс из pid_filter
+ * и pid_exclude: его идентификатор может достаться другому процессу.
+ */
+SEC("raw_tp/sched_process_exit")
+int BPF_PROG(sc_sched_exit, struct task_struct *p)
+{
+    u32 tid = bpf_get_current_pid_tgid();
+
+    struct cdata *info = bpf_map_lookup_elem(&sc_data, &tid);
+    if (info) {
+        if (filter_ret == 0 && !filter_errno && (!filter_path || (info->flags & SC_F_PATH_MATCH)))
+            sc_submit_noreturn(info);
+
+        bpf_map_delete_elem(&sc_data, &tid);
+    }
+
+    bpf_map_delete_elem(&sc_interrupted, &tid);
+
+    // signal->live уменьшается до вызова tracepoint: 0 у последнего потока процесса
+    if (BPF_CORE_READ(p, signal, live.counter) != 0)
+        return 0;
+
+    u32 tgid = bpf_get_current_pid_tgid() >> 32;
+    bool traced = sc_traced();
+
+    if (filter_pids)
+        bpf_map_delete_elem(&pid_filter, &tgid);
+    if (exclude_pids)
+        bpf_map_delete_elem(&pid_exclude, &tgid);
+
+    if (!traced)
+        return 0;
+
+    struct cdata *event = task_event_start(EVT_PROC_EXIT);
+    if (!event)
+        return 0;
+
+    event->sc_arg1 = BPF_CORE_READ(p, exit_code);
+    event->sc_arg2 = BPF_CORE_READ(p, real_parent, tgid);
+
+    bpf_ringbuf_submit(event, 0);
+
+    return 0;
+}
+
+// Специальные значения info в send_signal: siginfo не передан
+#define SEND_SIG_NOINFO 0
+#define SEND_SIG_PRIV   1
+
+// Коды siginfo для SEND_SIG_NOINFO и SEND_SIG_PRIV
+#define SI_USER   0
+#define SI_KERNEL 0x80
+
+/**
+ * sig_read_info - скопировать siginfo в область данных события
+ * @event: запись о сигнале
+ * @sig: номер сигнала
+ * @info: siginfo ядра, SEND_SIG_NOINFO или SEND_SIG_PRIV
+ *
+ * Для сигналов без siginfo заполняет si_signo и si_code, как tracepoint signal_generate.
+ */
+static __always_inline void sig_read_info(struct cdata *event, int sig, struct kernel_siginfo *info) {
+    __builtin_memset(event->data, 0, sizeof(struct kernel_siginfo));
+
+    if ((unsigned long)info == SEND_SIG_NOINFO || (unsigned long)info == SEND_SIG_PRIV) {
+        struct kernel_siginfo *si = (struct kernel_siginfo *)event->data;
+
+        si->si_signo = sig;
+        si->si_code  = (unsigned long)info == SEND_SIG_NOINFO ? SI_USER : SI_KERNEL;
+
+        return;
+    }
+
+    bpf_probe_read_kernel(event->data, sizeof(struct kernel_siginfo), info);
+}
+
+/**
+ * sig_interrupted - определить системный вызов, прерванный доставляемым сигналом
+ * @event: запись о доставке сигнала
+ *
+ * Сигнал доставляется на выходе в пользовательское пространство, после sys_exit,
+ * где sc_exit запоминает прерванный системный вызов в sc_interrupted. Если
+ * сигнал доставлен не на выходе из системного вызова или вызов не прерван,
+ * sc_arg2 равен -1.
+ */
+static __always_inline void sig_interrupted(struct cdata *event) {
+    u32 tid = event->hdr.tid;
+
+    event->sc_arg2 = -1;
+
+    struct sc_interrupt *intr = bpf_map_lookup_elem(&sc_interrupted, &tid);
+    if (!intr)
+        return;
+
+    event->sc_arg2 = intr->nr;
+    event->syscall_ret = intr->ret;
+
+    // после обработчика прерванный вызов перезапускается или завершается: сигнал к нему больше не относится
+    bpf_map_delete_elem(&sc_interrupted, &tid);
+}
+
+/**
+ * sc_signal_generate - обработчик отправки сигнала
+ * @sig: номер сигнала
+ * @info: siginfo сигнала
+ * @task: задача-получатель
+ * @group: сигнал отправлен всему процессу
+ * @result: результат отправки (enum trace_signal_result: доставлен, проигнорирован и т.д.)
+ *
+ * Подписан на tracepoint `raw_tp/signal_generate`, который вызывается в контексте
+ * отправителя. Передаёт событие EVT_SIG_GENERATE, если отслеживается получатель:
+ * kill от другого процесса, ошибки доступа к памяти, завершение потомка (SIGCHLD).
+ * Заголовок события описывает получателя, а отправитель передаётся в sc_arg2,
+ * sc_arg3 и в области данных после siginfo.
+ */
+SEC("raw_tp/signal_generate")
+int BPF_PROG(sc_signal_generate, int sig, struct kernel_siginfo *info, struct task_struct *task, int group, int result)
+{
+    if (!sc_task_traced(task))
+        return 0;
+
+    struct cdata *event = task_event_start(EVT_SIG_GENERATE);
+    if (!event)
+        return 0;
+
+    event->sc_arg1 = sig;
+    event->sc_arg2 = event->hdr.pid;
+    event->sc_arg3 = event->hdr.tid;
+    event->sc_arg4 = group;
+    event->sc_arg5 = result;
+    sig_read_info(event, sig, info);
+    __builtin_memcpy(event->data + sizeof(struct kernel_siginfo), event->hdr.comm, TASK_COMM_LEN);
+
+    event->hdr.pid = BPF_CORE_READ(task, tgid);
+    event->hdr.tid = BPF_CORE_READ(task, pid);
+    BPF_CORE_READ_STR_INTO(&event->hdr.comm, task, comm);
+    fill_task_ns_ids(&event->hdr, task);
+    event->hdr.uid       = BPF_CORE_READ(task, cred, uid.val);
+    event->hdr.cgroup_id = BPF_CORE_READ(task, cgroups, dfl_cgrp, kn, id);
+
+    bpf_ringbuf_submit(event, 0);
+
+    return 0;
+}
+
+/**
+ * sc_signal_deliver - обработчик доставки сигнала
+ * @sig: номер сигнала
+ * @info: siginfo сигнала
+ * @ka: действие для сигнала
+ *
+ * Подписан на tracepoint `raw_tp/signal_deliver`, который вызывается в контексте
+ * получателя перед запуском обработчика или действием по умолчанию. Передаёт
+ * событие EVT_SIG_DELIVER для отслеживаемых задач; sc_arg3 - адрес обработчика
+ * (SIG_DFL - 0, SIG_IGN - 1).
+ */
+SEC("raw_tp/signal_deliver")
+int BPF_PROG(sc_signal_deliver, int sig, struct kernel_siginfo *info, struct k_sigaction *ka)
+{
+    if (!sc_traced())
+        return 0;
+
+    struct cdata *event = task_event_start(EVT_SIG_DELIVER);
+    if (!event)
+        return 0;
+
+    event->sc_arg1 = sig;
+    event->sc_arg3 = (u64)BPF_CORE_READ(ka, sa.sa_handler);
+    sig_interrupted(event);
+    sig_read_info(event, sig, info);
+
+    bpf_ringbuf_submit(event, 0);
+
+    return 0;
+}
+
 char LICENSE[] SEC("license") = "GPL";
\ No newline at end of file
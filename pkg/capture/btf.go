@@ -0,0 +1,50 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/cilium/ebpf/btf"
+)
+
+// EventTypeName - имя C-структуры записи кольцевого буфера
+const EventTypeName = "cdata"
+
+// EventBTF извлекает из BTF bpf объекта описание записи кольцевого буфера
+// вместе со всеми типами, на которые она ссылается
+func EventBTF(spec *btf.Spec) ([]byte, error) {
+	var st *btf.Struct
+	if err := spec.TypeByName(EventTypeName, &st); err != nil {
+		return nil, fmt.Errorf("can't find event type %s: %w", EventTypeName, err)
+	}
+
+	b, err := btf.NewBuilder([]btf.Type{st})
+	if err != nil {
+		return nil, fmt.Errorf("error building event btf: %w", err)
+	}
+
+	data, err := b.Marshal(nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding event btf: %w", err)
+	}
+
+	return data, nil
+}
+
+// EventType возвращает описание записи кольцевого буфера из заголовка файла
+func (h *Header) EventType() (*btf.Struct, error) {
+	if len(h.EventBTF) == 0 {
+		return nil, fmt.Errorf("capture has no event btf")
+	}
+
+	spec, err := btf.LoadSpecFromReader(bytes.NewReader(h.EventBTF))
+	if err != nil {
+		return nil, fmt.Errorf("error reading event btf: %w", err)
+	}
+
+	var st *btf.Struct
+	if err := spec.TypeByName(EventTypeName, &st); err != nil {
+		return nil, fmt.Errorf("can't find event type %s: %w", EventTypeName, err)
+	}
+
+	return st, nil
+}
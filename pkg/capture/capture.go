@@ -0,0 +1,191 @@
+// Package capture реализует формат файла записи трассировки (.bst).
+//
+// Файл состоит из сигнатуры, заголовка и последовательности записей кольцевого
+// буфера в исходном бинарном виде:
+//
+//	magic   [8]byte  "BSTRACE\x00"
+//	version uint32   версия формата файла
+//	hdrLen  uint32   длина заголовка
+//	header  [hdrLen]byte  заголовок в JSON (см. Header)
+//	records { len uint32; data [len]byte }...
+//
+// Все числа записываются в little-endian.
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Version - версия формата файла записи
+const Version = 1
+
+var magic = [8]byte{'B', 'S', 'T', 'R', 'A', 'C', 'E', 0}
+
+// maxRecordSize ограничивает размер записи при чтении повреждённых файлов
+const maxRecordSize = 1 << 20
+
+// Header - описание условий, в которых сделана запись
+type Header struct {
+	// KernelRelease - версия ядра (uname -r)
+	KernelRelease string `json:"kernel_release"`
+	// Arch - архитектура в терминах GOARCH
+	Arch string `json:"arch"`
+	// BootTime - момент отсчёта монотонных часов ядра, от которого отсчитываются времена событий
+	BootTime time.Time `json:"boot_time"`
+	// SyscallTableHash - хеш таблицы описаний системных вызовов, по которой собраны парсеры
+	SyscallTableHash string `json:"syscall_table_hash"`
+	// EventBTF - BTF типов записей кольцевого буфера (struct cdata)
+	EventBTF []byte `json:"event_btf,omitempty"`
+	// Created - время начала записи
+	Created time.Time `json:"created"`
+}
+
+// Writer записывает события в файл записи
+type Writer struct {
+	w   *bufio.Writer
+	buf [4]byte
+}
+
+// NewWriter записывает сигнатуру и заголовок файла
+func NewWriter(w io.Writer, hdr *Header) (*Writer, error) {
+	data, err := json.Marshal(hdr)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding capture header: %w", err)
+	}
+
+	cw := &Writer{w: bufio.NewWriter(w)}
+
+	if _, err := cw.w.Write(magic[:]); err != nil {
+		return nil, err
+	}
+
+	if err := cw.writeUint32(Version); err != nil {
+		return nil, err
+	}
+
+	if err := cw.writeBlock(data); err != nil {
+		return nil, err
+	}
+
+	return cw, nil
+}
+
+// WriteRecord записывает сырую запись кольцевого буфера
+func (cw *Writer) WriteRecord(sample []byte) error {
+	return cw.writeBlock(sample)
+}
+
+// Flush сбрасывает буферизованные записи
+func (cw *Writer) Flush() error {
+	return cw.w.Flush()
+}
+
+func (cw *Writer) writeUint32(v uint32) error {
+	binary.LittleEndian.PutUint32(cw.buf[:], v)
+
+	_, err := cw.w.Write(cw.buf[:])
+
+	return err
+}
+
+func (cw *Writer) writeBlock(data []byte) error {
+	if err := cw.writeUint32(uint32(len(data))); err != nil {
+		return err
+	}
+
+	_, err := cw.w.Write(data)
+
+	return err
+}
+
+// Reader читает события из файла записи
+type Reader struct {
+	r      *bufio.Reader
+	header Header
+}
+
+// NewReader проверяет сигнатуру и читает заголовок файла
+func NewReader(r io.Reader) (*Reader, error) {
+	cr := &Reader{r: bufio.NewReader(r)}
+
+	var fileMagic [8]byte
+	if _, err := io.ReadFull(cr.r, fileMagic[:]); err != nil {
+		return nil, fmt.Errorf("error reading capture signature: %w", err)
+	}
+
+	if fileMagic != magic {
+		return nil, errors.New("not a bstrace capture file")
+	}
+
+	version, err := cr.readUint32()
+	if err != nil {
+		return nil, fmt.Errorf("error reading capture version: %w", err)
+	}
+
+	if version != Version {
+		return nil, fmt.Errorf("unsupported capture version %d", version)
+	}
+
+	data, err := cr.readBlock()
+	if err != nil {
+		return nil, fmt.Errorf("error reading capture header: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cr.header); err != nil {
+		return nil, fmt.Errorf("error decoding capture header: %w", err)
+	}
+
+	return cr, nil
+}
+
+// Header возвращает заголовок файла
+func (cr *Reader) Header() *Header {
+	return &cr.header
+}
+
+// ReadRecord возвращает следующую запись или io.EOF в конце файла
+func (cr *Reader) ReadRecord() ([]byte, error) {
+	data, err := cr.readBlock()
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("truncated capture record: %w", err)
+	}
+
+	return data, err
+}
+
+func (cr *Reader) readUint32() (uint32, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(cr.r, buf[:]); err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint32(buf[:]), nil
+}
+
+func (cr *Reader) readBlock() ([]byte, error) {
+	n, err := cr.readUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if n > maxRecordSize {
+		return nil, fmt.Errorf("record size %d exceeds limit %d", n, maxRecordSize)
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(cr.r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,113 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	hdr := &Header{
+		KernelRelease:    "6.1.0-test",
+		Arch:             "amd64",
+		BootTime:         time.Unix(1700000000, 0).UTC(),
+		SyscallTableHash: "abc",
+		Created:          time.Unix(1700000100, 0).UTC(),
+	}
+
+	records := [][]byte{{1, 2, 3}, {}, bytes.Repeat([]byte{0xff}, 632)}
+
+	var buf bytes.Buffer
+
+	cw, err := NewWriter(&buf, hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range records {
+		if err := cw.WriteRecord(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	cr, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := cr.Header()
+	if got.KernelRelease != hdr.KernelRelease || got.Arch != hdr.Arch || !got.BootTime.Equal(hdr.BootTime) || got.SyscallTableHash != hdr.SyscallTableHash {
+		t.Fatalf("header = %+v, want %+v", got, hdr)
+	}
+
+	for i, want := range records {
+		r, err := cr.ReadRecord()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+
+		if !bytes.Equal(r, want) {
+			t.Fatalf("record %d = %v, want %v", i, r, want)
+		}
+	}
+
+	if _, err := cr.ReadRecord(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	// обрезанная последняя запись
+	cr, err = NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range records[:2] {
+		if _, err := cr.ReadRecord(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := cr.ReadRecord(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestNotCapture(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("not a capture file"))); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRing(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	r := NewRing(10*time.Second, 10)
+	for i := range 8 {
+		r.Add(start.Add(time.Duration(i)*time.Second), []byte{byte(i)})
+	}
+
+	// окно 10 секунд: запись 0 вытесняется записью в момент 11 с
+	r.Add(start.Add(11*time.Second), []byte{11})
+
+	if n := r.Len(); n != 8 {
+		t.Fatalf("Len() = %d, want 8", n)
+	}
+
+	// ограничение памяти 10 байт
+	r.Add(start.Add(12*time.Second), []byte{12, 12, 12})
+
+	samples := r.Take()
+	if len(samples) != 8 || r.Len() != 0 {
+		t.Fatalf("took %d records, %d left", len(samples), r.Len())
+	}
+
+	if !bytes.Equal(samples[0], []byte{2}) {
+		t.Fatalf("first record = %v", samples[0])
+	}
+}
@@ -0,0 +1,82 @@
+package capture
+
+import (
+	"sync"
+	"time"
+)
+
+// ringRecord - запись, сохранённая в Ring
+type ringRecord struct {
+	at     time.Time
+	sample []byte
+}
+
+// Ring хранит в памяти записи за последние window и не больше maxBytes байт
+// (режим бортового самописца). Безопасен для одновременного использования.
+type Ring struct {
+	mu       sync.Mutex
+	window   time.Duration
+	maxBytes int
+	records  []ringRecord
+	// head - индекс самой старой записи в records
+	head  int
+	bytes int
+}
+
+// NewRing создаёт Ring с окном window и ограничением памяти maxBytes
+func NewRing(window time.Duration, maxBytes int) *Ring {
+	return &Ring{window: window, maxBytes: maxBytes}
+}
+
+// Add сохраняет копию записи, полученной в момент at, и вытесняет записи,
+// вышедшие за окно или ограничение памяти
+func (r *Ring) Add(at time.Time, sample []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records = append(r.records, ringRecord{at: at, sample: append([]byte(nil), sample...)})
+	r.bytes += len(sample)
+
+	for r.head < len(r.records) {
+		oldest := r.records[r.head]
+		if at.Sub(oldest.at) <= r.window && r.bytes <= r.maxBytes {
+			break
+		}
+
+		r.bytes -= len(oldest.sample)
+		r.records[r.head] = ringRecord{}
+		r.head++
+	}
+
+	// сдвигаем записи в начало, когда вытесненных больше половины
+	if r.head > len(r.records)/2 {
+		n := copy(r.records, r.records[r.head:])
+		clear(r.records[n:])
+		r.records = r.records[:n]
+		r.head = 0
+	}
+}
+
+// Len возвращает число записей в Ring
+func (r *Ring) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.records) - r.head
+}
+
+// Take возвращает сохранённые записи и очищает Ring, чтобы следующий сброс
+// не повторял уже взятые события. Записи можно записывать без блокировки Ring.
+func (r *Ring) Take() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	samples := make([][]byte, 0, len(r.records)-r.head)
+	for _, rec := range r.records[r.head:] {
+		samples = append(samples, rec.sample)
+	}
+
+	r.records, r.head, r.bytes = nil, 0, 0
+
+	return samples
+}
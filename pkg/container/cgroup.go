@@ -0,0 +1,92 @@
+package container
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"io/fs"
+	"path/filepath"
+)
+
+// cgroupRoots - возможные точки монтирования иерархии cgroup v2:
+// единая иерархия и гибридный режим systemd
+var cgroupRoots = []string{"/sys/fs/cgroup", "/sys/fs/cgroup/unified"}
+
+// Root возвращает точку монтирования иерархии cgroup v2 или пустую строку,
+// если cgroup v2 не смонтирована
+func Root() string {
+	for _, root := range cgroupRoots {
+		if isCgroup2(root) {
+			return root
+		}
+	}
+
+	return ""
+}
+
+func isCgroup2(path string) bool {
+	var fs unix.Statfs_t
+
+	return unix.Statfs(path, &fs) == nil && fs.Type == unix.CGROUP2_SUPER_MAGIC
+}
+
+// CgroupID возвращает идентификатор cgroup v2 по пути к её каталогу.
+// Относительные пути отсчитываются от Root(). Идентификатор cgroup совпадает
+// с номером inode её каталога в cgroupfs, его же возвращает bpf_get_current_cgroup_id().
+func CgroupID(path string) (uint64, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(Root(), path)
+	}
+
+	if !isCgroup2(path) {
+		return 0, fmt.Errorf("%s is not a cgroup v2 directory", path)
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, fmt.Errorf("error reading cgroup %s: %w", path, err)
+	}
+
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		return 0, fmt.Errorf("%s is not a cgroup v2 directory", path)
+	}
+
+	return st.Ino, nil
+}
+
+// CgroupTree возвращает идентификаторы cgroup v2 по пути к её каталогу и всех
+// вложенных в неё cgroup
+func CgroupTree(path string) ([]uint64, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(Root(), path)
+	}
+
+	if _, err := CgroupID(path); err != nil {
+		return nil, err
+	}
+
+	var ids []uint64
+
+	err := filepath.WalkDir(path, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		id, err := CgroupID(dir)
+		if err != nil {
+			return err
+		}
+
+		ids = append(ids, id)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading cgroup %s: %w", path, err)
+	}
+
+	return ids, nil
+}
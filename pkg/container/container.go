@@ -0,0 +1,146 @@
+// Package container определяет контейнер и юнит systemd задачи по пути её cgroup.
+package container
+
+import (
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Info - сведения о контейнере, полученные из пути cgroup
+type Info struct {
+	// Cgroup - путь cgroup относительно корня иерархии cgroup v2
+	Cgroup string
+	// ContainerID - полный идентификатор контейнера или пустая строка вне контейнера
+	ContainerID string
+	// Unit - ближайший юнит systemd (service, scope или slice)
+	Unit string
+}
+
+// containerPatterns - имена каталогов cgroup контейнеров:
+//
+//	docker-<id>.scope, cri-containerd-<id>.scope, crio-<id>.scope, libpod-<id>.scope
+//	(драйвер systemd) и <id>, docker/<id>, libpod-<id> (драйвер cgroupfs).
+//
+// crio-conmon-<id>.scope - монитор контейнера cri-o, а не сам контейнер, и не подходит.
+var containerPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(?:docker|cri-containerd|crio|libpod)-([0-9a-f]{64})\.scope$`),
+	regexp.MustCompile(`^(?:libpod-)?([0-9a-f]{64})$`),
+}
+
+// Parse извлекает сведения о контейнере из пути cgroup. Используется самый
+// глубокий подходящий каталог: вложенные cgroup контейнера (например,
+// init.scope внутри контейнера с systemd) относятся к нему же.
+func Parse(cgroup string) Info {
+	info := Info{Cgroup: cgroup}
+
+	for _, name := range strings.Split(cgroup, "/") {
+		for _, re := range containerPatterns {
+			if m := re.FindStringSubmatch(name); m != nil {
+				info.ContainerID = m[1]
+
+				break
+			}
+		}
+
+		if isUnit(name) {
+			info.Unit = name
+		}
+	}
+
+	return info
+}
+
+func isUnit(name string) bool {
+	for _, suffix := range []string{".service", ".scope", ".slice"} {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolver определяет контейнеры по идентификаторам cgroup v2. Соответствие
+// идентификаторов путям строится обходом локальной иерархии cgroup и
+// перестраивается, когда встречается новый идентификатор.
+type Resolver struct {
+	root string
+
+	mu    sync.Mutex
+	paths map[uint64]string
+	infos map[uint64]Info
+}
+
+// NewResolver создаёт Resolver для иерархии cgroup v2 с корнем root
+// (пустая строка - Root())
+func NewResolver(root string) *Resolver {
+	if root == "" {
+		root = Root()
+	}
+
+	return &Resolver{
+		root:  root,
+		paths: make(map[uint64]string),
+		infos: make(map[uint64]Info),
+	}
+}
+
+// Lookup возвращает сведения о контейнере cgroup с идентификатором id.
+// Для cgroup, которых уже нет в иерархии, возвращается false.
+func (r *Resolver) Lookup(id uint64) (Info, bool) {
+	if r == nil || r.root == "" || id == 0 {
+		return Info{}, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if info, ok := r.infos[id]; ok {
+		return info, info.Cgroup != ""
+	}
+
+	path, ok := r.paths[id]
+	if !ok {
+		r.scan()
+
+		path, ok = r.paths[id]
+	}
+
+	// отсутствие запоминается, чтобы не обходить иерархию на каждом событии
+	var info Info
+	if ok {
+		info = Parse(path)
+	}
+
+	r.infos[id] = info
+
+	return info, ok
+}
+
+// scan перестраивает соответствие идентификаторов cgroup путям
+func (r *Resolver) scan() {
+	paths := make(map[uint64]string, len(r.paths))
+
+	filepath.WalkDir(r.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			paths[st.Ino] = "/" + strings.TrimPrefix(strings.TrimPrefix(path, r.root), "/")
+		}
+
+		return nil
+	})
+
+	r.paths = paths
+}
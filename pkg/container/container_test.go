@@ -0,0 +1,65 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const id = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		cgroup string
+		want   Info
+	}{
+		{"/system.slice/docker-" + id + ".scope", Info{ContainerID: id, Unit: "docker-" + id + ".scope"}},
+		{"/docker/" + id, Info{ContainerID: id}},
+		{
+			"/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1234.slice/cri-containerd-" + id + ".scope",
+			Info{ContainerID: id, Unit: "cri-containerd-" + id + ".scope"},
+		},
+		{"/kubepods/besteffort/pod1234/" + id, Info{ContainerID: id}},
+		{"/machine.slice/crio-" + id + ".scope", Info{ContainerID: id, Unit: "crio-" + id + ".scope"}},
+		{"/machine.slice/crio-conmon-" + id + ".scope", Info{Unit: "crio-conmon-" + id + ".scope"}},
+		{"/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + id + ".scope/container", Info{ContainerID: id, Unit: "libpod-" + id + ".scope"}},
+		{"/machine.slice/libpod-" + id + ".scope/init.scope", Info{ContainerID: id, Unit: "init.scope"}},
+		{"/system.slice/nginx.service", Info{Unit: "nginx.service"}},
+		{"/", Info{}},
+	}
+
+	for _, tt := range tests {
+		tt.want.Cgroup = tt.cgroup
+
+		if got := Parse(tt.cgroup); got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.cgroup, got, tt.want)
+		}
+	}
+}
+
+func TestResolver(t *testing.T) {
+	root := t.TempDir()
+
+	r := NewResolver(root)
+
+	dir := filepath.Join(root, "system.slice", "nginx.service")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// каталог создан после создания Resolver: соответствие перестраивается
+	info, ok := r.Lookup(fi.Sys().(*syscall.Stat_t).Ino)
+	if !ok || info.Cgroup != "/system.slice/nginx.service" || info.Unit != "nginx.service" {
+		t.Errorf("Lookup = %+v, %v", info, ok)
+	}
+
+	if _, ok := r.Lookup(1 << 62); ok {
+		t.Error("Lookup of unknown cgroup must fail")
+	}
+}
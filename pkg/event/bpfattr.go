@@ -0,0 +1,39 @@
+package event
+
+import (
+	"encoding/binary"
+)
+
+// BpfAttr - захваченное содержимое union bpf_attr.
+// Интерпретация полей зависит от команды системного вызова bpf.
+type BpfAttr []byte
+
+func newBpfAttr(data []byte) BpfAttr {
+	return BpfAttr(data)
+}
+
+func (a BpfAttr) u32(off int) uint32 {
+	if len(a) < off+4 {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint32(a[off:])
+}
+
+// MapType - тип карты для BPF_MAP_CREATE
+func (a BpfAttr) MapType() uint32 { return a.u32(0) }
+
+// KeySize - размер ключа карты для BPF_MAP_CREATE
+func (a BpfAttr) KeySize() uint32 { return a.u32(4) }
+
+// ValueSize - размер значения карты для BPF_MAP_CREATE
+func (a BpfAttr) ValueSize() uint32 { return a.u32(8) }
+
+// MaxEntries - максимальное число элементов карты для BPF_MAP_CREATE
+func (a BpfAttr) MaxEntries() uint32 { return a.u32(12) }
+
+// ProgType - тип программы для BPF_PROG_LOAD
+func (a BpfAttr) ProgType() uint32 { return a.u32(0) }
+
+// InsnCnt - число инструкций программы для BPF_PROG_LOAD
+func (a BpfAttr) InsnCnt() uint32 { return a.u32(4) }
@@ -0,0 +1,119 @@
+package event
+
+import (
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"strings"
+)
+
+// cloneArgsSize - размер struct clone_args (CLONE_ARGS_SIZE_VER2), за которой
+// парсер clone3 записывает массив set_tid
+const cloneArgsSize = 88
+
+// CloneArgs - аргументы clone3 (struct clone_args), захваченные парсером
+type CloneArgs struct {
+	Flags uint64 `json:"flags"`
+	// Pidfd - адрес, по которому ядро запишет pidfd потомка (CLONE_PIDFD)
+	Pidfd      uint64 `json:"pidfd"`
+	ChildTid   uint64 `json:"child_tid"`
+	ParentTid  uint64 `json:"parent_tid"`
+	ExitSignal uint64 `json:"exit_signal"`
+	Stack      uint64 `json:"stack"`
+	StackSize  uint64 `json:"stack_size"`
+	TLS        uint64 `json:"tls"`
+	// SetTid - адрес массива pid потомка в пространствах имён PID от
+	// вложенного к родительским
+	SetTid     uint64 `json:"set_tid"`
+	SetTidSize uint64 `json:"set_tid_size"`
+	// Tids - захваченное содержимое массива set_tid
+	Tids []int32 `json:"tids,omitempty"`
+	// Cgroup - дескриптор cgroup, в которую помещается потомок (CLONE_INTO_CGROUP)
+	Cgroup uint64 `json:"cgroup"`
+}
+
+// newCloneArgs разбирает struct clone_args и следующий за ней массив set_tid
+// из области данных записи. Поля за пределами data остаются нулевыми.
+func newCloneArgs(data []byte) CloneArgs {
+	le := binary.LittleEndian
+	u64 := func(i int) uint64 {
+		if len(data) < (i+1)*8 {
+			return 0
+		}
+
+		return le.Uint64(data[i*8:])
+	}
+
+	a := CloneArgs{
+		Flags:      u64(0),
+		Pidfd:      u64(1),
+		ChildTid:   u64(2),
+		ParentTid:  u64(3),
+		ExitSignal: u64(4),
+		Stack:      u64(5),
+		StackSize:  u64(6),
+		TLS:        u64(7),
+		SetTid:     u64(8),
+		SetTidSize: u64(9),
+		Cgroup:     u64(10),
+	}
+
+	if a.SetTid != 0 && len(data) > cloneArgsSize {
+		tids := data[cloneArgsSize:]
+		for i := 0; i < int(min(a.SetTidSize, uint64(len(tids)/4))); i++ {
+			a.Tids = append(a.Tids, int32(le.Uint32(tids[i*4:])))
+		}
+	}
+
+	return a
+}
+
+// String форматирует аргументы как strace, пропуская нулевые поля, кроме
+// flags и exit_signal: {flags=CLONE_VM|CLONE_VFORK, exit_signal=SIGCHLD, stack=0x7f1000, stack_size=0x9000}
+func (a CloneArgs) String() string {
+	fields := []string{"flags=" + clone3Flags.Format(a.Flags), "exit_signal=" + formatSignal(a.ExitSignal)}
+
+	add := func(name string, v uint64, value string) {
+		if v != 0 {
+			fields = append(fields, name+"="+value)
+		}
+	}
+
+	add("pidfd", a.Pidfd, formatPtr(a.Pidfd))
+	add("child_tid", a.ChildTid, formatPtr(a.ChildTid))
+	add("parent_tid", a.ParentTid, formatPtr(a.ParentTid))
+	add("stack", a.Stack, formatPtr(a.Stack))
+	add("stack_size", a.StackSize, fmt.Sprintf("%#x", a.StackSize))
+	add("tls", a.TLS, formatPtr(a.TLS))
+	add("set_tid", a.SetTid, formatTids(a.SetTid, a.Tids))
+	add("set_tid_size", a.SetTidSize, formatUint(a.SetTidSize))
+
+	if a.Flags&unix.CLONE_INTO_CGROUP != 0 {
+		fields = append(fields, "cgroup="+formatUint(a.Cgroup))
+	}
+
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// formatSignal форматирует номер сигнала по имени, если оно известно
+func formatSignal(sig uint64) string {
+	if name := unix.SignalName(unix.Signal(sig)); name != "" {
+		return name
+	}
+
+	return formatUint(sig)
+}
+
+// formatTids форматирует захваченный массив set_tid или его адрес, если массив не прочитан
+func formatTids(ptr uint64, tids []int32) string {
+	if len(tids) == 0 {
+		return formatPtr(ptr)
+	}
+
+	strs := make([]string, len(tids))
+	for i, tid := range tids {
+		strs[i] = formatInt(int64(tid))
+	}
+
+	return "[" + strings.Join(strs, ", ") + "]"
+}
@@ -0,0 +1,140 @@
+package event
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"runtime"
+	"time"
+)
+
+// record - раскладка struct cdata из kprog/src/headers/common.h
+type record struct {
+	Nr            uint32
+	Kind          uint32
+	Args          [6]uint64
+	Ts            uint64
+	Pid           uint32
+	Tid           uint32
+	Comm          [16]byte
+	NsPid         uint32
+	NsTid         uint32
+	PidNs         uint32
+	Uid           uint32
+	CgroupID      uint64
+	Ret           int64
+	Duration      uint64
+	OutPtr        uint64
+	OutOff        uint32
+	OutSize       uint32
+	UserStackID   int32
+	KernelStackID int32
+	Flags         uint32
+	_             uint32
+	Data          [sysdesc.DataSize]byte
+}
+
+// Типы записей в кольцевом буфере (enum evt_kind в common.h)
+const (
+	kindSyscall      = 0
+	kindSyscallEnter = 1
+	kindProcExec     = 2
+	kindProcFork     = 3
+	kindProcExit     = 4
+	kindSigGenerate  = 5
+	kindSigDeliver   = 6
+)
+
+// flagNoReturn - поток завершился, не вернувшись из системного вызова (SC_F_NORETURN в common.h)
+const flagNoReturn = 1 << 2
+
+// RecordSize - размер записи о системном вызове в кольцевом буфере
+var RecordSize = binary.Size(record{})
+
+type decodeFunc func(sc Syscall, data []byte) SyscallEvent
+
+// Decoder разбирает записи кольцевого буфера в типизированные события
+type Decoder struct {
+	arch  string
+	table *sysdesc.Table
+}
+
+// NewDecoder создаёт декодер записей, полученных на архитектуре arch (в терминах GOARCH)
+func NewDecoder(arch string, table *sysdesc.Table) *Decoder {
+	return &Decoder{arch: arch, table: table}
+}
+
+var defaultDecoder = NewDecoder(runtime.GOARCH, sysdesc.Default)
+
+// Decode разбирает запись, полученную на текущей архитектуре
+func Decode(sample []byte) (SyscallEvent, error) {
+	return defaultDecoder.Decode(sample)
+}
+
+func (d *Decoder) Decode(sample []byte) (SyscallEvent, error) {
+	if len(sample) < RecordSize {
+		return nil, fmt.Errorf("record size %d is less than expected %d", len(sample), RecordSize)
+	}
+
+	var rec record
+	if err := binary.Read(bytes.NewReader(sample), binary.LittleEndian, &rec); err != nil {
+		return nil, fmt.Errorf("error parsing record: %w", err)
+	}
+
+	hdr := Header{
+		Ts:       rec.Ts,
+		Pid:      rec.Pid,
+		Tid:      rec.Tid,
+		Comm:     cstring(rec.Comm[:]),
+		NsPid:    rec.NsPid,
+		NsTid:    rec.NsTid,
+		PidNs:    rec.PidNs,
+		Uid:      rec.Uid,
+		CgroupID: rec.CgroupID,
+	}
+
+	switch rec.Kind {
+	case kindProcExec, kindProcFork, kindProcExit:
+		return decodeProcess(&rec, hdr), nil
+	case kindSigGenerate, kindSigDeliver:
+		return d.decodeSignal(&rec, hdr), nil
+	}
+
+	sc := Syscall{
+		Entry:         rec.Kind == kindSyscallEnter,
+		NoReturn:      rec.Flags&flagNoReturn != 0,
+		Hdr:           hdr,
+		Nr:            rec.Nr,
+		Args:          rec.Args,
+		RetVal:        rec.Ret,
+		Duration:      time.Duration(rec.Duration),
+		UserStackID:   rec.UserStackID,
+		KernelStackID: rec.KernelStackID,
+	}
+
+	desc, ok := d.table.ByNr(d.arch, rec.Nr)
+	if !ok {
+		return &GenericEvent{Syscall: sc}, nil
+	}
+
+	decode, ok := decoders[desc.Name]
+	if !ok {
+		return &GenericEvent{Syscall: sc, Desc: desc}, nil
+	}
+
+	return decode(sc, rec.Data[:]), nil
+}
+
+// capturedBuf возвращает захваченный буфер длиной n, но не больше размера области
+func capturedBuf(data []byte, off, size int, n int64) []byte {
+	if n <= 0 {
+		return nil
+	}
+
+	if n > int64(size) {
+		n = int64(size)
+	}
+
+	return data[off : off+int(n)]
+}
@@ -0,0 +1,306 @@
+package event
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"golang.org/x/sys/unix"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func encodeRecord(t *testing.T, rec record) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &rec); err != nil {
+		t.Fatalf("error encoding record: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecoderTypedEvents(t *testing.T) {
+	const atFdCwd = 0xffffff9c
+
+	openat := record{
+		Nr:       257,
+		Args:     [6]uint64{atFdCwd, 0x7ffd0000, 0x80000, 0644},
+		Ts:       100,
+		Pid:      10,
+		Tid:      11,
+		Ret:      3,
+		Duration: 1500,
+	}
+	copy(openat.Comm[:], "cat")
+	copy(openat.Data[:], "/etc/passwd\x00")
+
+	bpf := record{Nr: 280, Args: [6]uint64{0, 0x1000, 120}}
+	binary.LittleEndian.PutUint32(bpf.Data[0:], 2)
+	binary.LittleEndian.PutUint32(bpf.Data[4:], 4)
+
+	exec := record{Kind: kindProcExec, Pid: 20, Tid: 20, Args: [6]uint64{21, 1}}
+	copy(exec.Data[:], "/usr/bin/true\x00")
+
+	tests := []struct {
+		name     string
+		arch     string
+		rec      record
+		expected SyscallEvent
+	}{
+		{
+			name: "openat",
+			arch: "amd64",
+			rec:  openat,
+			expected: &OpenatEvent{
+				Syscall: Syscall{
+					Hdr:      Header{Ts: 100, Pid: 10, Tid: 11, Comm: "cat"},
+					Nr:       257,
+					Args:     openat.Args,
+					RetVal:   3,
+					Duration: 1500 * time.Nanosecond,
+				},
+				Dirfd: -100,
+				Path:  "/etc/passwd",
+				Flags: 0x80000,
+				Mode:  0644,
+			},
+		},
+		{
+			name: "bpf on arm64",
+			arch: "arm64",
+			rec:  bpf,
+			expected: &BpfEvent{
+				Syscall: Syscall{Nr: 280, Args: bpf.Args},
+				Cmd:     0,
+				Attr:    BpfAttr(bpf.Data[:120]),
+				Size:    120,
+			},
+		},
+		{
+			name:     "unknown syscall",
+			arch:     "amd64",
+			rec:      record{Nr: 9999},
+			expected: &GenericEvent{Syscall: Syscall{Nr: 9999}},
+		},
+		{
+			name: "exec from non-leader thread",
+			arch: "amd64",
+			rec:  exec,
+			expected: &ProcessEvent{
+				Syscall:  Syscall{Hdr: Header{Pid: 20, Tid: 20}, UserStackID: -1, KernelStackID: -1},
+				Kind:     ProcessExec,
+				Ppid:     1,
+				Filename: "/usr/bin/true",
+				OldTid:   21,
+			},
+		},
+		{
+			name: "exit group syscall",
+			arch: "amd64",
+			rec:  record{Nr: 231, Flags: flagNoReturn, Args: [6]uint64{2}},
+			expected: &GenericEvent{
+				Syscall: Syscall{NoReturn: true, Nr: 231, Args: [6]uint64{2}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := NewDecoder(tt.arch, sysdesc.Default).Decode(encodeRecord(t, tt.rec))
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(ev, tt.expected) {
+				t.Errorf("Unexpected event:\n  got:  %+v\n  want: %+v", ev, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormatArgs(t *testing.T) {
+	ev := &OpenatEvent{
+		Syscall: Syscall{Args: [6]uint64{0xffffff9c, 0x1000}},
+		Dirfd:   -100,
+		Path:    "/etc/passwd",
+		Flags:   0x80000,
+		Mode:    0,
+	}
+
+	expected := []string{"AT_FDCWD", `"/etc/passwd"`, "O_RDONLY|O_CLOEXEC"}
+	if got := ev.FormatArgs(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected args:\n  got:  %q\n  want: %q", got, expected)
+	}
+
+	read := &ReadEvent{
+		Syscall: Syscall{Args: [6]uint64{3, 0x1000, 64}, RetVal: 5},
+		Fd:      3,
+		Buf:     []byte("ab\n\x00\x01"),
+		Count:   64,
+	}
+
+	expected = []string{"3", `"ab\n\0\1"`, "64"}
+	if got := read.FormatArgs(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected args:\n  got:  %q\n  want: %q", got, expected)
+	}
+}
+
+func TestDecoderShortRecord(t *testing.T) {
+	if _, err := Decode(make([]byte, RecordSize-1)); err == nil {
+		t.Error("expected error for short record")
+	}
+}
+
+func TestDecoderSignal(t *testing.T) {
+	rec := record{Kind: kindSigDeliver, Pid: 30, Tid: 31, Args: [6]uint64{17, 0, 1}, Ret: -512}
+
+	binary.LittleEndian.PutUint32(rec.Data[0:], 17) // si_signo
+	binary.LittleEndian.PutUint32(rec.Data[8:], 1)  // si_code = CLD_EXITED
+	binary.LittleEndian.PutUint32(rec.Data[16:], 32)
+	binary.LittleEndian.PutUint32(rec.Data[20:], 1000)
+	binary.LittleEndian.PutUint32(rec.Data[24:], 3)
+
+	ev, err := NewDecoder("amd64", sysdesc.Default).Decode(encodeRecord(t, rec))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	sig, ok := ev.(*SignalEvent)
+	if !ok {
+		t.Fatalf("Unexpected event type %T", ev)
+	}
+
+	expected := "{si_signo=SIGCHLD, si_code=CLD_EXITED, si_pid=32, si_uid=1000, si_status=3, si_utime=0, si_stime=0}"
+	if got := FormatSiginfo(sig.Info); got != expected {
+		t.Errorf("Unexpected siginfo:\n  got:  %s\n  want: %s", got, expected)
+	}
+
+	if want := (&Interrupted{Name: "read", Nr: 0, Ret: -512}); !reflect.DeepEqual(sig.Interrupted, want) {
+		t.Errorf("Unexpected interrupted syscall: got %+v, want %+v", sig.Interrupted, want)
+	}
+}
+
+func TestDecoderSignalGenerate(t *testing.T) {
+	// заголовок описывает получателя, отправитель - в аргументах и после siginfo
+	rec := record{Kind: kindSigGenerate, Pid: 40, Tid: 41, Args: [6]uint64{15, 30, 31, 1, 0}}
+	copy(rec.Comm[:], "worker")
+
+	binary.LittleEndian.PutUint32(rec.Data[0:], 15) // si_signo
+	copy(rec.Data[siginfoSize:], "kill\x00")
+
+	ev, err := NewDecoder("amd64", sysdesc.Default).Decode(encodeRecord(t, rec))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	sig, ok := ev.(*SignalEvent)
+	if !ok {
+		t.Fatalf("Unexpected event type %T", ev)
+	}
+
+	if sig.Kind != SignalGenerate || sig.Hdr.Pid != 40 || sig.Hdr.Comm != "worker" {
+		t.Errorf("Unexpected target: kind=%v hdr=%+v", sig.Kind, sig.Hdr)
+	}
+
+	if sig.SenderPid != 30 || sig.SenderTid != 31 || sig.SenderComm != "kill" || !sig.Group {
+		t.Errorf("Unexpected sender: pid=%d tid=%d comm=%q group=%v", sig.SenderPid, sig.SenderTid, sig.SenderComm, sig.Group)
+	}
+}
+
+func TestStrArray(t *testing.T) {
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data[0:], 3) // count
+	binary.LittleEndian.PutUint32(data[4:], 2) // captured
+	binary.LittleEndian.PutUint32(data[8:], 2) // truncated: строка 1
+	copy(data[16:], "ls\x00--colo\x00")
+
+	a := newStrArray(data)
+
+	expected := StrArray{Count: 3, Strs: []string{"ls", "--colo"}, Truncated: []int{1}}
+	if !reflect.DeepEqual(a, expected) {
+		t.Fatalf("Unexpected array:\n  got:  %+v\n  want: %+v", a, expected)
+	}
+
+	if got, want := formatStrArray(0x1000, a), `["ls", "--colo"..., ...]`; got != want {
+		t.Errorf("Unexpected format: got %s, want %s", got, want)
+	}
+
+	if got, want := formatStrArray(0x1000, StrArray{Count: 25}), "0x1000 /* 25 vars */"; got != want {
+		t.Errorf("Unexpected format: got %s, want %s", got, want)
+	}
+}
+
+func TestDecoderNamespaceEvents(t *testing.T) {
+	clone3 := record{Nr: 435, Args: [6]uint64{0x1000, 88}}
+	le := binary.LittleEndian
+	le.PutUint64(clone3.Data[0:], unix.CLONE_NEWPID|unix.CLONE_NEWNET|unix.CLONE_PIDFD|unix.CLONE_INTO_CGROUP)
+	le.PutUint64(clone3.Data[8:], 0x2000)
+	le.PutUint64(clone3.Data[32:], uint64(unix.SIGCHLD))
+	le.PutUint64(clone3.Data[64:], 0x3000)
+	le.PutUint64(clone3.Data[72:], 2)
+	le.PutUint64(clone3.Data[80:], 7)
+	le.PutUint32(clone3.Data[88:], 1)
+	le.PutUint32(clone3.Data[92:], 1234)
+
+	ev, err := NewDecoder("amd64", sysdesc.Default).Decode(encodeRecord(t, clone3))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	expected := []string{
+		"{flags=CLONE_PIDFD|CLONE_NEWPID|CLONE_NEWNET|CLONE_INTO_CGROUP, exit_signal=SIGCHLD, pidfd=0x2000, " +
+			"set_tid=[1, 1234], set_tid_size=2, cgroup=7}",
+		"88",
+	}
+	if got := ev.FormatArgs(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected clone3 args:\n  got:  %q\n  want: %q", got, expected)
+	}
+
+	setns := record{Nr: 308, Args: [6]uint64{3, unix.CLONE_NEWNET}}
+	le.PutUint32(setns.Data[0:], unix.CLONE_NEWNET)
+	le.PutUint32(setns.Data[4:], 4026531840)
+
+	ev, err = NewDecoder("amd64", sysdesc.Default).Decode(encodeRecord(t, setns))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	expected = []string{"3<net:[4026531840]>", "CLONE_NEWNET"}
+	if got := ev.FormatArgs(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected setns args:\n  got:  %q\n  want: %q", got, expected)
+	}
+
+	if got := ev.DecodedArgs()[2]; got != (Arg{"fd_ns", "net:[4026531840]"}) {
+		t.Errorf("Unexpected namespace arg: %+v", got)
+	}
+
+	if got, want := cloneFlags.Format(unix.CLONE_VM|unix.CLONE_VFORK|uint64(unix.SIGCHLD)), "SIGCHLD|CLONE_VM|CLONE_VFORK"; got != want {
+		t.Errorf("Unexpected clone flags: got %s, want %s", got, want)
+	}
+}
+
+func TestCloneArgsShortData(t *testing.T) {
+	data := make([]byte, 16)
+	binary.LittleEndian.PutUint64(data[0:], unix.CLONE_NEWNET)
+	binary.LittleEndian.PutUint64(data[8:], 0x2000)
+
+	// обрезанные данные не должны приводить к панике: недостающие поля нулевые
+	expected := CloneArgs{Flags: unix.CLONE_NEWNET, Pidfd: 0x2000}
+	if got := newCloneArgs(data); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected clone args:\n  got:  %+v\n  want: %+v", got, expected)
+	}
+
+	data = make([]byte, cloneArgsSize)
+	binary.LittleEndian.PutUint64(data[64:], 0x3000) // set_tid без массива
+	binary.LittleEndian.PutUint64(data[72:], 2)
+
+	if got := newCloneArgs(data); got.Tids != nil {
+		t.Errorf("Unexpected set_tid array: %v", got.Tids)
+	}
+
+	if got := newNsFd(3, data[:4]); got != (NsFd{Fd: 3}) {
+		t.Errorf("Unexpected namespace fd: %+v", got)
+	}
+}
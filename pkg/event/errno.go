@@ -0,0 +1,101 @@
+package event
+
+import (
+	"golang.org/x/sys/unix"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxErrno - системные вызовы возвращают ошибку как значение в диапазоне [-4095, -1]
+const maxErrno = 4095
+
+// Внутренние коды ошибок ядра, которые не должны попадать в пользовательское
+// пространство, но видны при трассировке прерванных сигналом системных вызовов
+const (
+	ERESTARTSYS           unix.Errno = 512
+	ERESTARTNOINTR        unix.Errno = 513
+	ERESTARTNOHAND        unix.Errno = 514
+	ENOIOCTLCMD           unix.Errno = 515
+	ERESTART_RESTARTBLOCK unix.Errno = 516
+)
+
+var kernelErrnos = map[unix.Errno][2]string{
+	ERESTARTSYS:           {"ERESTARTSYS", "To be restarted if SA_RESTART is set"},
+	ERESTARTNOINTR:        {"ERESTARTNOINTR", "To be restarted"},
+	ERESTARTNOHAND:        {"ERESTARTNOHAND", "To be restarted if no handler"},
+	ENOIOCTLCMD:           {"ENOIOCTLCMD", "No ioctl command"},
+	ERESTART_RESTARTBLOCK: {"ERESTART_RESTARTBLOCK", "Interrupted by signal"},
+}
+
+// Errno возвращает код ошибки, если возвращаемое значение системного вызова является ошибкой
+func Errno(ret int64) (unix.Errno, bool) {
+	if ret < 0 && ret >= -maxErrno {
+		return unix.Errno(-ret), true
+	}
+
+	return 0, false
+}
+
+// IsKernelErrno сообщает, является ли код внутренним кодом ядра (ERESTARTSYS и т.п.)
+func IsKernelErrno(errno unix.Errno) bool {
+	_, ok := kernelErrnos[errno]
+
+	return ok
+}
+
+// ErrnoName возвращает символьное имя кода ошибки, например ENOENT
+func ErrnoName(errno unix.Errno) string {
+	if e, ok := kernelErrnos[errno]; ok {
+		return e[0]
+	}
+
+	if name := unix.ErrnoName(errno); name != "" {
+		return name
+	}
+
+	return "E" + formatUint(uint64(errno))
+}
+
+// ErrnoMessage возвращает описание кода ошибки в том виде, в котором его выводит strerror
+func ErrnoMessage(errno unix.Errno) string {
+	if e, ok := kernelErrnos[errno]; ok {
+		return e[1]
+	}
+
+	msg := errno.Error()
+	if unix.ErrnoName(errno) == "" || msg == "" {
+		return "Unknown error " + formatUint(uint64(errno))
+	}
+
+	return strings.ToUpper(msg[:1]) + msg[1:]
+}
+
+// errnoByName - коды ошибок по символьным именам, строится при первом обращении
+var errnoByName = sync.OnceValue(func() map[string]unix.Errno {
+	names := make(map[string]unix.Errno)
+
+	for errno := unix.Errno(1); errno <= maxErrno; errno++ {
+		if name := unix.ErrnoName(errno); name != "" {
+			names[name] = errno
+		}
+	}
+
+	for errno, e := range kernelErrnos {
+		names[e[0]] = errno
+	}
+
+	return names
+})
+
+// ParseErrno возвращает код ошибки по символьному имени (ENOENT, ERESTARTSYS)
+// или по числу
+func ParseErrno(name string) (unix.Errno, bool) {
+	if n, err := strconv.ParseUint(name, 10, 32); err == nil && n > 0 && n <= maxErrno {
+		return unix.Errno(n), true
+	}
+
+	errno, ok := errnoByName()[strings.ToUpper(name)]
+
+	return errno, ok
+}
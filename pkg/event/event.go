@@ -0,0 +1,161 @@
+package event
+
+//go:generate go run ../../cmd/scgen -out zz_generated_events.go -bpf-dir ../../kprog/src/parser
+
+import (
+	"fmt"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"time"
+)
+
+// SyscallEvent - событие завершённого системного вызова
+type SyscallEvent interface {
+	Name() string
+	Header() Header
+	Ret() int64
+	// FormatArgs возвращает аргументы системного вызова в формате strace
+	FormatArgs() []string
+	// EnterArgs возвращает число аргументов, значения которых известны на входе в системный вызов
+	EnterArgs() int
+	// DecodedArgs возвращает именованные значения аргументов системного вызова
+	DecodedArgs() []Arg
+	// Raw возвращает общие для всех системных вызовов данные события
+	Raw() *Syscall
+}
+
+// IsSyscall сообщает, что событие описывает системный вызов, а не процесс
+// (ProcessEvent) или сигнал (SignalEvent)
+func IsSyscall(ev SyscallEvent) bool {
+	switch ev.(type) {
+	case *ProcessEvent, *SignalEvent:
+		return false
+	default:
+		return true
+	}
+}
+
+// RetPtr сообщает, что системный вызов события возвращает адрес (mmap, brk)
+func RetPtr(ev SyscallEvent) bool {
+	g, ok := ev.(*GenericEvent)
+
+	return ok && g.Desc != nil && g.Desc.RetPtr
+}
+
+// Syscall - общие данные события системного вызова.
+// Встраивается в типизированные события каждого системного вызова.
+type Syscall struct {
+	// Entry - событие входа в системный вызов: возвращаемое значение, длительность
+	// и выходные аргументы ещё неизвестны
+	Entry bool
+	// NoReturn - поток завершился, не вернувшись из системного вызова (exit_group):
+	// возвращаемое значение и выходные аргументы неизвестны
+	NoReturn bool
+	Hdr      Header
+	Nr       uint32
+	Args     [6]uint64
+	RetVal   int64
+	Duration time.Duration
+	// UserStackID - идентификатор стека пользовательского пространства в карте stacks,
+	// отрицательный, если стек не захвачен
+	UserStackID int32
+	// KernelStackID - идентификатор стека ядра в карте stacks: где системный вызов
+	// ждал или, если не засыпал, откуда завершился; отрицательный, если стек не захвачен
+	KernelStackID int32
+}
+
+func (s *Syscall) Header() Header {
+	return s.Hdr
+}
+
+func (s *Syscall) Ret() int64 {
+	return s.RetVal
+}
+
+func (s *Syscall) Raw() *Syscall {
+	return s
+}
+
+// Arg - именованное значение аргумента системного вызова
+type Arg struct {
+	Name  string
+	Value any
+}
+
+// GenericEvent - событие системного вызова, для которого нет парсера.
+// Если системный вызов известен (например, по BTF ядра), Desc содержит его описание.
+type GenericEvent struct {
+	Syscall
+	Desc *sysdesc.Syscall
+}
+
+func (e *GenericEvent) Name() string {
+	if e.Desc != nil {
+		return e.Desc.Name
+	}
+
+	return fmt.Sprintf("syscall_%d", e.Nr)
+}
+
+func (e *GenericEvent) EnterArgs() int {
+	return len(e.FormatArgs())
+}
+
+func (e *GenericEvent) FormatArgs() []string {
+	if e.Desc == nil || e.Desc.Untyped {
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = fmt.Sprintf("%#x", arg)
+		}
+
+		return args
+	}
+
+	args := make([]string, len(e.Desc.Args))
+	for i, arg := range e.Desc.Args {
+		args[i] = formatRaw(arg.Kind, e.Args[i])
+	}
+
+	return args
+}
+
+func (e *GenericEvent) DecodedArgs() []Arg {
+	if e.Desc == nil || e.Desc.Untyped {
+		return nil
+	}
+
+	args := make([]Arg, len(e.Desc.Args))
+	for i, arg := range e.Desc.Args {
+		args[i] = Arg{Name: arg.Name, Value: rawValue(arg.Kind, e.Args[i])}
+	}
+
+	return args
+}
+
+func rawValue(kind sysdesc.ArgKind, v uint64) any {
+	switch kind {
+	case sysdesc.KindInt:
+		return int64(v)
+	case sysdesc.KindFd:
+		return int32(v)
+	default:
+		return v
+	}
+}
+
+// formatRaw форматирует значение аргумента, содержимое которого не захвачено парсером
+func formatRaw(kind sysdesc.ArgKind, v uint64) string {
+	switch kind {
+	case sysdesc.KindInt:
+		return formatInt(int64(v))
+	case sysdesc.KindFd:
+		return formatFd(int32(v))
+	case sysdesc.KindMode:
+		return formatMode(uint32(v))
+	case sysdesc.KindUint:
+		return formatUint(v)
+	case sysdesc.KindFlags:
+		return fmt.Sprintf("%#x", v)
+	default:
+		return formatPtr(v)
+	}
+}
@@ -0,0 +1,224 @@
+package event
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type flagValue struct {
+	name string
+	val  uint64
+}
+
+// FlagSet - набор символьных имён битовых флагов аргумента
+type FlagSet struct {
+	// mask - маска поля, значение которого перечисляется в enum (например, O_ACCMODE)
+	mask uint64
+	enum []flagValue
+	bits []flagValue
+}
+
+// Format возвращает символьное представление флагов в формате strace: O_RDONLY|O_CLOEXEC
+func (fs *FlagSet) Format(v uint64) string {
+	var names []string
+
+	if fs.mask != 0 {
+		field := v & fs.mask
+		for _, f := range fs.enum {
+			if f.val == field {
+				names = append(names, f.name)
+				v &^= fs.mask
+
+				break
+			}
+		}
+	}
+
+	for _, f := range fs.bits {
+		if f.val != 0 && v&f.val == f.val {
+			names = append(names, f.name)
+			v &^= f.val
+		}
+	}
+
+	if v != 0 || len(names) == 0 {
+		names = append(names, fmt.Sprintf("%#x", v))
+	}
+
+	return strings.Join(names, "|")
+}
+
+// Parse разбирает символьное представление флагов, полученное от Format
+// (значения DecodedArgs), обратно в число
+func (fs *FlagSet) Parse(s string) (uint64, error) {
+	var v uint64
+
+	for _, name := range strings.Split(s, "|") {
+		n, ok := fs.lookup(name)
+		if !ok {
+			parsed, err := strconv.ParseUint(name, 0, 64)
+			if err != nil {
+				return 0, fmt.Errorf("unknown flag %q", name)
+			}
+
+			n = parsed
+		}
+
+		v |= n
+	}
+
+	return v, nil
+}
+
+func (fs *FlagSet) lookup(name string) (uint64, bool) {
+	for _, f := range slices.Concat(fs.enum, fs.bits) {
+		if f.name == name {
+			return f.val, true
+		}
+	}
+
+	return 0, false
+}
+
+var flagSets = map[string]*FlagSet{
+	"open_flags":    openFlags,
+	"at_flags":      atFlags,
+	"clone_flags":   cloneFlags,
+	"clone3_flags":  clone3Flags,
+	"unshare_flags": unshareFlags,
+	"ns_types":      nsTypes,
+}
+
+// LookupFlagSet ищет набор флагов по имени из описаний системных вызовов
+func LookupFlagSet(name string) (*FlagSet, bool) {
+	fs, ok := flagSets[name]
+
+	return fs, ok
+}
+
+var openFlags = &FlagSet{
+	mask: unix.O_ACCMODE,
+	enum: []flagValue{
+		{"O_RDONLY", unix.O_RDONLY},
+		{"O_WRONLY", unix.O_WRONLY},
+		{"O_RDWR", unix.O_RDWR},
+	},
+	// составные флаги должны идти раньше входящих в них
+	bits: []flagValue{
+		{"O_TMPFILE", unix.O_TMPFILE},
+		{"O_SYNC", unix.O_SYNC},
+		{"O_CREAT", unix.O_CREAT},
+		{"O_EXCL", unix.O_EXCL},
+		{"O_NOCTTY", unix.O_NOCTTY},
+		{"O_TRUNC", unix.O_TRUNC},
+		{"O_APPEND", unix.O_APPEND},
+		{"O_NONBLOCK", unix.O_NONBLOCK},
+		{"O_DSYNC", unix.O_DSYNC},
+		{"O_ASYNC", unix.O_ASYNC},
+		{"O_DIRECT", unix.O_DIRECT},
+		{"O_LARGEFILE", unix.O_LARGEFILE},
+		{"O_DIRECTORY", unix.O_DIRECTORY},
+		{"O_NOFOLLOW", unix.O_NOFOLLOW},
+		{"O_NOATIME", unix.O_NOATIME},
+		{"O_CLOEXEC", unix.O_CLOEXEC},
+		{"O_PATH", unix.O_PATH},
+	},
+}
+
+var atFlags = &FlagSet{
+	bits: []flagValue{
+		{"AT_SYMLINK_NOFOLLOW", unix.AT_SYMLINK_NOFOLLOW},
+		{"AT_EMPTY_PATH", unix.AT_EMPTY_PATH},
+	},
+}
+
+// nsFlags - флаги создания пространств имён, общие для clone, unshare и setns
+var nsFlags = []flagValue{
+	{"CLONE_NEWNS", unix.CLONE_NEWNS},
+	{"CLONE_NEWCGROUP", unix.CLONE_NEWCGROUP},
+	{"CLONE_NEWUTS", unix.CLONE_NEWUTS},
+	{"CLONE_NEWIPC", unix.CLONE_NEWIPC},
+	{"CLONE_NEWUSER", unix.CLONE_NEWUSER},
+	{"CLONE_NEWPID", unix.CLONE_NEWPID},
+	{"CLONE_NEWNET", unix.CLONE_NEWNET},
+}
+
+// cloneBits - флаги clone, кроме пространства имён времени: его бит CLONE_NEWTIME
+// у clone занят сигналом завершения
+var cloneBits = slices.Concat([]flagValue{
+	{"CLONE_VM", unix.CLONE_VM},
+	{"CLONE_FS", unix.CLONE_FS},
+	{"CLONE_FILES", unix.CLONE_FILES},
+	{"CLONE_SIGHAND", unix.CLONE_SIGHAND},
+	{"CLONE_PIDFD", unix.CLONE_PIDFD},
+	{"CLONE_PTRACE", unix.CLONE_PTRACE},
+	{"CLONE_VFORK", unix.CLONE_VFORK},
+	{"CLONE_PARENT", unix.CLONE_PARENT},
+	{"CLONE_THREAD", unix.CLONE_THREAD},
+	{"CLONE_SYSVSEM", unix.CLONE_SYSVSEM},
+	{"CLONE_SETTLS", unix.CLONE_SETTLS},
+	{"CLONE_PARENT_SETTID", unix.CLONE_PARENT_SETTID},
+	{"CLONE_CHILD_CLEARTID", unix.CLONE_CHILD_CLEARTID},
+	{"CLONE_DETACHED", unix.CLONE_DETACHED},
+	{"CLONE_UNTRACED", unix.CLONE_UNTRACED},
+	{"CLONE_CHILD_SETTID", unix.CLONE_CHILD_SETTID},
+	{"CLONE_IO", unix.CLONE_IO},
+}, nsFlags)
+
+// cloneFlags - флаги clone, младший байт которых (CSIGNAL) - сигнал,
+// отправляемый родителю при завершении потомка
+var cloneFlags = &FlagSet{
+	mask: unix.CSIGNAL,
+	enum: signalValues(),
+	bits: cloneBits,
+}
+
+// clone3Flags - флаги struct clone_args: сигнал задаётся отдельным полем exit_signal
+var clone3Flags = &FlagSet{
+	bits: slices.Concat(cloneBits, []flagValue{
+		{"CLONE_NEWTIME", unix.CLONE_NEWTIME},
+		{"CLONE_CLEAR_SIGHAND", unix.CLONE_CLEAR_SIGHAND},
+		{"CLONE_INTO_CGROUP", unix.CLONE_INTO_CGROUP},
+	}),
+}
+
+var unshareFlags = &FlagSet{
+	bits: slices.Concat([]flagValue{
+		{"CLONE_VM", unix.CLONE_VM},
+		{"CLONE_FS", unix.CLONE_FS},
+		{"CLONE_FILES", unix.CLONE_FILES},
+		{"CLONE_SIGHAND", unix.CLONE_SIGHAND},
+		{"CLONE_THREAD", unix.CLONE_THREAD},
+		{"CLONE_SYSVSEM", unix.CLONE_SYSVSEM},
+	}, nsFlags, []flagValue{
+		{"CLONE_NEWTIME", unix.CLONE_NEWTIME},
+	}),
+}
+
+// nsTypes - типы пространств имён setns; у pidfd это сочетание флагов
+var nsTypes = &FlagSet{
+	bits: slices.Concat(nsFlags, []flagValue{
+		{"CLONE_NEWTIME", unix.CLONE_NEWTIME},
+	}),
+}
+
+// signalValues возвращает имена стандартных сигналов для перечисления в флагах
+func signalValues() []flagValue {
+	var values []flagValue
+
+	for sig := unix.Signal(1); sig < 32; sig++ {
+		if name := unix.SignalName(sig); name != "" {
+			values = append(values, flagValue{name, uint64(sig)})
+		}
+	}
+
+	return values
+}
+
+// openFlagsCreate сообщает, создаёт ли open с такими флагами файл (и использует ли mode)
+func openFlagsCreate(flags uint64) bool {
+	return flags&unix.O_CREAT != 0 || flags&unix.O_TMPFILE == unix.O_TMPFILE
+}
@@ -0,0 +1,167 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StrLimit - максимальное число байт буфера, выводимых при форматировании (как strace -s)
+var StrLimit = 32
+
+const atFdCwd = -100
+
+func formatInt(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+func formatUint(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
+
+func formatFd(fd int32) string {
+	if fd == atFdCwd {
+		return "AT_FDCWD"
+	}
+
+	return strconv.FormatInt(int64(fd), 10)
+}
+
+func formatMode(mode uint32) string {
+	return fmt.Sprintf("%#03o", mode)
+}
+
+func formatPtr(ptr uint64) string {
+	if ptr == 0 {
+		return "NULL"
+	}
+
+	return fmt.Sprintf("%#x", ptr)
+}
+
+func formatPath(path string) string {
+	return Quote([]byte(path), len(path), false)
+}
+
+// formatBuf форматирует захваченный буфер, если известна его длина n,
+// иначе (например, при ошибке системного вызова) выводит адрес буфера
+func formatBuf(ptr uint64, data []byte, n int64) string {
+	if n < 0 || (n > 0 && data == nil) {
+		return formatPtr(ptr)
+	}
+
+	limit := min(len(data), StrLimit)
+
+	return Quote(data[:limit], limit, int64(limit) < n)
+}
+
+// Buffer - захваченный буфер в значениях DecodedArgs. В JSON выводится строкой
+// с экранированием как в strace -x: байты, не являющиеся UTF-8, не теряются.
+type Buffer []byte
+
+func (b Buffer) String() string {
+	return string(b)
+}
+
+func (b Buffer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(escapeBuf(b))
+}
+
+// escapeBuf экранирует данные как strace -x, без кавычек: печатаемые символы
+// ASCII выводятся как есть, обратная косая черта и \t, \n, \v, \f, \r - как в C,
+// остальные байты - как \xNN
+func escapeBuf(data []byte) string {
+	var sb strings.Builder
+
+	for _, c := range data {
+		switch c {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\v':
+			sb.WriteString(`\v`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if c >= ' ' && c < 0x7f {
+				sb.WriteByte(c)
+			} else {
+				fmt.Fprintf(&sb, `\x%02x`, c)
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// Quote экранирует данные как строку C в формате strace.
+// Выводится не более limit байт; если truncated, после строки добавляется "...".
+func Quote(data []byte, limit int, truncated bool) string {
+	if len(data) > limit {
+		data, truncated = data[:limit], true
+	}
+
+	var sb strings.Builder
+
+	sb.WriteByte('"')
+
+	for i, c := range data {
+		switch c {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\v':
+			sb.WriteString(`\v`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if c >= ' ' && c < 0x7f {
+				sb.WriteByte(c)
+
+				continue
+			}
+
+			// как и strace, используем короткую восьмеричную запись,
+			// если следующий символ не является цифрой
+			if i+1 < len(data) && data[i+1] >= '0' && data[i+1] <= '7' {
+				fmt.Fprintf(&sb, `\%03o`, c)
+			} else {
+				fmt.Fprintf(&sb, `\%o`, c)
+			}
+		}
+	}
+
+	sb.WriteByte('"')
+
+	if truncated {
+		sb.WriteString("...")
+	}
+
+	return sb.String()
+}
+
+// formatStruct форматирует захваченную структуру, если для неё определено
+// текстовое представление, иначе выводит её адрес
+func formatStruct(ptr uint64, v any) string {
+	if ptr == 0 {
+		return "NULL"
+	}
+
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return formatPtr(ptr)
+}
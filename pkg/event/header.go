@@ -0,0 +1,62 @@
+package event
+
+import (
+	"bytes"
+	"golang.org/x/sys/unix"
+	"time"
+)
+
+// Header - общий заголовок события
+type Header struct {
+	// Ts - время входа в системный вызов по монотонным часам ядра (bpf_ktime_get_ns)
+	Ts   uint64
+	Pid  uint32
+	Tid  uint32
+	Comm string
+	// NsPid и NsTid - идентификаторы процесса и потока в их пространстве имён PID,
+	// например внутри контейнера
+	NsPid uint32
+	NsTid uint32
+	// PidNs - inode пространства имён PID задачи (как у /proc/PID/ns/pid)
+	PidNs uint32
+	// Uid - реальный идентификатор пользователя задачи
+	Uid uint32
+	// CgroupID - идентификатор cgroup v2 задачи (номер inode каталога cgroup)
+	CgroupID uint64
+}
+
+// bootTime - момент отсчёта монотонных часов ядра по настенным часам
+var bootTime = monotonicOrigin()
+
+func monotonicOrigin() time.Time {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return time.Time{}
+	}
+
+	return time.Now().Add(-time.Duration(ts.Nano()))
+}
+
+// SetBootTime задаёт момент отсчёта монотонных часов,
+// например при разборе событий, записанных на другой машине
+func SetBootTime(t time.Time) {
+	bootTime = t
+}
+
+// BootTime возвращает момент отсчёта монотонных часов
+func BootTime() time.Time {
+	return bootTime
+}
+
+// Time возвращает время события по настенным часам
+func (h Header) Time() time.Time {
+	return bootTime.Add(time.Duration(h.Ts))
+}
+
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+
+	return string(b)
+}
@@ -0,0 +1,68 @@
+package event
+
+import (
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"strconv"
+)
+
+// nsNames - имена типов пространств имён, как в ссылках /proc/PID/ns
+var nsNames = map[uint32]string{
+	unix.CLONE_NEWNS:     "mnt",
+	unix.CLONE_NEWCGROUP: "cgroup",
+	unix.CLONE_NEWUTS:    "uts",
+	unix.CLONE_NEWIPC:    "ipc",
+	unix.CLONE_NEWUSER:   "user",
+	unix.CLONE_NEWPID:    "pid",
+	unix.CLONE_NEWNET:    "net",
+	unix.CLONE_NEWTIME:   "time",
+}
+
+// NsFd - файловый дескриптор пространства имён (setns). Тип и inode
+// пространства имён определяются парсером по файлу дескриптора; для
+// дескрипторов не из nsfs (например, pidfd) Type равен 0.
+type NsFd struct {
+	Fd int32 `json:"fd"`
+	// Type - тип пространства имён CLONE_NEW*
+	Type uint32 `json:"type"`
+	// Inum - inode пространства имён
+	Inum uint32 `json:"inode"`
+}
+
+// newNsFd разбирает сведения о пространстве имён дескриптора fd из области
+// данных записи (struct ns_fd в common.h). Если данных меньше struct ns_fd,
+// тип пространства имён неизвестен.
+func newNsFd(fd int32, data []byte) NsFd {
+	if len(data) < 8 {
+		return NsFd{Fd: fd}
+	}
+
+	return NsFd{
+		Fd:   fd,
+		Type: binary.LittleEndian.Uint32(data[0:]),
+		Inum: binary.LittleEndian.Uint32(data[4:]),
+	}
+}
+
+// Namespace возвращает пространство имён в формате ссылок /proc/PID/ns:
+// net:[4026531840]. Если тип неизвестен, возвращается пустая строка.
+func (n NsFd) Namespace() string {
+	name, ok := nsNames[n.Type]
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("%s:[%d]", name, n.Inum)
+}
+
+// String форматирует дескриптор как strace -y: 3<net:[4026531840]>
+func (n NsFd) String() string {
+	fd := strconv.FormatInt(int64(n.Fd), 10)
+
+	if ns := n.Namespace(); ns != "" {
+		return fd + "<" + ns + ">"
+	}
+
+	return fd
+}
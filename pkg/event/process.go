@@ -0,0 +1,142 @@
+package event
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+)
+
+// ProcessKind - тип события жизненного цикла процесса
+type ProcessKind int
+
+const (
+	// ProcessExec - процесс успешно запустил исполняемый файл
+	ProcessExec ProcessKind = iota + 1
+	// ProcessFork - процесс создал процесс или поток
+	ProcessFork
+	// ProcessExit - завершился последний поток процесса
+	ProcessExit
+)
+
+func (k ProcessKind) String() string {
+	switch k {
+	case ProcessExec:
+		return "exec"
+	case ProcessFork:
+		return "fork"
+	case ProcessExit:
+		return "exit"
+	default:
+		return fmt.Sprintf("process_%d", int(k))
+	}
+}
+
+// ProcessEvent - событие жизненного цикла процесса из точек трассировки
+// sched_process_exec, sched_process_fork и sched_process_exit.
+// Реализует SyscallEvent, чтобы проходить через общий конвейер вывода;
+// номер системного вызова, возвращаемое значение и длительность у него нулевые.
+type ProcessEvent struct {
+	Syscall
+	Kind ProcessKind
+	// Ppid - родительский процесс: для fork это сам процесс из заголовка
+	Ppid uint32
+	// Filename - путь запущенного исполняемого файла (exec)
+	Filename string
+	// OldTid - идентификатор потока, выполнившего exec, до exec: отличается
+	// от Hdr.Tid, если exec выполнен не из главного потока
+	OldTid uint32
+	// ChildPid и ChildTid - созданные процесс и поток (fork); для потока
+	// ChildPid совпадает с Hdr.Pid
+	ChildPid uint32
+	ChildTid uint32
+	// Status - код завершения процесса в формате status wait(2) (exit)
+	Status uint32
+}
+
+func decodeProcess(rec *record, hdr Header) *ProcessEvent {
+	ev := &ProcessEvent{
+		Syscall: Syscall{Hdr: hdr, UserStackID: -1, KernelStackID: -1},
+	}
+
+	switch rec.Kind {
+	case kindProcExec:
+		ev.Kind = ProcessExec
+		ev.OldTid = uint32(rec.Args[0])
+		ev.Ppid = uint32(rec.Args[1])
+		ev.Filename = cstring(rec.Data[:])
+	case kindProcFork:
+		ev.Kind = ProcessFork
+		ev.Ppid = hdr.Pid
+		ev.ChildPid = uint32(rec.Args[0])
+		ev.ChildTid = uint32(rec.Args[1])
+	case kindProcExit:
+		ev.Kind = ProcessExit
+		ev.Status = uint32(rec.Args[0])
+		ev.Ppid = uint32(rec.Args[1])
+	}
+
+	return ev
+}
+
+// ExitCode возвращает код завершения процесса; false, если процесс убит сигналом
+func (e *ProcessEvent) ExitCode() (int, bool) {
+	ws := unix.WaitStatus(e.Status)
+
+	return ws.ExitStatus(), ws.Exited()
+}
+
+// Signal возвращает сигнал, убивший процесс; false, если процесс завершился сам
+func (e *ProcessEvent) Signal() (unix.Signal, bool) {
+	ws := unix.WaitStatus(e.Status)
+
+	return ws.Signal(), ws.Signaled()
+}
+
+// CoreDumped сообщает, что при завершении сигналом был создан дамп памяти
+func (e *ProcessEvent) CoreDumped() bool {
+	return unix.WaitStatus(e.Status).CoreDump()
+}
+
+func (e *ProcessEvent) Name() string {
+	return e.Kind.String()
+}
+
+func (e *ProcessEvent) EnterArgs() int {
+	return 0
+}
+
+func (e *ProcessEvent) FormatArgs() []string {
+	args := e.DecodedArgs()
+
+	out := make([]string, len(args))
+	for i, arg := range args {
+		if arg.Name == "filename" {
+			out[i] = formatPath(e.Filename)
+		} else {
+			out[i] = fmt.Sprint(arg.Value)
+		}
+	}
+
+	return out
+}
+
+func (e *ProcessEvent) DecodedArgs() []Arg {
+	switch e.Kind {
+	case ProcessExec:
+		return []Arg{{"filename", e.Filename}, {"ppid", e.Ppid}}
+	case ProcessFork:
+		return []Arg{{"child_pid", e.ChildPid}, {"child_tid", e.ChildTid}}
+	case ProcessExit:
+		args := []Arg{{"ppid", e.Ppid}}
+		if code, ok := e.ExitCode(); ok {
+			args = append(args, Arg{"exit_code", code})
+		}
+
+		if sig, ok := e.Signal(); ok {
+			args = append(args, Arg{"signal", unix.SignalName(sig)}, Arg{"core_dumped", e.CoreDumped()})
+		}
+
+		return args
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,286 @@
+package event
+
+import (
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"strings"
+)
+
+// SignalKind - тип события сигнала
+type SignalKind int
+
+const (
+	// SignalGenerate - отслеживаемой задаче отправлен сигнал
+	SignalGenerate SignalKind = iota + 1
+	// SignalDeliver - отслеживаемой задаче доставлен сигнал
+	SignalDeliver
+)
+
+// SignalResult - результат отправки сигнала (enum trace_signal_result ядра)
+type SignalResult int
+
+func (r SignalResult) String() string {
+	switch r {
+	case 0:
+		return "delivered"
+	case 1:
+		return "ignored"
+	case 2:
+		return "already_pending"
+	case 3:
+		return "overflow_fail"
+	case 4:
+		return "lose_info"
+	default:
+		return fmt.Sprintf("result_%d", int(r))
+	}
+}
+
+// SignalEvent - событие отправки или доставки сигнала из точек трассировки
+// signal_generate и signal_deliver. Как и ProcessEvent, реализует SyscallEvent
+// только для передачи через общий конвейер вывода.
+type SignalEvent struct {
+	Syscall
+	Kind   SignalKind
+	Signal unix.Signal
+	// Info - поля siginfo в порядке вывода strace: si_signo, si_code и
+	// поля, которые имеют смысл для этого si_code
+	Info []Arg
+	// SenderPid, SenderTid и SenderComm - задача, отправившая сигнал
+	// (SignalGenerate); получатель описан заголовком события
+	SenderPid  uint32
+	SenderTid  uint32
+	SenderComm string
+	// Group - сигнал отправлен всему процессу, а не потоку (SignalGenerate)
+	Group  bool
+	Result SignalResult
+	// Handler - адрес обработчика сигнала: 0 - действие по умолчанию, 1 - игнорирование (SignalDeliver)
+	Handler uint64
+	// Interrupted - системный вызов, прерванный сигналом (SignalDeliver), nil если
+	// сигнал доставлен не на выходе из прерванного системного вызова
+	Interrupted *Interrupted
+}
+
+// Interrupted - системный вызов, прерванный сигналом
+type Interrupted struct {
+	Name string
+	Nr   uint32
+	// Ret - результат прерванного вызова: -EINTR или код перезапуска -ERESTART*
+	Ret int64
+}
+
+// Смещения полей struct kernel_siginfo на 64-битных архитектурах
+const (
+	siginfoSize    = 48
+	siginfoFields  = 16
+	siginfoPointer = 24
+)
+
+func (d *Decoder) decodeSignal(rec *record, hdr Header) *SignalEvent {
+	ev := &SignalEvent{
+		Syscall: Syscall{Hdr: hdr, UserStackID: -1, KernelStackID: -1},
+		Signal:  unix.Signal(rec.Args[0]),
+		Info:    decodeSiginfo(rec.Data[:siginfoSize]),
+	}
+
+	switch rec.Kind {
+	case kindSigGenerate:
+		ev.Kind = SignalGenerate
+		ev.SenderPid = uint32(rec.Args[1])
+		ev.SenderTid = uint32(rec.Args[2])
+		ev.SenderComm = cstring(rec.Data[siginfoSize : siginfoSize+len(rec.Comm)])
+		ev.Group = rec.Args[3] != 0
+		ev.Result = SignalResult(int32(rec.Args[4]))
+	case kindSigDeliver:
+		ev.Kind = SignalDeliver
+		ev.Handler = rec.Args[2]
+
+		if nr := int32(rec.Args[1]); nr >= 0 {
+			name := fmt.Sprintf("syscall_%d", nr)
+			if desc, ok := d.table.ByNr(d.arch, uint32(nr)); ok {
+				name = desc.Name
+			}
+
+			ev.Interrupted = &Interrupted{Name: name, Nr: uint32(nr), Ret: rec.Ret}
+		}
+	}
+
+	return ev
+}
+
+// Коды si_code, общие для всех сигналов (include/uapi/asm-generic/siginfo.h)
+var siCodes = map[int32]string{
+	0:    "SI_USER",
+	0x80: "SI_KERNEL",
+	-1:   "SI_QUEUE",
+	-2:   "SI_TIMER",
+	-3:   "SI_MESGQ",
+	-4:   "SI_ASYNCIO",
+	-5:   "SI_SIGIO",
+	-6:   "SI_TKILL",
+	-7:   "SI_DETHREAD",
+	-60:  "SI_ASYNCNL",
+}
+
+// sigCodes - коды si_code, которые ядро выставляет для конкретных сигналов (значения от 1)
+var sigCodes = map[unix.Signal][]string{
+	unix.SIGILL:  {"ILL_ILLOPC", "ILL_ILLOPN", "ILL_ILLADR", "ILL_ILLTRP", "ILL_PRVOPC", "ILL_PRVREG", "ILL_COPROC", "ILL_BADSTK", "ILL_BADIADDR"},
+	unix.SIGFPE:  {"FPE_INTDIV", "FPE_INTOVF", "FPE_FLTDIV", "FPE_FLTOVF", "FPE_FLTUND", "FPE_FLTRES", "FPE_FLTINV", "FPE_FLTSUB", "FPE_FLTUNK", "FPE_CONDTRAP"},
+	unix.SIGSEGV: {"SEGV_MAPERR", "SEGV_ACCERR", "SEGV_BNDERR", "SEGV_PKUERR", "SEGV_ACCADI", "SEGV_ADIDERR", "SEGV_ADIPERR", "SEGV_MTEAERR", "SEGV_MTESERR", "SEGV_CPERR"},
+	unix.SIGBUS:  {"BUS_ADRALN", "BUS_ADRERR", "BUS_OBJERR", "BUS_MCEERR_AR", "BUS_MCEERR_AO"},
+	unix.SIGTRAP: {"TRAP_BRKPT", "TRAP_TRACE", "TRAP_BRANCH", "TRAP_HWBKPT", "TRAP_UNK", "TRAP_PERF"},
+	unix.SIGCHLD: {"CLD_EXITED", "CLD_KILLED", "CLD_DUMPED", "CLD_TRAPPED", "CLD_STOPPED", "CLD_CONTINUED"},
+	unix.SIGIO:   {"POLL_IN", "POLL_OUT", "POLL_MSG", "POLL_ERR", "POLL_PRI", "POLL_HUP"},
+	unix.SIGSYS:  {"SYS_SECCOMP", "SYS_USER_DISPATCH"},
+}
+
+// SigCodeName возвращает символьное имя si_code сигнала sig
+func SigCodeName(sig unix.Signal, code int32) string {
+	if name, ok := siCodes[code]; ok {
+		return name
+	}
+
+	if names := sigCodes[sig]; code > 0 && int(code) <= len(names) {
+		return names[code-1]
+	}
+
+	return fmt.Sprintf("%d", code)
+}
+
+// decodeSiginfo разбирает struct kernel_siginfo в поля, которые имеют смысл
+// для её si_code, как siginfo_layout() в ядре
+func decodeSiginfo(data []byte) []Arg {
+	le := binary.LittleEndian
+
+	i32 := func(off int) int32 { return int32(le.Uint32(data[off:])) }
+	u64 := func(off int) uint64 { return le.Uint64(data[off:]) }
+
+	sig := unix.Signal(i32(0))
+	code := i32(8)
+
+	info := []Arg{
+		{"si_signo", unix.SignalName(sig)},
+		{"si_code", SigCodeName(sig, code)},
+	}
+
+	if errno := i32(4); errno != 0 {
+		info = append(info, Arg{"si_errno", unix.Errno(errno).Error()})
+	}
+
+	sender := []Arg{{"si_pid", i32(siginfoFields)}, {"si_uid", uint32(i32(siginfoFields + 4))}}
+
+	switch {
+	case code == 0x80:
+		// SI_KERNEL: отправитель - ядро, полей нет
+	case code == -2:
+		// SI_TIMER
+		info = append(info,
+			Arg{"si_timerid", i32(siginfoFields)},
+			Arg{"si_overrun", i32(siginfoFields + 4)},
+			Arg{"si_int", i32(siginfoPointer)},
+			Arg{"si_ptr", u64(siginfoPointer)},
+		)
+	case code == 0 || code == -6:
+		// SI_USER, SI_TKILL: kill, tkill
+		info = append(info, sender...)
+	case code < 0:
+		// SI_QUEUE, SI_MESGQ и другие с sigval
+		info = append(info, sender...)
+		info = append(info, Arg{"si_int", i32(siginfoPointer)}, Arg{"si_ptr", u64(siginfoPointer)})
+	default:
+		switch sig {
+		case unix.SIGCHLD:
+			status := any(i32(siginfoPointer))
+			if code == 2 || code == 3 {
+				// CLD_KILLED, CLD_DUMPED: si_status - номер сигнала
+				status = unix.SignalName(unix.Signal(i32(siginfoPointer)))
+			}
+
+			info = append(info, sender...)
+			info = append(info,
+				Arg{"si_status", status},
+				Arg{"si_utime", int64(u64(siginfoPointer + 8))},
+				Arg{"si_stime", int64(u64(siginfoPointer + 16))},
+			)
+		case unix.SIGILL, unix.SIGFPE, unix.SIGSEGV, unix.SIGBUS, unix.SIGTRAP:
+			info = append(info, Arg{"si_addr", u64(siginfoFields)})
+		case unix.SIGIO:
+			info = append(info, Arg{"si_band", int64(u64(siginfoFields))}, Arg{"si_fd", i32(siginfoPointer)})
+		case unix.SIGSYS:
+			info = append(info,
+				Arg{"si_call_addr", u64(siginfoFields)},
+				Arg{"si_syscall", i32(siginfoPointer)},
+				Arg{"si_arch", uint32(i32(siginfoPointer + 4))},
+			)
+		default:
+			info = append(info, sender...)
+		}
+	}
+
+	return info
+}
+
+// FormatSiginfo форматирует поля siginfo как strace: {si_signo=SIGCHLD, si_code=CLD_EXITED, ...}
+func FormatSiginfo(info []Arg) string {
+	fields := make([]string, len(info))
+	for i, f := range info {
+		value := fmt.Sprint(f.Value)
+
+		switch f.Name {
+		case "si_addr", "si_ptr", "si_call_addr":
+			value = formatPtr(f.Value.(uint64))
+		case "si_arch":
+			value = fmt.Sprintf("%#x", f.Value)
+		}
+
+		fields[i] = f.Name + "=" + value
+	}
+
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+func (e *SignalEvent) Name() string {
+	if e.Kind == SignalGenerate {
+		return "signal_generate"
+	}
+
+	return "signal"
+}
+
+func (e *SignalEvent) EnterArgs() int {
+	return 0
+}
+
+func (e *SignalEvent) FormatArgs() []string {
+	args := []string{unix.SignalName(e.Signal), FormatSiginfo(e.Info)}
+
+	if e.Kind == SignalGenerate {
+		args = append(args, fmt.Sprint(e.SenderTid), e.Result.String())
+	}
+
+	return args
+}
+
+func (e *SignalEvent) DecodedArgs() []Arg {
+	args := []Arg{{"signal", unix.SignalName(e.Signal)}}
+
+	switch e.Kind {
+	case SignalGenerate:
+		args = append(args,
+			Arg{"sender_pid", e.SenderPid},
+			Arg{"sender_tid", e.SenderTid},
+			Arg{"sender_comm", e.SenderComm},
+			Arg{"group", e.Group},
+			Arg{"result", e.Result.String()},
+		)
+	case SignalDeliver:
+		args = append(args, Arg{"handler", e.Handler})
+
+		if e.Interrupted != nil {
+			args = append(args, Arg{"interrupted", e.Interrupted.Name})
+		}
+	}
+
+	return args
+}
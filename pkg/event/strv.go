@@ -0,0 +1,82 @@
+package event
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"strings"
+)
+
+// StrArray - массив строк, завершённый NULL (argv, envp), захваченный парсером
+type StrArray struct {
+	// Count - число элементов массива; больше len(Strs), если захвачены не все строки
+	Count int `json:"count"`
+	// Strs - захваченные строки
+	Strs []string `json:"strings"`
+	// Truncated - индексы строк, обрезанных до ограничения длины
+	Truncated []int `json:"truncated,omitempty"`
+}
+
+// newStrArray разбирает массив строк из области данных записи: заголовок
+// struct strv_header из common.h и следующие за ним строки с завершающими нулями
+func newStrArray(data []byte) StrArray {
+	le := binary.LittleEndian
+
+	a := StrArray{Count: int(le.Uint32(data[0:]))}
+	captured := int(le.Uint32(data[4:]))
+	truncated := le.Uint32(data[8:])
+
+	rest := data[sysdesc.StrvHeaderSize:]
+	for i := 0; i < captured && len(rest) > 0; i++ {
+		s := cstring(rest)
+		a.Strs = append(a.Strs, s)
+
+		if i < 32 && truncated&(1<<i) != 0 {
+			a.Truncated = append(a.Truncated, i)
+		}
+
+		rest = rest[min(len(s)+1, len(rest)):]
+	}
+
+	return a
+}
+
+// String возвращает строки через пробел, например командную строку для argv
+func (a StrArray) String() string {
+	return strings.Join(a.Strs, " ")
+}
+
+func (a StrArray) truncated(i int) bool {
+	for _, t := range a.Truncated {
+		if t == i {
+			return true
+		}
+	}
+
+	return false
+}
+
+// formatStrArray форматирует массив строк как strace: ["ls", "-l"...].
+// Если строки не захвачены (например, окружение без --env), выводится адрес
+// и число элементов: 0x7ffd1000 /* 25 vars */
+func formatStrArray(ptr uint64, a StrArray) string {
+	if ptr == 0 {
+		return "NULL"
+	}
+
+	if len(a.Strs) == 0 && a.Count > 0 {
+		return fmt.Sprintf("%s /* %d vars */", formatPtr(ptr), a.Count)
+	}
+
+	strs := make([]string, len(a.Strs))
+	for i, s := range a.Strs {
+		strs[i] = Quote([]byte(s), StrLimit, a.truncated(i))
+	}
+
+	out := "[" + strings.Join(strs, ", ")
+	if a.Count > len(a.Strs) {
+		out += ", ..."
+	}
+
+	return out + "]"
+}
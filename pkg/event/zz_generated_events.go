@@ -0,0 +1,464 @@
+// Code generated by scgen from pkg/sysdesc/syscalls.sc. DO NOT EDIT.
+
+package event
+
+var decoders = map[string]decodeFunc{
+	"read":     decodeRead,
+	"write":    decodeWrite,
+	"close":    decodeClose,
+	"openat":   decodeOpenat,
+	"bpf":      decodeBpf,
+	"execve":   decodeExecve,
+	"execveat": decodeExecveat,
+	"clone":    decodeClone,
+	"clone3":   decodeClone3,
+	"unshare":  decodeUnshare,
+	"setns":    decodeSetns,
+}
+
+// ReadEvent - событие системного вызова read
+type ReadEvent struct {
+	Syscall
+	Fd    int32
+	Buf   []byte
+	Count uint64
+}
+
+func (*ReadEvent) Name() string {
+	return "read"
+}
+
+func (*ReadEvent) EnterArgs() int {
+	return 1
+}
+
+func (e *ReadEvent) FormatArgs() []string {
+	return []string{
+		formatFd(e.Fd),
+		formatBuf(e.Args[1], e.Buf, e.RetVal),
+		formatUint(e.Count),
+	}
+}
+
+func (e *ReadEvent) DecodedArgs() []Arg {
+	return []Arg{
+		{"fd", e.Fd},
+		{"buf", Buffer(e.Buf)},
+		{"count", e.Count},
+	}
+}
+
+func decodeRead(sc Syscall, data []byte) SyscallEvent {
+	return &ReadEvent{
+		Syscall: sc,
+		Fd:      int32(sc.Args[0]),
+		Buf:     capturedBuf(data, 0, 256, sc.RetVal),
+		Count:   sc.Args[2],
+	}
+}
+
+// WriteEvent - событие системного вызова write
+type WriteEvent struct {
+	Syscall
+	Fd    int32
+	Buf   []byte
+	Count uint64
+}
+
+func (*WriteEvent) Name() string {
+	return "write"
+}
+
+func (*WriteEvent) EnterArgs() int {
+	return 3
+}
+
+func (e *WriteEvent) FormatArgs() []string {
+	return []string{
+		formatFd(e.Fd),
+		formatBuf(e.Args[1], e.Buf, int64(e.Args[2])),
+		formatUint(e.Count),
+	}
+}
+
+func (e *WriteEvent) DecodedArgs() []Arg {
+	return []Arg{
+		{"fd", e.Fd},
+		{"buf", Buffer(e.Buf)},
+		{"count", e.Count},
+	}
+}
+
+func decodeWrite(sc Syscall, data []byte) SyscallEvent {
+	return &WriteEvent{
+		Syscall: sc,
+		Fd:      int32(sc.Args[0]),
+		Buf:     capturedBuf(data, 0, 256, int64(sc.Args[2])),
+		Count:   sc.Args[2],
+	}
+}
+
+// CloseEvent - событие системного вызова close
+type CloseEvent struct {
+	Syscall
+	Fd int32
+}
+
+func (*CloseEvent) Name() string {
+	return "close"
+}
+
+func (*CloseEvent) EnterArgs() int {
+	return 1
+}
+
+func (e *CloseEvent) FormatArgs() []string {
+	return []string{
+		formatFd(e.Fd),
+	}
+}
+
+func (e *CloseEvent) DecodedArgs() []Arg {
+	return []Arg{
+		{"fd", e.Fd},
+	}
+}
+
+func decodeClose(sc Syscall, data []byte) SyscallEvent {
+	return &CloseEvent{
+		Syscall: sc,
+		Fd:      int32(sc.Args[0]),
+	}
+}
+
+// OpenatEvent - событие системного вызова openat
+type OpenatEvent struct {
+	Syscall
+	Dirfd int32
+	Path  string
+	Flags uint64
+	Mode  uint32
+}
+
+func (*OpenatEvent) Name() string {
+	return "openat"
+}
+
+func (*OpenatEvent) EnterArgs() int {
+	return 4
+}
+
+func (e *OpenatEvent) FormatArgs() []string {
+	args := []string{
+		formatFd(e.Dirfd),
+		formatPath(e.Path),
+		openFlags.Format(e.Flags),
+		formatMode(e.Mode),
+	}
+
+	// как и strace, выводим mode только при создании файла
+	if !openFlagsCreate(e.Flags) {
+		args = args[:len(args)-1]
+	}
+
+	return args
+}
+
+func (e *OpenatEvent) DecodedArgs() []Arg {
+	return []Arg{
+		{"dirfd", e.Dirfd},
+		{"path", e.Path},
+		{"flags", openFlags.Format(e.Flags)},
+		{"mode", e.Mode},
+	}
+}
+
+func decodeOpenat(sc Syscall, data []byte) SyscallEvent {
+	return &OpenatEvent{
+		Syscall: sc,
+		Dirfd:   int32(sc.Args[0]),
+		Path:    cstring(data[0:256]),
+		Flags:   sc.Args[2],
+		Mode:    uint32(sc.Args[3]),
+	}
+}
+
+// BpfEvent - событие системного вызова bpf
+type BpfEvent struct {
+	Syscall
+	Cmd  int64
+	Attr BpfAttr
+	Size uint64
+}
+
+func (*BpfEvent) Name() string {
+	return "bpf"
+}
+
+func (*BpfEvent) EnterArgs() int {
+	return 3
+}
+
+func (e *BpfEvent) FormatArgs() []string {
+	return []string{
+		formatInt(e.Cmd),
+		formatStruct(e.Args[1], e.Attr),
+		formatUint(e.Size),
+	}
+}
+
+func (e *BpfEvent) DecodedArgs() []Arg {
+	return []Arg{
+		{"cmd", e.Cmd},
+		{"attr", e.Attr},
+		{"size", e.Size},
+	}
+}
+
+func decodeBpf(sc Syscall, data []byte) SyscallEvent {
+	return &BpfEvent{
+		Syscall: sc,
+		Cmd:     int64(sc.Args[0]),
+		Attr:    newBpfAttr(data[0:120]),
+		Size:    sc.Args[2],
+	}
+}
+
+// ExecveEvent - событие системного вызова execve
+type ExecveEvent struct {
+	Syscall
+	Filename string
+	Argv     StrArray
+	Envp     StrArray
+}
+
+func (*ExecveEvent) Name() string {
+	return "execve"
+}
+
+func (*ExecveEvent) EnterArgs() int {
+	return 3
+}
+
+func (e *ExecveEvent) FormatArgs() []string {
+	return []string{
+		formatPath(e.Filename),
+		formatStrArray(e.Args[1], e.Argv),
+		formatStrArray(e.Args[2], e.Envp),
+	}
+}
+
+func (e *ExecveEvent) DecodedArgs() []Arg {
+	return []Arg{
+		{"filename", e.Filename},
+		{"argv", e.Argv},
+		{"envp", e.Envp},
+	}
+}
+
+func decodeExecve(sc Syscall, data []byte) SyscallEvent {
+	return &ExecveEvent{
+		Syscall:  sc,
+		Filename: cstring(data[0:256]),
+		Argv:     newStrArray(data[256:768]),
+		Envp:     newStrArray(data[768:1024]),
+	}
+}
+
+// ExecveatEvent - событие системного вызова execveat
+type ExecveatEvent struct {
+	Syscall
+	Dirfd    int32
+	Filename string
+	Argv     StrArray
+	Envp     StrArray
+	Flags    uint64
+}
+
+func (*ExecveatEvent) Name() string {
+	return "execveat"
+}
+
+func (*ExecveatEvent) EnterArgs() int {
+	return 5
+}
+
+func (e *ExecveatEvent) FormatArgs() []string {
+	return []string{
+		formatFd(e.Dirfd),
+		formatPath(e.Filename),
+		formatStrArray(e.Args[2], e.Argv),
+		formatStrArray(e.Args[3], e.Envp),
+		atFlags.Format(e.Flags),
+	}
+}
+
+func (e *ExecveatEvent) DecodedArgs() []Arg {
+	return []Arg{
+		{"dirfd", e.Dirfd},
+		{"filename", e.Filename},
+		{"argv", e.Argv},
+		{"envp", e.Envp},
+		{"flags", atFlags.Format(e.Flags)},
+	}
+}
+
+func decodeExecveat(sc Syscall, data []byte) SyscallEvent {
+	return &ExecveatEvent{
+		Syscall:  sc,
+		Dirfd:    int32(sc.Args[0]),
+		Filename: cstring(data[0:256]),
+		Argv:     newStrArray(data[256:768]),
+		Envp:     newStrArray(data[768:1024]),
+		Flags:    sc.Args[4],
+	}
+}
+
+// CloneEvent - событие системного вызова clone
+type CloneEvent struct {
+	Syscall
+	Flags     uint64
+	Stack     uint64
+	ParentTid uint64
+}
+
+func (*CloneEvent) Name() string {
+	return "clone"
+}
+
+func (*CloneEvent) EnterArgs() int {
+	return 3
+}
+
+func (e *CloneEvent) FormatArgs() []string {
+	return []string{
+		cloneFlags.Format(e.Flags),
+		formatPtr(e.Stack),
+		formatPtr(e.ParentTid),
+	}
+}
+
+func (e *CloneEvent) DecodedArgs() []Arg {
+	return []Arg{
+		{"flags", cloneFlags.Format(e.Flags)},
+		{"stack", e.Stack},
+		{"parent_tid", e.ParentTid},
+	}
+}
+
+func decodeClone(sc Syscall, data []byte) SyscallEvent {
+	return &CloneEvent{
+		Syscall:   sc,
+		Flags:     sc.Args[0],
+		Stack:     sc.Args[1],
+		ParentTid: sc.Args[2],
+	}
+}
+
+// Clone3Event - событие системного вызова clone3
+type Clone3Event struct {
+	Syscall
+	ClArgs CloneArgs
+	Size   uint64
+}
+
+func (*Clone3Event) Name() string {
+	return "clone3"
+}
+
+func (*Clone3Event) EnterArgs() int {
+	return 2
+}
+
+func (e *Clone3Event) FormatArgs() []string {
+	return []string{
+		formatStruct(e.Args[0], e.ClArgs),
+		formatUint(e.Size),
+	}
+}
+
+func (e *Clone3Event) DecodedArgs() []Arg {
+	return []Arg{
+		{"cl_args", e.ClArgs},
+		{"size", e.Size},
+	}
+}
+
+func decodeClone3(sc Syscall, data []byte) SyscallEvent {
+	return &Clone3Event{
+		Syscall: sc,
+		ClArgs:  newCloneArgs(data[0:216]),
+		Size:    sc.Args[1],
+	}
+}
+
+// UnshareEvent - событие системного вызова unshare
+type UnshareEvent struct {
+	Syscall
+	Flags uint64
+}
+
+func (*UnshareEvent) Name() string {
+	return "unshare"
+}
+
+func (*UnshareEvent) EnterArgs() int {
+	return 1
+}
+
+func (e *UnshareEvent) FormatArgs() []string {
+	return []string{
+		unshareFlags.Format(e.Flags),
+	}
+}
+
+func (e *UnshareEvent) DecodedArgs() []Arg {
+	return []Arg{
+		{"flags", unshareFlags.Format(e.Flags)},
+	}
+}
+
+func decodeUnshare(sc Syscall, data []byte) SyscallEvent {
+	return &UnshareEvent{
+		Syscall: sc,
+		Flags:   sc.Args[0],
+	}
+}
+
+// SetnsEvent - событие системного вызова setns
+type SetnsEvent struct {
+	Syscall
+	Fd     NsFd
+	Nstype uint64
+}
+
+func (*SetnsEvent) Name() string {
+	return "setns"
+}
+
+func (*SetnsEvent) EnterArgs() int {
+	return 2
+}
+
+func (e *SetnsEvent) FormatArgs() []string {
+	return []string{
+		e.Fd.String(),
+		nsTypes.Format(e.Nstype),
+	}
+}
+
+func (e *SetnsEvent) DecodedArgs() []Arg {
+	return []Arg{
+		{"fd", e.Fd.Fd},
+		{"nstype", nsTypes.Format(e.Nstype)},
+		{"fd_ns", e.Fd.Namespace()},
+	}
+}
+
+func decodeSetns(sc Syscall, data []byte) SyscallEvent {
+	return &SetnsEvent{
+		Syscall: sc,
+		Fd:      newNsFd(int32(sc.Args[0]), data[0:8]),
+		Nstype:  sc.Args[1],
+	}
+}
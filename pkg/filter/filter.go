@@ -0,0 +1,288 @@
+package filter
+
+import (
+	"fmt"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter - разобранное выражение фильтра
+type Filter struct {
+	expr string
+	root node
+}
+
+// String возвращает исходный текст выражения
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match сообщает, удовлетворяет ли событие выражению.
+// Условия на поля, которых нет у события (например, path у close), ложны.
+func (f *Filter) Match(ev event.SyscallEvent) bool {
+	return f.root.match(ev)
+}
+
+// MatchHeader сообщает, удовлетворяет ли событие выражению по полям заголовка
+// (headerFields). Условия на остальные поля считаются неизвестными и не
+// отсекают событие. Так отбираются события процессов и сигналов, у которых
+// нет имени, аргументов и результата системного вызова.
+func (f *Filter) MatchHeader(ev event.SyscallEvent) bool {
+	return f.root.matchHeader(ev) != no
+}
+
+type node interface {
+	match(ev event.SyscallEvent) bool
+	// matchHeader проверяет условие только по полям заголовка события
+	matchHeader(ev event.SyscallEvent) tristate
+}
+
+// tristate - результат условия в трёхзначной логике Клини
+type tristate int8
+
+const (
+	no      tristate = -1
+	unknown tristate = 0
+	yes     tristate = 1
+)
+
+func truth(b bool) tristate {
+	if b {
+		return yes
+	}
+
+	return no
+}
+
+// headerFields - поля заголовка, которые есть у событий всех типов
+var headerFields = map[string]bool{
+	"pid": true, "tid": true, "ns_pid": true, "ns_tid": true, "pidns": true, "uid": true, "cgroup": true, "comm": true,
+}
+
+// leafHeader проверяет условие на поле field по заголовку события
+func leafHeader(ev event.SyscallEvent, field string, n node) tristate {
+	if !headerFields[field] {
+		return unknown
+	}
+
+	return truth(n.match(ev))
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n *orNode) match(ev event.SyscallEvent) bool {
+	return n.left.match(ev) || n.right.match(ev)
+}
+
+func (n *orNode) matchHeader(ev event.SyscallEvent) tristate {
+	return max(n.left.matchHeader(ev), n.right.matchHeader(ev))
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n *andNode) match(ev event.SyscallEvent) bool {
+	return n.left.match(ev) && n.right.match(ev)
+}
+
+func (n *andNode) matchHeader(ev event.SyscallEvent) tristate {
+	return min(n.left.matchHeader(ev), n.right.matchHeader(ev))
+}
+
+type notNode struct {
+	n node
+}
+
+func (n *notNode) match(ev event.SyscallEvent) bool {
+	return !n.n.match(ev)
+}
+
+func (n *notNode) matchHeader(ev event.SyscallEvent) tristate {
+	return -n.n.matchHeader(ev)
+}
+
+// value - значение поля события или литерал выражения
+type value struct {
+	str   string
+	num   int64
+	isNum bool
+}
+
+// compare сравнивает значения как числа, если оба числовые, иначе как строки
+func (v value) compare(other value) int {
+	if v.isNum && other.isNum {
+		switch {
+		case v.num < other.num:
+			return -1
+		case v.num > other.num:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(v.str, other.str)
+}
+
+type cmpNode struct {
+	field string
+	op    string
+	value value
+}
+
+func (n *cmpNode) matchHeader(ev event.SyscallEvent) tristate {
+	return leafHeader(ev, n.field, n)
+}
+
+func (n *cmpNode) match(ev event.SyscallEvent) bool {
+	v, ok := field(ev, n.field)
+	if !ok {
+		return false
+	}
+
+	c := v.compare(n.value)
+
+	switch n.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	default:
+		return false
+	}
+}
+
+// inNode - проверка вхождения в список (или невхождения для not in)
+type inNode struct {
+	field  string
+	values []value
+	negate bool
+}
+
+func (n *inNode) matchHeader(ev event.SyscallEvent) tristate {
+	return leafHeader(ev, n.field, n)
+}
+
+func (n *inNode) match(ev event.SyscallEvent) bool {
+	v, ok := field(ev, n.field)
+	if !ok {
+		return false
+	}
+
+	for _, other := range n.values {
+		if v.compare(other) == 0 {
+			return !n.negate
+		}
+	}
+
+	return n.negate
+}
+
+// matchNode - сопоставление с регулярным выражением (=~ или !~)
+type matchNode struct {
+	field  string
+	re     *regexp.Regexp
+	negate bool
+}
+
+func (n *matchNode) matchHeader(ev event.SyscallEvent) tristate {
+	return leafHeader(ev, n.field, n)
+}
+
+func (n *matchNode) match(ev event.SyscallEvent) bool {
+	v, ok := field(ev, n.field)
+	if !ok {
+		return false
+	}
+
+	return n.re.MatchString(v.str) != n.negate
+}
+
+// field возвращает значение поля события
+func field(ev event.SyscallEvent, name string) (value, bool) {
+	raw := ev.Raw()
+
+	switch name {
+	case "pid":
+		return numValue(int64(raw.Hdr.Pid)), true
+	case "tid":
+		return numValue(int64(raw.Hdr.Tid)), true
+	case "ns_pid":
+		return numValue(int64(raw.Hdr.NsPid)), true
+	case "ns_tid":
+		return numValue(int64(raw.Hdr.NsTid)), true
+	case "pidns":
+		return numValue(int64(raw.Hdr.PidNs)), true
+	case "uid":
+		return numValue(int64(raw.Hdr.Uid)), true
+	case "cgroup":
+		return numValue(int64(raw.Hdr.CgroupID)), true
+	case "comm":
+		return value{str: raw.Hdr.Comm}, true
+	case "name":
+		return value{str: ev.Name()}, true
+	case "nr":
+		return numValue(int64(raw.Nr)), true
+	case "ret":
+		return numValue(ev.Ret()), true
+	case "errno":
+		errno, ok := event.Errno(ev.Ret())
+		if !ok {
+			return value{isNum: true}, true
+		}
+
+		return value{str: event.ErrnoName(errno), num: int64(errno), isNum: true}, true
+	case "duration":
+		return numValue(int64(raw.Duration)), true
+	case "arg1", "arg2", "arg3", "arg4", "arg5", "arg6":
+		return numValue(int64(raw.Args[name[3]-'1'])), true
+	}
+
+	for _, arg := range ev.DecodedArgs() {
+		if arg.Name == name {
+			return anyValue(arg.Value), true
+		}
+	}
+
+	return value{}, false
+}
+
+func numValue(n int64) value {
+	return value{str: strconv.FormatInt(n, 10), num: n, isNum: true}
+}
+
+func anyValue(v any) value {
+	switch v := v.(type) {
+	case int:
+		return numValue(int64(v))
+	case int32:
+		return numValue(int64(v))
+	case int64:
+		return numValue(v)
+	case uint32:
+		return numValue(int64(v))
+	case uint64:
+		return numValue(int64(v))
+	case string:
+		return value{str: v}
+	case []byte:
+		return value{str: string(v)}
+	case event.Buffer:
+		return value{str: string(v)}
+	default:
+		return value{str: fmt.Sprint(v)}
+	}
+}
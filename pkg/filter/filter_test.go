@@ -0,0 +1,205 @@
+package filter
+
+import (
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"golang.org/x/sys/unix"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	openat := &event.OpenatEvent{
+		Syscall: event.Syscall{
+			Hdr:      event.Header{Pid: 123, Tid: 124, Comm: "cat"},
+			Nr:       257,
+			RetVal:   -2,
+			Duration: 3 * time.Millisecond,
+		},
+		Dirfd: -100,
+		Path:  "/etc/shadow",
+		Flags: 0x80000,
+	}
+
+	closeEv := &event.CloseEvent{
+		Syscall: event.Syscall{Hdr: event.Header{Pid: 7, Tid: 7, Comm: "sh"}, Nr: 3},
+		Fd:      3,
+	}
+
+	tests := []struct {
+		expr  string
+		match []bool // openat, close
+	}{
+		{`pid == 123 && name in (openat, read) && ret < 0 && path =~ "^/etc/"`, []bool{true, false}},
+		{`syscall == close || comm == "cat"`, []bool{true, true}},
+		{`errno == ENOENT`, []bool{true, false}},
+		{`errno == 2`, []bool{true, false}},
+		{`duration >= 1ms`, []bool{true, false}},
+		{`!(pid == 7)`, []bool{true, false}},
+		{`name not in (close)`, []bool{true, false}},
+		{`path !~ "^/etc/"`, []bool{false, false}},
+		{`fd == 3`, []bool{false, true}},
+		{`dirfd == -100 && flags =~ O_CLOEXEC`, []bool{true, false}},
+		{`arg1 == 0 && ret >= 0`, []bool{false, true}},
+		{`tid > 100`, []bool{true, false}},
+	}
+
+	for _, tt := range tests {
+		f, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+
+		for i, ev := range []event.SyscallEvent{openat, closeEv} {
+			if got := f.Match(ev); got != tt.match[i] {
+				t.Errorf("%q.Match(%s) = %v, want %v", tt.expr, ev.Name(), got, tt.match[i])
+			}
+		}
+	}
+}
+
+func TestMatchHeader(t *testing.T) {
+	exit := &event.ProcessEvent{
+		Syscall: event.Syscall{Hdr: event.Header{Pid: 123, Tid: 123, Comm: "cat", Uid: 1000, CgroupID: 42}},
+		Kind:    event.ProcessExit,
+	}
+
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{`pid == 123`, true},
+		{`pid == 7`, false},
+		{`uid == 1000 && cgroup == 42 && comm == "cat"`, true},
+		{`uid == 0`, false},
+		// условия на поля системного вызова неизвестны и не отсекают событие
+		{`pid == 123 && name == openat`, true},
+		{`pid == 7 && name == openat`, false},
+		{`pid == 7 || ret < 0`, true},
+		{`!(name == openat)`, true},
+		{`!(pid == 123) || path =~ "^/etc/"`, true},
+		{`!(pid == 123 || fd == 3)`, false},
+	}
+
+	for _, tt := range tests {
+		f, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+
+		if got := f.MatchHeader(exit); got != tt.match {
+			t.Errorf("%q.MatchHeader() = %v, want %v", tt.expr, got, tt.match)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		`pid ==`,
+		`pid == 1 &&`,
+		`(pid == 1`,
+		`pid 1`,
+		`name in (openat`,
+		`path =~ "("`,
+		`comm == "cat`,
+		`pid == 1 pid == 2`,
+		`== 1`,
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): expected error", expr)
+		}
+	}
+}
+
+func TestPushdown(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Pushdown
+	}{
+		{`pid == 123 && name in (openat, read) && ret < 0`, Pushdown{Pids: []uint32{123}, Syscalls: []string{"openat", "read"}, Ret: RetFailed}},
+		{`pid in (1, 2) && pid in (2, 3) && ret >= 0`, Pushdown{Pids: []uint32{2}, Ret: RetSuccess}},
+		{`name == read && name == write`, Pushdown{Syscalls: []string{}}},
+		// под || и ! условия не выносятся
+		{`pid == 1 || name == read`, Pushdown{}},
+		{`!(pid == 1) && ret > 5`, Pushdown{Ret: RetSuccess}},
+		{`ret != 0`, Pushdown{}},
+	}
+
+	for _, tt := range tests {
+		f, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+
+		if got := f.Pushdown(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q.Pushdown() = %+v, want %+v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestPaths(t *testing.T) {
+	p := NewPaths([]string{"/etc/"}, sysdesc.Default)
+
+	sc := func(entry bool, ret int64) event.Syscall {
+		return event.Syscall{Entry: entry, Hdr: event.Header{Pid: 10, Tid: 10}, RetVal: ret}
+	}
+
+	events := []struct {
+		ev    event.SyscallEvent
+		match bool
+	}{
+		{&event.OpenatEvent{Syscall: sc(true, 0), Dirfd: -100, Path: "/etc/hosts"}, true},
+		{&event.OpenatEvent{Syscall: sc(false, 3), Dirfd: -100, Path: "/etc/hosts"}, true},
+		{&event.OpenatEvent{Syscall: sc(false, 4), Dirfd: -100, Path: "/tmp/x"}, false},
+		{&event.ReadEvent{Syscall: sc(false, 5), Fd: 3}, true},
+		{&event.ReadEvent{Syscall: sc(false, 5), Fd: 4}, false},
+		{&event.CloseEvent{Syscall: sc(true, 0), Fd: 3}, true},
+		{&event.CloseEvent{Syscall: sc(false, 0), Fd: 3}, true},
+		{&event.WriteEvent{Syscall: sc(false, 1), Fd: 3}, false},
+	}
+
+	for i, tt := range events {
+		if got := p.Match(tt.ev); got != tt.match {
+			t.Errorf("event %d (%s): Match = %v, want %v", i, tt.ev.Name(), got, tt.match)
+		}
+	}
+}
+
+func TestPathsProcess(t *testing.T) {
+	p := NewPaths([]string{"/etc/"}, sysdesc.Default)
+
+	hdr := event.Header{Pid: 10, Tid: 10}
+
+	open := func(fd int64, flags uint64) {
+		sc := event.Syscall{Hdr: hdr, Args: [6]uint64{2: flags}, RetVal: fd}
+		p.Match(&event.OpenatEvent{Syscall: sc, Dirfd: -100, Path: "/etc/hosts", Flags: flags})
+	}
+
+	read := func(fd int32) bool {
+		return p.Match(&event.ReadEvent{Syscall: event.Syscall{Hdr: hdr, RetVal: 1}, Fd: fd})
+	}
+
+	open(3, 0)
+	open(4, unix.O_CLOEXEC)
+
+	// exec закрывает только дескрипторы с O_CLOEXEC
+	p.Process(&event.ProcessEvent{Syscall: event.Syscall{Hdr: hdr}, Kind: event.ProcessExec})
+
+	if !read(3) || read(4) {
+		t.Errorf("after exec: fd 3 = %v, fd 4 = %v, want true, false", read(3), read(4))
+	}
+
+	// события других процессов не затрагивают дескрипторы
+	p.Process(&event.ProcessEvent{Syscall: event.Syscall{Hdr: event.Header{Pid: 11}}, Kind: event.ProcessExit})
+
+	if !read(3) {
+		t.Error("exit of other process must keep fd 3")
+	}
+
+	p.Process(&event.ProcessEvent{Syscall: event.Syscall{Hdr: hdr}, Kind: event.ProcessExit})
+
+	if read(3) || len(p.fds) != 0 {
+		t.Errorf("after exit: fd 3 = %v, %d fds left", read(3), len(p.fds))
+	}
+}
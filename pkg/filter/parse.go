@@ -0,0 +1,367 @@
+// Package filter реализует язык выражений для отбора событий:
+//
+//	pid == 123 && name in (openat, read) && ret < 0 && path =~ "^/etc/"
+//
+// Выражение разбирается функцией Parse и применяется к декодированным событиям
+// методом Match. Простые условия (pid, имя системного вызова, знак ret)
+// можно передать в bpf программы, см. Pushdown.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Parse разбирает выражение фильтра.
+//
+// Грамматика:
+//
+//	expr  = and { "||" and }
+//	and   = unary { "&&" unary }
+//	unary = "!" unary | "(" expr ")" | cmp
+//	cmp   = field op value | field ["not"] "in" "(" value { "," value } ")"
+//	op    = "==" | "!=" | "<" | "<=" | ">" | ">=" | "=~" | "!~"
+//	value = число | длительность (10ms) | "строка" | слово
+//
+// Поля: pid, tid, ns_pid, ns_tid, pidns, uid, cgroup, comm, name (syscall), nr, ret, errno, duration, arg1..arg6
+// и имена разобранных аргументов системного вызова (path, fd, flags, ...).
+// Поля от pid до comm есть у всех событий, включая события процессов и сигналов.
+func Parse(expr string) (*Filter, error) {
+	toks, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// Типы лексем
+const (
+	tokIdent = iota
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")", ","}
+
+func tokenize(expr string) ([]token, error) {
+	var toks []token
+
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			str, n, err := quoted(expr[i:])
+			if err != nil {
+				return nil, fmt.Errorf("position %d: %w", i+1, err)
+			}
+
+			toks = append(toks, token{kind: tokString, text: str, pos: i})
+			i += n
+		case c == '-' || c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(expr) && isWordChar(rune(expr[j])) {
+				j++
+			}
+
+			toks = append(toks, token{kind: tokNumber, text: expr[i:j], pos: i})
+			i = j
+		case isWordChar(c):
+			j := i
+			for j < len(expr) && isWordChar(rune(expr[j])) {
+				j++
+			}
+
+			toks = append(toks, token{kind: tokIdent, text: expr[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+
+					break
+				}
+			}
+
+			if op == "" {
+				return nil, fmt.Errorf("position %d: unexpected character %q", i+1, c)
+			}
+
+			toks = append(toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return toks, nil
+}
+
+func isWordChar(c rune) bool {
+	return c == '_' || c == '.' || c == '/' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// quoted разбирает строку в двойных кавычках и возвращает её значение и длину в выражении
+func quoted(s string) (string, int, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			str, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s: %w", s[:i+1], err)
+			}
+
+			return str, i + 1, nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.toks)
+}
+
+func (p *parser) peek() token {
+	if p.eof() {
+		return token{}
+	}
+
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+
+	return t
+}
+
+// accept пропускает оператор или ключевое слово text, если оно следующее
+func (p *parser) accept(text string) bool {
+	if t := p.peek(); !p.eof() && t.kind != tokString && t.text == text {
+		p.pos++
+
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	pos := 0
+	if !p.eof() {
+		pos = p.peek().pos + 1
+	} else if len(p.toks) > 0 {
+		last := p.toks[len(p.toks)-1]
+		pos = last.pos + len(last.text) + 1
+	}
+
+	return fmt.Errorf("position %d: %s", pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &orNode{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("&&") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &andNode{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	switch {
+	case p.accept("!"):
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &notNode{n: n}, nil
+	case p.accept("("):
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.accept(")") {
+			return nil, p.errorf("expected )")
+		}
+
+		return n, nil
+	default:
+		return p.cmp()
+	}
+}
+
+func (p *parser) cmp() (node, error) {
+	t := p.next()
+	if t.kind != tokIdent {
+		return nil, fmt.Errorf("position %d: expected field name, got %q", t.pos+1, t.text)
+	}
+
+	field := fieldName(t.text)
+
+	if p.accept("not") {
+		if !p.accept("in") {
+			return nil, p.errorf("expected in")
+		}
+
+		return p.in(field, true)
+	}
+
+	if p.accept("in") {
+		return p.in(field, false)
+	}
+
+	op := p.next()
+	if op.kind != tokOp {
+		return nil, fmt.Errorf("position %d: expected comparison operator after %s", op.pos+1, field)
+	}
+
+	switch op.text {
+	case "=~", "!~":
+		v := p.next()
+		if v.kind != tokString && v.kind != tokIdent {
+			return nil, fmt.Errorf("position %d: expected regular expression", v.pos+1)
+		}
+
+		re, err := regexp.Compile(v.text)
+		if err != nil {
+			return nil, fmt.Errorf("position %d: %w", v.pos+1, err)
+		}
+
+		return &matchNode{field: field, re: re, negate: op.text == "!~"}, nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+
+		return &cmpNode{field: field, op: op.text, value: v}, nil
+	default:
+		return nil, fmt.Errorf("position %d: unexpected %q after %s", op.pos+1, op.text, field)
+	}
+}
+
+func (p *parser) in(field string, negate bool) (node, error) {
+	if !p.accept("(") {
+		return nil, p.errorf("expected ( after in")
+	}
+
+	n := &inNode{field: field, negate: negate}
+
+	for {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+
+		n.values = append(n.values, v)
+
+		if p.accept(")") {
+			return n, nil
+		}
+
+		if !p.accept(",") {
+			return nil, p.errorf("expected , or )")
+		}
+	}
+}
+
+// value разбирает значение для сравнения
+func (p *parser) value() (value, error) {
+	if p.eof() {
+		return value{}, p.errorf("expected value")
+	}
+
+	t := p.next()
+
+	switch t.kind {
+	case tokString, tokIdent:
+		return value{str: t.text}, nil
+	case tokNumber:
+		if n, err := strconv.ParseInt(t.text, 0, 64); err == nil {
+			return value{str: t.text, num: n, isNum: true}, nil
+		}
+
+		if n, err := strconv.ParseUint(t.text, 0, 64); err == nil {
+			return value{str: t.text, num: int64(n), isNum: true}, nil
+		}
+
+		if d, err := time.ParseDuration(t.text); err == nil {
+			return value{str: t.text, num: int64(d), isNum: true}, nil
+		}
+
+		return value{}, fmt.Errorf("position %d: invalid number %q", t.pos+1, t.text)
+	default:
+		return value{}, fmt.Errorf("position %d: expected value, got %q", t.pos+1, t.text)
+	}
+}
+
+// fieldName приводит синонимы полей к одному имени
+func fieldName(name string) string {
+	if name == "syscall" {
+		return "name"
+	}
+
+	return name
+}
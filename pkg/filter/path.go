@@ -0,0 +1,134 @@
+package filter
+
+import (
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"golang.org/x/sys/unix"
+	"strings"
+)
+
+// Paths отбирает системные вызовы, затрагивающие пути с заданными префиксами (-P):
+// через аргументы-пути или через файловые дескрипторы, открытые на этих путях.
+// Связь дескрипторов с путями отслеживается по событиям выхода, поэтому события
+// нужно передавать в Match в порядке их завершения, а события процессов - в Process.
+type Paths struct {
+	prefixes []string
+	table    *sysdesc.Table
+	// fds - дескрипторы процессов, открытые на подходящих путях; значение -
+	// дескриптор открыт с флагом O_CLOEXEC и закрывается при exec
+	fds map[fdKey]bool
+}
+
+type fdKey struct {
+	pid uint32
+	fd  int32
+}
+
+// NewPaths создаёт фильтр по префиксам путей. Аргументы системных вызовов
+// определяются по описаниям из table.
+func NewPaths(prefixes []string, table *sysdesc.Table) *Paths {
+	return &Paths{
+		prefixes: prefixes,
+		table:    table,
+		fds:      make(map[fdKey]bool),
+	}
+}
+
+// Prefixes возвращает префиксы путей фильтра
+func (p *Paths) Prefixes() []string {
+	return p.prefixes
+}
+
+// Match сообщает, затрагивает ли системный вызов путь из фильтра, и по событию
+// выхода обновляет связь файловых дескрипторов с путями
+func (p *Paths) Match(ev event.SyscallEvent) bool {
+	desc, ok := p.table.ByName(ev.Name())
+	if !ok || desc.Untyped {
+		return false
+	}
+
+	raw := ev.Raw()
+	args := ev.DecodedArgs()
+	matched := false
+
+	var closed []fdKey
+
+	for i, arg := range desc.Args {
+		if i >= len(args) {
+			break
+		}
+
+		switch arg.Kind {
+		case sysdesc.KindPath:
+			if path, ok := args[i].Value.(string); ok && p.hasPrefix(path) {
+				matched = true
+			}
+		case sysdesc.KindFd:
+			fd, ok := args[i].Value.(int32)
+			if !ok {
+				continue
+			}
+
+			key := fdKey{pid: raw.Hdr.Pid, fd: fd}
+			if _, ok := p.fds[key]; ok {
+				matched = true
+			}
+
+			if arg.Close {
+				closed = append(closed, key)
+			}
+		}
+	}
+
+	if raw.Entry {
+		return matched
+	}
+
+	// дескриптор освобождается даже при ошибке close
+	for _, key := range closed {
+		delete(p.fds, key)
+	}
+
+	if matched && desc.RetFd && raw.RetVal >= 0 {
+		p.fds[fdKey{pid: raw.Hdr.Pid, fd: int32(raw.RetVal)}] = openCloexec(desc, raw)
+	}
+
+	return matched
+}
+
+// Process обновляет связь дескрипторов с путями по событию процесса: при
+// завершении процесса освобождаются все его дескрипторы, а при exec -
+// открытые с флагом O_CLOEXEC
+func (p *Paths) Process(ev *event.ProcessEvent) {
+	if ev.Kind != event.ProcessExit && ev.Kind != event.ProcessExec {
+		return
+	}
+
+	for key, cloexec := range p.fds {
+		if key.pid == ev.Hdr.Pid && (ev.Kind == event.ProcessExit || cloexec) {
+			delete(p.fds, key)
+		}
+	}
+}
+
+// openCloexec сообщает, передан ли системному вызову флаг O_CLOEXEC
+// для возвращаемого дескриптора
+func openCloexec(desc *sysdesc.Syscall, raw *event.Syscall) bool {
+	for i, arg := range desc.Args {
+		if arg.Kind == sysdesc.KindFlags && arg.Set == "open_flags" {
+			return raw.Args[i]&unix.O_CLOEXEC != 0
+		}
+	}
+
+	return false
+}
+
+func (p *Paths) hasPrefix(path string) bool {
+	for _, prefix := range p.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,132 @@
+package filter
+
+// Знак возвращаемого значения, которым ограничен фильтр
+const (
+	RetAny     = 0
+	RetFailed  = -1
+	RetSuccess = 1
+)
+
+// Pushdown - условия фильтра, которые можно проверить в bpf программах до
+// передачи события в user-space. Условия извлекаются только из конъюнкции
+// верхнего уровня и являются необходимыми: событие, не прошедшее их, не
+// удовлетворяет фильтру. Match по-прежнему нужно применять ко всем событиям.
+type Pushdown struct {
+	// Pids - допустимые идентификаторы процессов, nil - любые
+	Pids []uint32
+	// Syscalls - допустимые имена системных вызовов, nil - любые
+	Syscalls []string
+	// Ret - знак возвращаемого значения: RetAny, RetFailed или RetSuccess
+	Ret int
+}
+
+// Pushdown возвращает условия фильтра, которые можно проверить в bpf программах
+func (f *Filter) Pushdown() Pushdown {
+	var pd Pushdown
+
+	for _, n := range conjuncts(f.root) {
+		switch n := n.(type) {
+		case *cmpNode:
+			pd.cmp(n)
+		case *inNode:
+			pd.in(n)
+		}
+	}
+
+	return pd
+}
+
+// conjuncts раскладывает выражение на условия, объединённые &&
+func conjuncts(n node) []node {
+	if and, ok := n.(*andNode); ok {
+		return append(conjuncts(and.left), conjuncts(and.right)...)
+	}
+
+	return []node{n}
+}
+
+func (pd *Pushdown) cmp(n *cmpNode) {
+	switch {
+	case n.field == "pid" && n.op == "==" && n.value.isNum:
+		pd.pids([]value{n.value})
+	case n.field == "name" && n.op == "==":
+		pd.syscalls([]value{n.value})
+	case n.field == "ret" && n.value.isNum:
+		pd.ret(n.op, n.value.num)
+	}
+}
+
+func (pd *Pushdown) in(n *inNode) {
+	if n.negate {
+		return
+	}
+
+	switch n.field {
+	case "pid":
+		for _, v := range n.values {
+			if !v.isNum {
+				return
+			}
+		}
+
+		pd.pids(n.values)
+	case "name":
+		pd.syscalls(n.values)
+	}
+}
+
+// pids пересекает допустимые идентификаторы процессов с values
+func (pd *Pushdown) pids(values []value) {
+	var pids []uint32
+
+	for _, v := range values {
+		pid := uint32(v.num)
+		if pd.Pids == nil || contains(pd.Pids, pid) {
+			pids = append(pids, pid)
+		}
+	}
+
+	pd.Pids = nonNil(pids)
+}
+
+// syscalls пересекает допустимые имена системных вызовов с values
+func (pd *Pushdown) syscalls(values []value) {
+	var names []string
+
+	for _, v := range values {
+		if pd.Syscalls == nil || contains(pd.Syscalls, v.str) {
+			names = append(names, v.str)
+		}
+	}
+
+	pd.Syscalls = nonNil(names)
+}
+
+// ret выводит знак возвращаемого значения из сравнения ret op n
+func (pd *Pushdown) ret(op string, n int64) {
+	switch {
+	case (op == "<" && n <= 0) || (op == "<=" && n < 0) || (op == "==" && n < 0):
+		pd.Ret = RetFailed
+	case (op == ">" && n >= -1) || (op == ">=" && n >= 0) || (op == "==" && n >= 0):
+		pd.Ret = RetSuccess
+	}
+}
+
+func contains[T comparable](list []T, v T) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nonNil отличает пустое пересечение (ни одно событие не подходит) от отсутствия условия
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+
+	return list
+}
@@ -0,0 +1,154 @@
+package output
+
+import (
+	"encoding/json"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"io"
+)
+
+// chromeEvent - событие в формате Chrome Trace Event Format
+// (https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU).
+// Времена ts и dur задаются в микросекундах.
+type chromeEvent struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat,omitempty"`
+	Ph   string         `json:"ph"`
+	Ts   float64        `json:"ts"`
+	Dur  float64        `json:"dur,omitempty"`
+	Pid  uint32         `json:"pid"`
+	Tid  uint32         `json:"tid"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// Chrome выводит события в формате Chrome Trace Event (JSON Array Format),
+// который открывается в Perfetto UI и chrome://tracing.
+//
+// Каждый системный вызов выводится законченным событием ("X") на дорожке своего
+// потока, имена процессов и потоков задаются метасобытиями ("M") по comm.
+// События процессов и сигналов не выводятся.
+type Chrome struct {
+	w    io.Writer
+	werr error
+	// started - выведена открывающая скобка массива
+	started bool
+	// threads - последнее выведенное имя потока
+	threads map[uint32]string
+	// processes - последнее выведенное имя процесса
+	processes map[uint32]string
+}
+
+func NewChrome(w io.Writer) *Chrome {
+	return &Chrome{
+		w:         w,
+		threads:   make(map[uint32]string),
+		processes: make(map[uint32]string),
+	}
+}
+
+func (c *Chrome) WriteEvent(ev event.SyscallEvent) error {
+	raw := ev.Raw()
+	if !event.IsSyscall(ev) || raw.Entry {
+		return nil
+	}
+
+	hdr := ev.Header()
+
+	c.names(hdr)
+
+	args := make(map[string]any)
+	for _, arg := range ev.DecodedArgs() {
+		args[arg.Name] = arg.Value
+	}
+
+	args["ret"] = ev.Ret()
+
+	if errno, ok := event.Errno(ev.Ret()); ok {
+		args["errno"] = event.ErrnoName(errno)
+	}
+
+	c.write(&chromeEvent{
+		Name: ev.Name(),
+		Cat:  "syscall",
+		Ph:   "X",
+		Ts:   float64(hdr.Ts) / 1e3,
+		Dur:  float64(raw.Duration.Nanoseconds()) / 1e3,
+		Pid:  hdr.Pid,
+		Tid:  hdr.Tid,
+		Args: args,
+	})
+
+	return c.werr
+}
+
+// names выводит метасобытия с именами процесса и потока, если они ещё не
+// выводились или изменились (например, после execve)
+func (c *Chrome) names(hdr event.Header) {
+	if name, ok := c.threads[hdr.Tid]; !ok || name != hdr.Comm {
+		c.threads[hdr.Tid] = hdr.Comm
+		c.write(&chromeEvent{
+			Name: "thread_name",
+			Ph:   "M",
+			Pid:  hdr.Pid,
+			Tid:  hdr.Tid,
+			Args: map[string]any{"name": hdr.Comm},
+		})
+	}
+
+	// имя процесса - comm главного потока, до его первого события - comm любого потока
+	name, ok := c.processes[hdr.Pid]
+	if ok && (hdr.Tid != hdr.Pid || name == hdr.Comm) {
+		return
+	}
+
+	c.processes[hdr.Pid] = hdr.Comm
+	c.write(&chromeEvent{
+		Name: "process_name",
+		Ph:   "M",
+		Pid:  hdr.Pid,
+		Args: map[string]any{"name": hdr.Comm},
+	})
+}
+
+func (c *Chrome) write(ev *chromeEvent) {
+	if c.werr != nil {
+		return
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		c.werr = err
+
+		return
+	}
+
+	sep := ",\n"
+	if !c.started {
+		sep = "[\n"
+		c.started = true
+	}
+
+	if _, err := io.WriteString(c.w, sep); err != nil {
+		c.werr = err
+
+		return
+	}
+
+	_, c.werr = c.w.Write(data)
+}
+
+// Close завершает JSON массив событий. Формат допускает отсутствие закрывающей
+// скобки, поэтому файл прерванной трассировки тоже можно открыть.
+func (c *Chrome) Close() error {
+	if c.werr != nil {
+		return c.werr
+	}
+
+	end := "\n]\n"
+	if !c.started {
+		end = "[]\n"
+	}
+
+	_, err := io.WriteString(c.w, end)
+
+	return err
+}
@@ -0,0 +1,273 @@
+package output
+
+import (
+	"encoding/json"
+	"github.com/ebirukov/bstrace/pkg/container"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/stack"
+	"golang.org/x/sys/unix"
+	"io"
+	"time"
+)
+
+// JSONSchemaVersion - версия схемы полей JSON событий.
+// Увеличивается при любом несовместимом изменении состава или смысла полей.
+const JSONSchemaVersion = 2
+
+// jsonEvent - схема события в формате JSON Lines (версия 2):
+//
+//	v           версия схемы
+//	type        тип события: "syscall" (события процессов описаны в jsonProcessEvent)
+//	ts          время входа в системный вызов (RFC 3339, наносекунды)
+//	pid, tid    идентификаторы процесса и потока
+//	ns_pid, ns_tid идентификаторы процесса и потока в их пространстве имён PID
+//	pidns       inode пространства имён PID
+//	comm        имя задачи
+//	cgroup      путь cgroup v2 задачи (только при трассировке)
+//	container_id идентификатор контейнера, если задача в контейнере
+//	unit        юнит systemd cgroup задачи
+//	syscall     имя системного вызова
+//	nr          номер системного вызова
+//	args        разобранные аргументы по именам (отсутствует, если сигнатура неизвестна);
+//	            буферы - строки с экранированием как в strace -x (\xNN для непечатаемых байт)
+//	raw_args    значения регистров аргументов
+//	ret         возвращаемое значение
+//	noreturn    поток завершился, не вернувшись из системного вызова (exit_group), ret не определён
+//	errno       символьный код ошибки, если системный вызов завершился ошибкой
+//	duration_ns длительность системного вызова в наносекундах
+//	stack       стек пользовательского пространства от вершины к корню (только с -k)
+//	kernel_stack стек ядра медленного или неудачного системного вызова (только с --kstack)
+type jsonEvent struct {
+	jsonHeader
+	Syscall     string         `json:"syscall"`
+	Nr          uint32         `json:"nr"`
+	Args        map[string]any `json:"args,omitempty"`
+	RawArgs     [6]uint64      `json:"raw_args"`
+	Ret         int64          `json:"ret"`
+	NoReturn    bool           `json:"noreturn,omitempty"`
+	Errno       string         `json:"errno,omitempty"`
+	DurationNs  int64          `json:"duration_ns"`
+	Stack       []jsonFrame    `json:"stack,omitempty"`
+	KernelStack []jsonFrame    `json:"kernel_stack,omitempty"`
+}
+
+// jsonHeader - общие поля всех событий, от v до unit
+type jsonHeader struct {
+	V           int       `json:"v"`
+	Type        string    `json:"type"`
+	Ts          time.Time `json:"ts"`
+	Pid         uint32    `json:"pid"`
+	Tid         uint32    `json:"tid"`
+	NsPid       uint32    `json:"ns_pid"`
+	NsTid       uint32    `json:"ns_tid"`
+	PidNs       uint32    `json:"pidns"`
+	Comm        string    `json:"comm"`
+	Cgroup      string    `json:"cgroup,omitempty"`
+	ContainerID string    `json:"container_id,omitempty"`
+	Unit        string    `json:"unit,omitempty"`
+}
+
+// jsonSignalEvent - событие сигнала. Общие поля те же, что у системного вызова;
+// pid и tid - получатель сигнала.
+//
+//	type        "signal" (доставка) или "signal_generate" (отправка)
+//	signal      имя сигнала
+//	siginfo     поля siginfo по именам, как в выводе strace (si_signo, si_code, si_pid...)
+//	handler     адрес обработчика: 0 - действие по умолчанию, 1 - игнорирование (signal)
+//	interrupted системный вызов, прерванный сигналом: syscall, nr, ret и errno (signal)
+//	sender_pid, sender_tid, sender_comm отправитель сигнала (signal_generate)
+//	group       сигнал отправлен всему процессу (signal_generate)
+//	result      результат отправки: delivered, ignored, already_pending... (signal_generate)
+type jsonSignalEvent struct {
+	jsonHeader
+	Signal      string           `json:"signal"`
+	Siginfo     map[string]any   `json:"siginfo"`
+	Handler     *uint64          `json:"handler,omitempty"`
+	Interrupted *jsonInterrupted `json:"interrupted,omitempty"`
+	SenderPid   uint32           `json:"sender_pid,omitempty"`
+	SenderTid   uint32           `json:"sender_tid,omitempty"`
+	SenderComm  string           `json:"sender_comm,omitempty"`
+	Group       bool             `json:"group,omitempty"`
+	Result      string           `json:"result,omitempty"`
+}
+
+// jsonInterrupted - системный вызов, прерванный сигналом
+type jsonInterrupted struct {
+	Syscall string `json:"syscall"`
+	Nr      uint32 `json:"nr"`
+	Ret     int64  `json:"ret"`
+	Errno   string `json:"errno"`
+}
+
+// jsonProcessEvent - событие жизненного цикла процесса. Общие поля те же, что
+// у системного вызова; ts - время события, pid и tid - задача, выполнившая
+// exec или fork, или последний поток завершившегося процесса.
+//
+//	type        "exec", "fork" или "exit"
+//	ppid        родительский процесс
+//	filename    путь запущенного исполняемого файла (exec)
+//	old_tid     поток, выполнивший exec, до exec, если это не главный поток (exec)
+//	child_pid, child_tid созданные процесс и поток (fork)
+//	exit_code   код завершения, если процесс завершился сам (exit)
+//	signal      сигнал, убивший процесс (exit)
+//	core_dumped при завершении сигналом создан дамп памяти (exit)
+type jsonProcessEvent struct {
+	jsonHeader
+	Ppid       uint32 `json:"ppid"`
+	Filename   string `json:"filename,omitempty"`
+	OldTid     uint32 `json:"old_tid,omitempty"`
+	ChildPid   uint32 `json:"child_pid,omitempty"`
+	ChildTid   uint32 `json:"child_tid,omitempty"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	Signal     string `json:"signal,omitempty"`
+	CoreDumped bool   `json:"core_dumped,omitempty"`
+}
+
+// jsonFrame - кадр стека пользовательского пространства
+type jsonFrame struct {
+	PC         uint64 `json:"pc"`
+	Kernel     bool   `json:"-"`
+	Path       string `json:"path,omitempty"`
+	Offset     uint64 `json:"offset,omitempty"`
+	Func       string `json:"func,omitempty"`
+	FuncOffset uint64 `json:"func_offset,omitempty"`
+	Source     string `json:"source,omitempty"`
+	Line       int    `json:"line,omitempty"`
+}
+
+// JSON выводит по одному JSON объекту на событие (JSON Lines)
+type JSON struct {
+	enc *json.Encoder
+	// stacks - источник стеков для поля stack
+	stacks *stack.Resolver
+	// containers - источник полей cgroup, container_id и unit
+	containers *container.Resolver
+}
+
+func NewJSON(w io.Writer) *JSON {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	return &JSON{enc: enc}
+}
+
+func (j *JSON) WriteEvent(ev event.SyscallEvent) error {
+	switch e := ev.(type) {
+	case *event.ProcessEvent:
+		return j.writeProcess(e)
+	case *event.SignalEvent:
+		return j.writeSignal(e)
+	}
+
+	raw := ev.Raw()
+	if raw.Entry {
+		return nil
+	}
+
+	out := jsonEvent{
+		jsonHeader: j.header("syscall", ev.Header()),
+		Syscall:    ev.Name(),
+		Nr:         raw.Nr,
+		RawArgs:    raw.Args,
+		Ret:        ev.Ret(),
+		NoReturn:   raw.NoReturn,
+		DurationNs: raw.Duration.Nanoseconds(),
+	}
+
+	if args := ev.DecodedArgs(); len(args) > 0 {
+		out.Args = make(map[string]any, len(args))
+		for _, arg := range args {
+			out.Args[arg.Name] = arg.Value
+		}
+	}
+
+	if errno, ok := event.Errno(ev.Ret()); ok && !raw.NoReturn {
+		out.Errno = event.ErrnoName(errno)
+	}
+
+	for _, f := range userStack(j.stacks, raw) {
+		out.Stack = append(out.Stack, jsonFrame(f))
+	}
+
+	for _, f := range kernelStack(j.stacks, raw) {
+		out.KernelStack = append(out.KernelStack, jsonFrame(f))
+	}
+
+	return j.enc.Encode(&out)
+}
+
+func (j *JSON) writeProcess(ev *event.ProcessEvent) error {
+	out := jsonProcessEvent{
+		jsonHeader: j.header(ev.Name(), ev.Hdr),
+		Ppid:       ev.Ppid,
+		Filename:   ev.Filename,
+		ChildPid:   ev.ChildPid,
+		ChildTid:   ev.ChildTid,
+	}
+
+	if ev.Kind == event.ProcessExec && ev.OldTid != ev.Hdr.Tid {
+		out.OldTid = ev.OldTid
+	}
+
+	if ev.Kind == event.ProcessExit {
+		if code, ok := ev.ExitCode(); ok {
+			out.ExitCode = &code
+		}
+
+		if sig, ok := ev.Signal(); ok {
+			out.Signal, out.CoreDumped = unix.SignalName(sig), ev.CoreDumped()
+		}
+	}
+
+	return j.enc.Encode(&out)
+}
+
+func (j *JSON) writeSignal(ev *event.SignalEvent) error {
+	out := jsonSignalEvent{
+		jsonHeader: j.header(ev.Name(), ev.Hdr),
+		Signal:     unix.SignalName(ev.Signal),
+		Siginfo:    make(map[string]any, len(ev.Info)),
+	}
+
+	for _, f := range ev.Info {
+		out.Siginfo[f.Name] = f.Value
+	}
+
+	switch ev.Kind {
+	case event.SignalGenerate:
+		out.SenderPid, out.SenderTid, out.SenderComm = ev.SenderPid, ev.SenderTid, ev.SenderComm
+		out.Group, out.Result = ev.Group, ev.Result.String()
+	case event.SignalDeliver:
+		out.Handler = &ev.Handler
+
+		if in := ev.Interrupted; in != nil {
+			out.Interrupted = &jsonInterrupted{Syscall: in.Name, Nr: in.Nr, Ret: in.Ret}
+			if errno, ok := event.Errno(in.Ret); ok {
+				out.Interrupted.Errno = event.ErrnoName(errno)
+			}
+		}
+	}
+
+	return j.enc.Encode(&out)
+}
+
+// header заполняет общие поля события типа typ
+func (j *JSON) header(typ string, hdr event.Header) jsonHeader {
+	out := jsonHeader{
+		V:     JSONSchemaVersion,
+		Type:  typ,
+		Ts:    hdr.Time(),
+		Pid:   hdr.Pid,
+		Tid:   hdr.Tid,
+		NsPid: hdr.NsPid,
+		NsTid: hdr.NsTid,
+		PidNs: hdr.PidNs,
+		Comm:  hdr.Comm,
+	}
+
+	if info, ok := j.containers.Lookup(hdr.CgroupID); ok {
+		out.Cgroup, out.ContainerID, out.Unit = info.Cgroup, info.ContainerID, info.Unit
+	}
+
+	return out
+}
@@ -0,0 +1,115 @@
+package output
+
+import (
+	"fmt"
+	"github.com/ebirukov/bstrace/pkg/container"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/stack"
+	"io"
+)
+
+// Writer - получатель декодированных событий, форматирующий их для вывода
+type Writer interface {
+	WriteEvent(ev event.SyscallEvent) error
+}
+
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatTemplate = "template"
+	FormatChrome   = "chrome"
+	FormatPprof    = "pprof"
+)
+
+// Options - параметры форматирования вывода
+type Options struct {
+	// Durations - выводить длительность системных вызовов
+	Durations bool
+	// Template - шаблон text/template для формата FormatTemplate
+	Template string
+	// Stacks - источник стеков. Форматы text и json выводят стеки, захваченные
+	// для события (strace -k), pprof строит по ним профиль.
+	Stacks *stack.Resolver
+	// Containers - источник сведений о контейнерах по cgroup событий
+	// для полей container_id и unit форматов json и template
+	Containers *container.Resolver
+}
+
+// New создаёт Writer для формата вывода format
+func New(format string, w io.Writer, opts Options) (Writer, error) {
+	switch format {
+	case FormatText:
+		s := NewStrace(w, opts.Durations)
+		s.stacks = opts.Stacks
+
+		return s, nil
+	case FormatJSON:
+		j := NewJSON(w)
+		j.stacks = opts.Stacks
+		j.containers = opts.Containers
+
+		return j, nil
+	case FormatTemplate:
+		t, err := NewTemplate(w, opts.Template)
+		if err != nil {
+			return nil, err
+		}
+
+		t.containers = opts.Containers
+
+		return t, nil
+	case FormatChrome:
+		return NewChrome(w), nil
+	case FormatPprof:
+		return NewPprof(w, opts.Stacks), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// NeedsEntry сообщает, использует ли формат события входа в системный вызов
+func NeedsEntry(format string) bool {
+	return format == FormatText
+}
+
+// NeedsStacks сообщает, использует ли формат стеки пользовательского пространства
+func NeedsStacks(format string) bool {
+	return format == FormatPprof
+}
+
+// userStack возвращает символизированный стек пользовательского пространства события
+func userStack(stacks *stack.Resolver, raw *event.Syscall) []stack.Frame {
+	if stacks == nil {
+		return nil
+	}
+
+	pcs, err := stacks.Stack(raw.UserStackID)
+	if err != nil {
+		return nil
+	}
+
+	return stacks.Symbolize(raw.Hdr.Pid, pcs)
+}
+
+// kernelStack возвращает символизированный стек ядра события
+func kernelStack(stacks *stack.Resolver, raw *event.Syscall) []stack.Frame {
+	if stacks == nil {
+		return nil
+	}
+
+	pcs, err := stacks.Stack(raw.KernelStackID)
+	if err != nil {
+		return nil
+	}
+
+	return stacks.SymbolizeKernel(pcs)
+}
+
+// Close завершает вывод для форматов, которым нужно дописать окончание
+func Close(w Writer) error {
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
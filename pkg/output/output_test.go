@@ -0,0 +1,187 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJSONWriteEvent(t *testing.T) {
+	event.SetBootTime(time.Unix(1700000000, 0).UTC())
+
+	ev := &event.OpenatEvent{
+		Syscall: event.Syscall{
+			Hdr:      event.Header{Ts: 1500, Pid: 10, Tid: 11, Comm: "cat", NsPid: 1, NsTid: 2, PidNs: 4026532305},
+			Nr:       257,
+			Args:     [6]uint64{0xffffff9c, 0x1000, 0x80000},
+			RetVal:   -2,
+			Duration: 2 * time.Microsecond,
+		},
+		Dirfd: -100,
+		Path:  "/etc/shadow",
+		Flags: 0x80000,
+	}
+
+	var buf bytes.Buffer
+	if err := NewJSON(&buf).WriteEvent(ev); err != nil {
+		t.Fatalf("WriteEvent failed: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json line %q: %v", buf.String(), err)
+	}
+
+	expected := map[string]any{
+		"v":       float64(JSONSchemaVersion),
+		"type":    "syscall",
+		"ts":      "2023-11-14T22:13:20.0000015Z",
+		"pid":     float64(10),
+		"tid":     float64(11),
+		"ns_pid":  float64(1),
+		"ns_tid":  float64(2),
+		"pidns":   float64(4026532305),
+		"comm":    "cat",
+		"syscall": "openat",
+		"nr":      float64(257),
+		"args": map[string]any{
+			"dirfd": float64(-100),
+			"path":  "/etc/shadow",
+			"flags": "O_RDONLY|O_CLOEXEC",
+			"mode":  float64(0),
+		},
+		"raw_args":    []any{float64(0xffffff9c), float64(0x1000), float64(0x80000), float64(0), float64(0), float64(0)},
+		"ret":         float64(-2),
+		"errno":       "ENOENT",
+		"duration_ns": float64(2000),
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected json event:\n  got:  %v\n  want: %v", got, expected)
+	}
+
+	if bytes.Count(buf.Bytes(), []byte("\n")) != 1 {
+		t.Errorf("event must be written as a single line: %q", buf.String())
+	}
+}
+
+func TestJSONWriteBuffer(t *testing.T) {
+	ev := &event.WriteEvent{
+		Syscall: event.Syscall{Nr: 1, Args: [6]uint64{1, 0x1000, 6}, RetVal: 6},
+		Fd:      1,
+		Buf:     []byte("a\\\xff\x00\n\""),
+		Count:   6,
+	}
+
+	var buf bytes.Buffer
+	if err := NewJSON(&buf).WriteEvent(ev); err != nil {
+		t.Fatalf("WriteEvent failed: %v", err)
+	}
+
+	var got struct {
+		Args map[string]any `json:"args"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json line %q: %v", buf.String(), err)
+	}
+
+	// байты, не являющиеся UTF-8, не заменяются на U+FFFD
+	if want := `a\\\xff\x00\n"`; got.Args["buf"] != want {
+		t.Errorf("buf = %q, want %q", got.Args["buf"], want)
+	}
+}
+
+func TestTemplateWriteEvent(t *testing.T) {
+	event.SetBootTime(time.Unix(1700000000, 0).UTC())
+
+	ev := &event.OpenatEvent{
+		Syscall: event.Syscall{
+			Hdr:      event.Header{Ts: 0, Pid: 10, Tid: 11, Comm: "cat"},
+			Args:     [6]uint64{0xffffff9c, 0x1000, 0x80000},
+			RetVal:   -13,
+			Duration: 1500 * time.Microsecond,
+		},
+		Dirfd: -100,
+		Path:  "/etc/shadow",
+		Flags: 0x80000,
+	}
+
+	const format = `{{.Time.Unix}} {{.Comm}}[{{.Pid}}] {{.Name}}({{index .Arg "path"}}, {{flags "open_flags" (index .RawArgs 2)}}, {{flags "open_flags" .Arg.flags}}) ` +
+		`{{.Ret}} {{errno .Ret}} ({{strerror .Ret}}) {{dur .Duration}} {{hex (index .RawArgs 2)}}`
+
+	w, err := NewTemplate(&bytes.Buffer{}, "{{.Unknown")
+	if err == nil {
+		t.Fatalf("expected template parse error, got writer %v", w)
+	}
+
+	var buf bytes.Buffer
+
+	w, err = NewTemplate(&buf, format)
+	if err != nil {
+		t.Fatalf("NewTemplate failed: %v", err)
+	}
+
+	if err := w.WriteEvent(ev); err != nil {
+		t.Fatalf("WriteEvent failed: %v", err)
+	}
+
+	expected := "1700000000 cat[10] openat(/etc/shadow, O_RDONLY|O_CLOEXEC, O_RDONLY|O_CLOEXEC) -13 EACCES (Permission denied) <0.001500> 0x80000\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n  got:  %q\n  want: %q", buf.String(), expected)
+	}
+
+	// разобранное значение другого набора флагов - ошибка
+	w, err = NewTemplate(&bytes.Buffer{}, `{{flags "clone_flags" .Arg.flags}}`)
+	if err != nil {
+		t.Fatalf("NewTemplate failed: %v", err)
+	}
+
+	if err := w.WriteEvent(ev); err == nil {
+		t.Error("expected error for flags of another set")
+	}
+}
+
+func TestChromeWriteEvent(t *testing.T) {
+	var buf bytes.Buffer
+
+	c := NewChrome(&buf)
+
+	for _, ev := range []event.SyscallEvent{
+		&event.CloseEvent{Syscall: event.Syscall{Hdr: event.Header{Ts: 2000, Pid: 10, Tid: 11, Comm: "worker"}, Nr: 3, Duration: 3 * time.Microsecond}, Fd: 4},
+		&event.CloseEvent{Syscall: event.Syscall{Hdr: event.Header{Ts: 5000, Pid: 10, Tid: 10, Comm: "srv"}, Nr: 3, RetVal: -9, Duration: time.Microsecond}, Fd: 5},
+	} {
+		if err := c.WriteEvent(ev); err != nil {
+			t.Fatalf("WriteEvent failed: %v", err)
+		}
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	var got []chromeEvent
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid trace %q: %v", buf.String(), err)
+	}
+
+	var names []string
+	for _, ev := range got {
+		names = append(names, ev.Ph+":"+ev.Name)
+	}
+
+	expected := []string{"M:thread_name", "M:process_name", "X:close", "M:thread_name", "M:process_name", "X:close"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("events = %v, want %v", names, expected)
+	}
+
+	if got[2].Ts != 2 || got[2].Dur != 3 || got[2].Tid != 11 {
+		t.Errorf("unexpected syscall event %+v", got[2])
+	}
+
+	if got[4].Args["name"] != "srv" || got[5].Args["errno"] != "EBADF" {
+		t.Errorf("unexpected events %+v %+v", got[4], got[5])
+	}
+}
@@ -0,0 +1,235 @@
+package output
+
+import (
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/pprof"
+	"github.com/ebirukov/bstrace/pkg/stack"
+	"io"
+	"time"
+)
+
+// Pprof накапливает время системных вызовов по стекам пользовательского
+// пространства и при закрытии записывает профиль pprof:
+//
+//	go tool pprof -top syscalls.pb.gz
+//
+// Вершиной каждого стека служит псевдофункция с именем системного вызова,
+// поэтому профиль показывает, из каких мест кода сделаны какие системные вызовы.
+// Сэмплы помечены метками pid, comm и syscall.
+type Pprof struct {
+	w      io.Writer
+	stacks *stack.Resolver
+	prof   pprof.Profile
+	// samples - сэмплы по процессу, стеку и системному вызову
+	samples   map[pprofSampleKey]*pprof.Sample
+	mappings  map[pprofMappingKey]*pprof.Mapping
+	locations map[pprofLocationKey]*pprof.Location
+	syscalls  map[string]*pprof.Location
+	functions map[pprofFunctionKey]*pprof.Function
+	// start и end - границы времени профиля
+	start, end time.Time
+}
+
+type pprofSampleKey struct {
+	pid     uint32
+	stackID int32
+	syscall string
+}
+
+type pprofMappingKey struct {
+	file          string
+	start, offset uint64
+}
+
+type pprofFunctionKey struct {
+	name, file string
+}
+
+type pprofLocationKey struct {
+	mapping *pprof.Mapping
+	addr    uint64
+}
+
+// NewPprof создаёт Pprof, получающий стеки из stacks. Без stacks профиль
+// содержит только системные вызовы.
+func NewPprof(w io.Writer, stacks *stack.Resolver) *Pprof {
+	return &Pprof{
+		w:      w,
+		stacks: stacks,
+		prof: pprof.Profile{
+			SampleTypes: []pprof.ValueType{
+				{Type: "syscalls", Unit: "count"},
+				{Type: "syscall_time", Unit: "nanoseconds"},
+			},
+			PeriodType:        pprof.ValueType{Type: "syscall_time", Unit: "nanoseconds"},
+			Period:            1,
+			DefaultSampleType: "syscall_time",
+		},
+		samples:   make(map[pprofSampleKey]*pprof.Sample),
+		mappings:  make(map[pprofMappingKey]*pprof.Mapping),
+		locations: make(map[pprofLocationKey]*pprof.Location),
+		syscalls:  make(map[string]*pprof.Location),
+		functions: make(map[pprofFunctionKey]*pprof.Function),
+	}
+}
+
+func (p *Pprof) WriteEvent(ev event.SyscallEvent) error {
+	raw := ev.Raw()
+	if !event.IsSyscall(ev) || raw.Entry {
+		return nil
+	}
+
+	hdr := ev.Header()
+
+	start := hdr.Time()
+	if p.start.IsZero() || start.Before(p.start) {
+		p.start = start
+	}
+
+	if end := start.Add(raw.Duration); end.After(p.end) {
+		p.end = end
+	}
+
+	key := pprofSampleKey{pid: hdr.Pid, stackID: raw.UserStackID, syscall: ev.Name()}
+
+	sample, ok := p.samples[key]
+	if !ok {
+		sample = &pprof.Sample{
+			Locations: append([]*pprof.Location{p.syscallLocation(ev.Name())}, p.stack(hdr.Pid, raw.UserStackID)...),
+			Values:    make([]int64, 2),
+			Labels: []pprof.Label{
+				{Key: "syscall", Str: ev.Name()},
+				{Key: "comm", Str: hdr.Comm},
+				{Key: "pid", Num: int64(hdr.Pid)},
+			},
+		}
+
+		p.samples[key] = sample
+		p.prof.Samples = append(p.prof.Samples, sample)
+	}
+
+	sample.Values[0]++
+	sample.Values[1] += raw.Duration.Nanoseconds()
+
+	return nil
+}
+
+// syscallLocation возвращает псевдофункцию системного вызова name
+func (p *Pprof) syscallLocation(name string) *pprof.Location {
+	if loc, ok := p.syscalls[name]; ok {
+		return loc
+	}
+
+	fn := p.function("syscall."+name, "")
+
+	loc := p.newLocation(nil, 0)
+	loc.Lines = []pprof.Line{{Function: fn}}
+	p.syscalls[name] = loc
+
+	return loc
+}
+
+// stack возвращает адреса стека id процесса pid в виде мест профиля
+func (p *Pprof) stack(pid uint32, id int32) []*pprof.Location {
+	if p.stacks == nil {
+		return nil
+	}
+
+	pcs, err := p.stacks.Stack(id)
+	if err != nil {
+		return nil
+	}
+
+	frames := p.stacks.Symbolize(pid, pcs)
+
+	locs := make([]*pprof.Location, 0, len(pcs))
+	for i, pc := range pcs {
+		var mapping *pprof.Mapping
+		if m, ok := p.stacks.Mapping(pid, pc); ok {
+			mapping = p.mapping(m)
+		}
+
+		key := pprofLocationKey{mapping: mapping, addr: pc}
+
+		loc, ok := p.locations[key]
+		if !ok {
+			loc = p.newLocation(mapping, pc)
+			p.locations[key] = loc
+
+			// символы, найденные при трассировке, избавляют pprof от поиска исполняемых файлов
+			if f := frames[i]; f.Func != "" {
+				loc.Lines = []pprof.Line{{Function: p.function(f.Func, f.Source), Line: int64(f.Line)}}
+
+				if mapping != nil {
+					mapping.HasFunctions = true
+				}
+			}
+		}
+
+		locs = append(locs, loc)
+	}
+
+	return locs
+}
+
+func (p *Pprof) function(name, file string) *pprof.Function {
+	key := pprofFunctionKey{name: name, file: file}
+	if fn, ok := p.functions[key]; ok {
+		return fn
+	}
+
+	fn := &pprof.Function{
+		ID:         uint64(len(p.prof.Functions) + 1),
+		Name:       name,
+		SystemName: name,
+		File:       file,
+	}
+
+	p.functions[key] = fn
+	p.prof.Functions = append(p.prof.Functions, fn)
+
+	return fn
+}
+
+func (p *Pprof) mapping(m *stack.Mapping) *pprof.Mapping {
+	key := pprofMappingKey{file: m.Path, start: m.Start, offset: m.Offset}
+	if mapping, ok := p.mappings[key]; ok {
+		return mapping
+	}
+
+	mapping := &pprof.Mapping{
+		ID:      uint64(len(p.prof.Mappings) + 1),
+		Start:   m.Start,
+		Limit:   m.Limit,
+		Offset:  m.Offset,
+		File:    m.Path,
+		BuildID: m.BuildID,
+	}
+
+	p.mappings[key] = mapping
+	p.prof.Mappings = append(p.prof.Mappings, mapping)
+
+	return mapping
+}
+
+func (p *Pprof) newLocation(mapping *pprof.Mapping, addr uint64) *pprof.Location {
+	loc := &pprof.Location{
+		ID:      uint64(len(p.prof.Locations) + 1),
+		Mapping: mapping,
+		Address: addr,
+	}
+
+	p.prof.Locations = append(p.prof.Locations, loc)
+
+	return loc
+}
+
+// Close записывает накопленный профиль
+func (p *Pprof) Close() error {
+	if !p.start.IsZero() {
+		p.prof.TimeNanos = p.start.UnixNano()
+		p.prof.DurationNanos = p.end.Sub(p.start).Nanoseconds()
+	}
+
+	return p.prof.Write(p.w)
+}
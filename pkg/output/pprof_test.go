@@ -0,0 +1,141 @@
+package output
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/ebirukov/bstrace/internal/testutil"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPprofWriteEvent(t *testing.T) {
+	event.SetBootTime(time.Unix(1700000000, 0).UTC())
+
+	var buf bytes.Buffer
+	p := NewPprof(&buf, nil)
+
+	for _, ts := range []uint64{1000, 5000} {
+		ev := &event.OpenatEvent{
+			Syscall: event.Syscall{
+				Hdr:         event.Header{Ts: ts, Pid: 10, Tid: 10, Comm: "cat"},
+				Nr:          257,
+				Duration:    1500 * time.Nanosecond,
+				UserStackID: -1,
+			},
+		}
+
+		if err := p.WriteEvent(ev); err != nil {
+			t.Fatalf("WriteEvent failed: %v", err)
+		}
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("profile is not gzipped: %v", err)
+	}
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("error reading gzip: %v", err)
+	}
+
+	fields := parseProto(t, data)
+
+	// поля profile.proto: sample = 2, string_table = 6, duration_nanos = 10
+	var strs []string
+	for _, f := range fields {
+		if f.Num == 6 {
+			strs = append(strs, string(f.Bytes))
+		}
+	}
+
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("string table must start with an empty string: %q", strs)
+	}
+
+	var samples [][]uint64
+	var duration uint64
+
+	for _, f := range fields {
+		switch f.Num {
+		case 2:
+			// поля sample: location_id = 1, value = 2, label = 3 (key = 1, str = 2)
+			labels := make(map[string]string)
+
+			for _, f := range parseProto(t, f.Bytes) {
+				switch f.Num {
+				case 1:
+					ids, err := f.Uints()
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if len(ids) != 1 {
+						t.Errorf("sample without stacks must have one syscall location: %v", ids)
+					}
+				case 2:
+					values, err := f.Uints()
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					samples = append(samples, values)
+				case 3:
+					var key, str uint64
+					for _, f := range parseProto(t, f.Bytes) {
+						switch f.Num {
+						case 1:
+							key = f.Varint
+						case 2:
+							str = f.Varint
+						}
+					}
+
+					labels[strs[key]] = strs[str]
+				}
+			}
+
+			if labels["syscall"] != "openat" || labels["comm"] != "cat" {
+				t.Errorf("unexpected sample labels: %v", labels)
+			}
+		case 10:
+			duration = f.Varint
+		}
+	}
+
+	// одинаковые вызовы из одного места складываются в один сэмпл: число и суммарное время
+	if want := [][]uint64{{2, 3000}}; !reflect.DeepEqual(samples, want) {
+		t.Errorf("samples: got %v, want %v", samples, want)
+	}
+
+	if duration != 5500 {
+		t.Errorf("duration: got %d, want 5500", duration)
+	}
+
+	var syscallFunc bool
+	for _, s := range strs {
+		syscallFunc = syscallFunc || s == "syscall.openat"
+	}
+
+	if !syscallFunc {
+		t.Errorf("string table has no syscall function: %q", strs)
+	}
+}
+
+func parseProto(t *testing.T, data []byte) []testutil.ProtoField {
+	t.Helper()
+
+	fields, err := testutil.ParseProto(data)
+	if err != nil {
+		t.Fatalf("invalid protobuf: %v", err)
+	}
+
+	return fields
+}
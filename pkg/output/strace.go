@@ -0,0 +1,230 @@
+package output
+
+import (
+	"fmt"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/stack"
+	"golang.org/x/sys/unix"
+	"io"
+	"strings"
+	"time"
+)
+
+// retColumn - колонка, с которой strace выводит возвращаемое значение (strace -a)
+const retColumn = 40
+
+// Strace выводит события в формате strace:
+//
+//	[pid  1234] openat(AT_FDCWD, "/etc/passwd", O_RDONLY|O_CLOEXEC) = 3 <0.000021>
+//
+// Начало строки печатается по событию входа в системный вызов. Если до выхода из него
+// приходит событие другого потока, строка завершается "<unfinished ...>", а результат
+// позже выводится отдельной строкой "<... name resumed>".
+// Завершение процесса выводится как "+++ exited with 1 +++" или "+++ killed by SIGSEGV +++",
+// а системный вызов, из которого поток не вернулся (exit_group), - с результатом "= ?".
+// Доставка сигнала выводится как "--- SIGCHLD {si_signo=SIGCHLD, si_code=CLD_EXITED, ...} ---".
+type Strace struct {
+	w    io.Writer
+	werr error
+	// col - текущая колонка в выводимой строке
+	col int
+	// durations - выводить длительность системного вызова (strace -T)
+	durations bool
+	// open - поток, строка системного вызова которого начата, но не завершена
+	open *event.Syscall
+	// pending - потоки, вошедшие в системный вызов и ещё не вышедшие из него
+	pending map[uint32]event.SyscallEvent
+	// stacks - источник стеков для вывода после строки системного вызова (strace -k)
+	stacks *stack.Resolver
+}
+
+func NewStrace(w io.Writer, durations bool) *Strace {
+	return &Strace{
+		w:         w,
+		durations: durations,
+		pending:   make(map[uint32]event.SyscallEvent),
+	}
+}
+
+func (s *Strace) WriteEvent(ev event.SyscallEvent) error {
+	switch e := ev.(type) {
+	case *event.ProcessEvent:
+		return s.writeProcess(e)
+	case *event.SignalEvent:
+		return s.writeSignal(e)
+	}
+
+	raw := ev.Raw()
+	tid := raw.Hdr.Tid
+
+	if s.open != nil && (s.open.Hdr.Tid != tid || raw.Entry) {
+		s.print(" <unfinished ...>\n")
+		s.open = nil
+	}
+
+	if raw.Entry {
+		s.pending[tid] = ev
+		s.open = raw
+
+		args := ev.FormatArgs()
+		enter := min(ev.EnterArgs(), len(args))
+
+		s.prefix(raw.Hdr.Tid, raw.Hdr.NsTid)
+		s.print(ev.Name() + "(" + strings.Join(args[:enter], ", "))
+		if enter > 0 && enter < len(args) {
+			s.print(", ")
+		}
+
+		return s.err()
+	}
+
+	args := ev.FormatArgs()
+	enter := min(ev.EnterArgs(), len(args))
+
+	switch _, entered := s.pending[tid]; {
+	case s.open != nil:
+		// строка начата на входе в системный вызов: дописываем выходные аргументы
+		s.print(strings.Join(args[enter:], ", "))
+	case entered:
+		s.prefix(raw.Hdr.Tid, raw.Hdr.NsTid)
+		s.print("<... " + ev.Name() + " resumed>" + strings.Join(args[enter:], ", "))
+	default:
+		// событие входа не получено: выводим строку целиком
+		s.prefix(raw.Hdr.Tid, raw.Hdr.NsTid)
+		s.print(ev.Name() + "(" + strings.Join(args, ", "))
+	}
+
+	delete(s.pending, tid)
+	s.open = nil
+
+	s.print(") ")
+	if s.col < retColumn {
+		s.print(strings.Repeat(" ", retColumn-s.col))
+	}
+
+	if raw.NoReturn {
+		s.print("= ?\n")
+
+		return s.err()
+	}
+
+	s.print("= " + formatRet(ev.Ret(), event.RetPtr(ev)))
+
+	if s.durations {
+		s.print(" " + formatDuration(raw.Duration))
+	}
+
+	s.print("\n")
+
+	// стек ядра продолжается стеком пользовательского пространства
+	for _, frame := range append(kernelStack(s.stacks, raw), userStack(s.stacks, raw)...) {
+		s.print(" > " + frame.String() + "\n")
+	}
+
+	return s.err()
+}
+
+// writeProcess выводит завершение процесса; запуск файлов и создание задач
+// видны по системным вызовам execve и clone и отдельно не выводятся
+func (s *Strace) writeProcess(ev *event.ProcessEvent) error {
+	if ev.Kind != event.ProcessExit {
+		return nil
+	}
+
+	s.unfinished()
+	s.prefix(ev.Hdr.Pid, ev.Hdr.NsPid)
+
+	switch code, exited := ev.ExitCode(); {
+	case exited:
+		s.print(fmt.Sprintf("+++ exited with %d +++\n", code))
+	default:
+		sig, _ := ev.Signal()
+
+		core := ""
+		if ev.CoreDumped() {
+			core = " (core dumped)"
+		}
+
+		s.print(fmt.Sprintf("+++ killed by %s%s +++\n", unix.SignalName(sig), core))
+	}
+
+	return s.err()
+}
+
+// writeSignal выводит доставку сигнала; отправка сигнала видна по системным
+// вызовам kill и tgkill и отдельно не выводится
+func (s *Strace) writeSignal(ev *event.SignalEvent) error {
+	if ev.Kind != event.SignalDeliver {
+		return nil
+	}
+
+	s.unfinished()
+	s.prefix(ev.Hdr.Tid, ev.Hdr.NsTid)
+	s.print(fmt.Sprintf("--- %s %s ---\n", unix.SignalName(ev.Signal), event.FormatSiginfo(ev.Info)))
+
+	return s.err()
+}
+
+// unfinished завершает начатую строку системного вызова перед строкой другого события
+func (s *Strace) unfinished() {
+	if s.open != nil {
+		s.print(" <unfinished ...>\n")
+		s.open = nil
+	}
+}
+
+// prefix выводит идентификатор потока; для задач в другом пространстве имён PID
+// (например, в контейнере) в угловых скобках добавляется их собственный идентификатор:
+//
+//	[pid  4321<7>] read(3, ...
+func (s *Strace) prefix(id, nsID uint32) {
+	if nsID != 0 && nsID != id {
+		s.print(fmt.Sprintf("[pid %5d<%d>] ", id, nsID))
+
+		return
+	}
+
+	s.print(fmt.Sprintf("[pid %5d] ", id))
+}
+
+func (s *Strace) print(str string) {
+	if i := strings.LastIndexByte(str, '\n'); i >= 0 {
+		s.col = len(str) - i - 1
+	} else {
+		s.col += len(str)
+	}
+
+	if _, err := io.WriteString(s.w, str); err != nil && s.werr == nil {
+		s.werr = err
+	}
+}
+
+func (s *Strace) err() error {
+	err := s.werr
+	s.werr = nil
+
+	return err
+}
+
+// formatRet форматирует возвращаемое значение как strace: "3", "0x7f1c2a000000",
+// "-1 ENOENT (No such file or directory)"; ptr - системный вызов возвращает адрес
+func formatRet(ret int64, ptr bool) string {
+	errno, ok := event.Errno(ret)
+	switch {
+	case !ok && ptr:
+		return fmt.Sprintf("%#x", uint64(ret))
+	case !ok:
+		return fmt.Sprintf("%d", ret)
+	}
+
+	if event.IsKernelErrno(errno) {
+		return fmt.Sprintf("? %s (%s)", event.ErrnoName(errno), event.ErrnoMessage(errno))
+	}
+
+	return fmt.Sprintf("-1 %s (%s)", event.ErrnoName(errno), event.ErrnoMessage(errno))
+}
+
+// formatDuration форматирует длительность как strace -T: <0.000021>
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("<%d.%06d>", d/time.Second, (d%time.Second)/time.Microsecond)
+}
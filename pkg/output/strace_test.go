@@ -0,0 +1,184 @@
+package output
+
+import (
+	"bytes"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"github.com/ebirukov/bstrace/pkg/sysdesc"
+	"golang.org/x/sys/unix"
+	"testing"
+	"time"
+)
+
+func TestStraceInterleavedThreads(t *testing.T) {
+	read := func(entry bool) event.SyscallEvent {
+		ev := &event.ReadEvent{
+			Syscall: event.Syscall{
+				Entry: entry,
+				Hdr:   event.Header{Pid: 100, Tid: 100},
+				Args:  [6]uint64{3, 0x1000, 10},
+			},
+			Fd:    3,
+			Count: 10,
+		}
+
+		if !entry {
+			ev.RetVal, ev.Duration, ev.Buf = 4, 1500*time.Millisecond, []byte("data")
+		}
+
+		return ev
+	}
+
+	openat := func(entry bool) event.SyscallEvent {
+		ev := &event.OpenatEvent{
+			Syscall: event.Syscall{
+				Entry: entry,
+				Hdr:   event.Header{Pid: 100, Tid: 101},
+			},
+			Dirfd: -100,
+			Path:  "/etc/hosts",
+		}
+
+		if !entry {
+			ev.RetVal, ev.Duration = 4, 15*time.Microsecond
+		}
+
+		return ev
+	}
+
+	closeEv := &event.CloseEvent{
+		Syscall: event.Syscall{
+			Hdr:      event.Header{Pid: 102, Tid: 102},
+			RetVal:   -9,
+			Duration: time.Microsecond,
+		},
+		Fd: 5,
+	}
+
+	events := []event.SyscallEvent{
+		read(true),
+		openat(true),
+		openat(false),
+		read(false),
+		closeEv,
+	}
+
+	expected := `[pid   100] read(3,  <unfinished ...>
+[pid   101] openat(AT_FDCWD, "/etc/hosts", O_RDONLY) = 4 <0.000015>
+[pid   100] <... read resumed>"data", 10) = 4 <1.500000>
+[pid   102] close(5)                    = -1 EBADF (Bad file descriptor) <0.000001>
+`
+
+	var buf bytes.Buffer
+
+	w := NewStrace(&buf, true)
+	for _, ev := range events {
+		if err := w.WriteEvent(ev); err != nil {
+			t.Fatalf("WriteEvent failed: %v", err)
+		}
+	}
+
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n  got:\n%s\n  want:\n%s", buf.String(), expected)
+	}
+}
+
+func TestFormatRet(t *testing.T) {
+	tests := []struct {
+		ret      int64
+		ptr      bool
+		expected string
+	}{
+		{0, false, "0"},
+		{42, false, "42"},
+		{-2, false, "-1 ENOENT (No such file or directory)"},
+		{-512, false, "? ERESTARTSYS (To be restarted if SA_RESTART is set)"},
+		{0x55d4c6a3b000, true, "0x55d4c6a3b000"},
+		{-12, true, "-1 ENOMEM (Cannot allocate memory)"},
+	}
+
+	for _, tt := range tests {
+		if got := formatRet(tt.ret, tt.ptr); got != tt.expected {
+			t.Errorf("formatRet(%d, %v) = %q, want %q", tt.ret, tt.ptr, got, tt.expected)
+		}
+	}
+}
+
+func TestStraceProcessExit(t *testing.T) {
+	exitGroup := func(entry bool) event.SyscallEvent {
+		return &event.GenericEvent{
+			Syscall: event.Syscall{
+				Entry:    entry,
+				NoReturn: !entry,
+				Hdr:      event.Header{Pid: 100, Tid: 100},
+				Args:     [6]uint64{1},
+			},
+			Desc: &sysdesc.Syscall{Name: "exit_group", Args: []sysdesc.Arg{{Name: "error_code", Kind: sysdesc.KindInt}}},
+		}
+	}
+
+	events := []event.SyscallEvent{
+		&event.ProcessEvent{Syscall: event.Syscall{Hdr: event.Header{Pid: 100, Tid: 100}}, Kind: event.ProcessExec, Filename: "/bin/false"},
+		exitGroup(true),
+		exitGroup(false),
+		&event.ProcessEvent{Syscall: event.Syscall{Hdr: event.Header{Pid: 100, Tid: 100}}, Kind: event.ProcessExit, Status: 1 << 8},
+		&event.ProcessEvent{Syscall: event.Syscall{Hdr: event.Header{Pid: 200, Tid: 201}}, Kind: event.ProcessExit, Status: 11 | 0x80},
+	}
+
+	expected := `[pid   100] exit_group(1)               = ?
+[pid   100] +++ exited with 1 +++
+[pid   200] +++ killed by SIGSEGV (core dumped) +++
+`
+
+	var buf bytes.Buffer
+
+	w := NewStrace(&buf, true)
+	for _, ev := range events {
+		if err := w.WriteEvent(ev); err != nil {
+			t.Fatalf("WriteEvent failed: %v", err)
+		}
+	}
+
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n  got:\n%s\n  want:\n%s", buf.String(), expected)
+	}
+}
+
+func TestStraceSignal(t *testing.T) {
+	read := &event.ReadEvent{
+		Syscall: event.Syscall{
+			Entry: true,
+			Hdr:   event.Header{Pid: 100, Tid: 100},
+			Args:  [6]uint64{0, 0x1000, 10},
+		},
+		Count: 10,
+	}
+
+	deliver := &event.SignalEvent{
+		Syscall: event.Syscall{Hdr: event.Header{Pid: 100, Tid: 101}},
+		Kind:    event.SignalDeliver,
+		Signal:  unix.SIGTERM,
+		Info: []event.Arg{
+			{Name: "si_signo", Value: "SIGTERM"},
+			{Name: "si_code", Value: "SI_USER"},
+			{Name: "si_pid", Value: int32(1)},
+			{Name: "si_uid", Value: uint32(0)},
+		},
+	}
+
+	expected := `[pid   100] read(0,  <unfinished ...>
+[pid   101] --- SIGTERM {si_signo=SIGTERM, si_code=SI_USER, si_pid=1, si_uid=0} ---
+`
+
+	var buf bytes.Buffer
+
+	w := NewStrace(&buf, false)
+	for _, ev := range []event.SyscallEvent{read, deliver} {
+		if err := w.WriteEvent(ev); err != nil {
+			t.Fatalf("WriteEvent failed: %v", err)
+		}
+	}
+
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n  got:\n%s\n  want:\n%s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,217 @@
+package output
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/ebirukov/bstrace/pkg/container"
+	"github.com/ebirukov/bstrace/pkg/event"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateEvent - данные события, доступные в шаблоне --format
+type TemplateEvent struct {
+	Time time.Time
+	Pid  uint32
+	Tid  uint32
+	// NsPid и NsTid - идентификаторы в пространстве имён PID задачи
+	NsPid uint32
+	NsTid uint32
+	PidNs uint32
+	Comm  string
+	// Cgroup, ContainerID и Unit - cgroup задачи и определённые по ней контейнер и юнит systemd
+	Cgroup      string
+	ContainerID string
+	Unit        string
+	Name        string
+	Nr          uint32
+	Ret         int64
+	Duration    time.Duration
+	// Args - аргументы, отформатированные как в strace
+	Args []string
+	// Arg - разобранные значения аргументов по именам
+	Arg map[string]any
+	// RawArgs - значения регистров аргументов
+	RawArgs [6]uint64
+	// Event - исходное типизированное событие
+	Event event.SyscallEvent
+}
+
+// TemplateFuncs - вспомогательные функции, доступные в шаблоне --format:
+//
+//	errno RET        символьный код ошибки (ENOENT) или пустая строка при успехе
+//	strerror RET     описание ошибки или пустая строка при успехе
+//	flags SET VALUE  символьные флаги из набора (например, "open_flags"): VALUE -
+//	                 число (.RawArgs) или уже разобранное значение (.Arg)
+//	hex VALUE        число в шестнадцатеричном виде
+//	hexdump BYTES    шестнадцатеричный дамп буфера
+//	quote VALUE      строка или буфер в экранированном виде как в strace
+//	dur DURATION     длительность в секундах как в strace -T
+//	join LIST SEP    объединение списка строк
+var TemplateFuncs = template.FuncMap{
+	"errno":    tmplErrno,
+	"strerror": tmplStrerror,
+	"flags":    tmplFlags,
+	"hex":      tmplHex,
+	"hexdump":  tmplHexdump,
+	"quote":    tmplQuote,
+	"dur":      formatDuration,
+	"join":     strings.Join,
+}
+
+// Template выводит события системных вызовов по пользовательскому шаблону
+// text/template; события процессов и сигналов не выводятся
+type Template struct {
+	w    io.Writer
+	tmpl *template.Template
+	// containers - источник полей Cgroup, ContainerID и Unit
+	containers *container.Resolver
+}
+
+// NewTemplate разбирает шаблон вывода. Если шаблон не заканчивается переводом строки,
+// он добавляется после каждого события.
+func NewTemplate(w io.Writer, text string) (*Template, error) {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+
+	tmpl, err := template.New("format").Funcs(TemplateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing output template: %w", err)
+	}
+
+	return &Template{w: w, tmpl: tmpl}, nil
+}
+
+func (t *Template) WriteEvent(ev event.SyscallEvent) error {
+	raw := ev.Raw()
+	if !event.IsSyscall(ev) || raw.Entry {
+		return nil
+	}
+
+	data := TemplateEvent{
+		Time:     raw.Hdr.Time(),
+		Pid:      raw.Hdr.Pid,
+		Tid:      raw.Hdr.Tid,
+		NsPid:    raw.Hdr.NsPid,
+		NsTid:    raw.Hdr.NsTid,
+		PidNs:    raw.Hdr.PidNs,
+		Comm:     raw.Hdr.Comm,
+		Name:     ev.Name(),
+		Nr:       raw.Nr,
+		Ret:      ev.Ret(),
+		Duration: raw.Duration,
+		Args:     ev.FormatArgs(),
+		Arg:      make(map[string]any),
+		RawArgs:  raw.Args,
+		Event:    ev,
+	}
+
+	for _, arg := range ev.DecodedArgs() {
+		data.Arg[arg.Name] = arg.Value
+	}
+
+	if info, ok := t.containers.Lookup(raw.Hdr.CgroupID); ok {
+		data.Cgroup, data.ContainerID, data.Unit = info.Cgroup, info.ContainerID, info.Unit
+	}
+
+	if err := t.tmpl.Execute(t.w, &data); err != nil {
+		return fmt.Errorf("error executing output template: %w", err)
+	}
+
+	return nil
+}
+
+func tmplErrno(ret int64) string {
+	if errno, ok := event.Errno(ret); ok {
+		return event.ErrnoName(errno)
+	}
+
+	return ""
+}
+
+func tmplStrerror(ret int64) string {
+	if errno, ok := event.Errno(ret); ok {
+		return event.ErrnoMessage(errno)
+	}
+
+	return ""
+}
+
+func tmplFlags(set string, v any) (string, error) {
+	fs, ok := event.LookupFlagSet(set)
+	if !ok {
+		return "", fmt.Errorf("unknown flags set %q", set)
+	}
+
+	// значения DecodedArgs уже отформатированы: проверяем, что они из того же набора
+	if s, ok := v.(string); ok {
+		n, err := fs.Parse(s)
+		if err != nil {
+			return "", fmt.Errorf("flags %s: %w", set, err)
+		}
+
+		return fs.Format(n), nil
+	}
+
+	n, err := toUint64(v)
+	if err != nil {
+		return "", err
+	}
+
+	return fs.Format(n), nil
+}
+
+func tmplHex(v any) (string, error) {
+	n, err := toUint64(v)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%#x", n), nil
+}
+
+func tmplHexdump(v any) (string, error) {
+	switch b := v.(type) {
+	case []byte:
+		return hex.Dump(b), nil
+	case event.Buffer:
+		return hex.Dump(b), nil
+	case string:
+		return hex.Dump([]byte(b)), nil
+	default:
+		return "", fmt.Errorf("hexdump: unsupported type %T", v)
+	}
+}
+
+func tmplQuote(v any) (string, error) {
+	switch b := v.(type) {
+	case []byte:
+		return event.Quote(b, event.StrLimit, false), nil
+	case event.Buffer:
+		return event.Quote(b, event.StrLimit, false), nil
+	case string:
+		return event.Quote([]byte(b), len(b), false), nil
+	default:
+		return "", fmt.Errorf("quote: unsupported type %T", v)
+	}
+}
+
+func toUint64(v any) (uint64, error) {
+	switch n := v.(type) {
+	case uint64:
+		return n, nil
+	case uint32:
+		return uint64(n), nil
+	case int64:
+		return uint64(n), nil
+	case int32:
+		return uint64(n), nil
+	case int:
+		return uint64(n), nil
+	default:
+		return 0, fmt.Errorf("expected integer, got %T", v)
+	}
+}
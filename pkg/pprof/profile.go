@@ -0,0 +1,266 @@
+// Package pprof кодирует профили в формате pprof (profile.proto),
+// который читает `go tool pprof`.
+package pprof
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// ValueType - тип и единица измерения значения
+type ValueType struct {
+	Type string
+	Unit string
+}
+
+// Label - метка сэмпла: строковая или числовая
+type Label struct {
+	Key  string
+	Str  string
+	Num  int64
+	Unit string
+}
+
+// Sample - значения, накопленные для одного стека
+type Sample struct {
+	// Locations - стек от вершины (места вызова) к корню
+	Locations []*Location
+	Values    []int64
+	Labels    []Label
+}
+
+// Mapping - отображение исполняемого файла в адресное пространство процесса
+type Mapping struct {
+	ID     uint64
+	Start  uint64
+	Limit  uint64
+	Offset uint64
+	File   string
+	// BuildID - идентификатор сборки, по которому pprof ищет исполняемый файл
+	BuildID      string
+	HasFunctions bool
+}
+
+// Line - функция и строка исходного кода, соответствующие адресу
+type Line struct {
+	Function *Function
+	Line     int64
+}
+
+// Location - адрес в стеке
+type Location struct {
+	ID      uint64
+	Mapping *Mapping
+	Address uint64
+	// Lines - функции по адресу, начиная с самой глубокой встроенной
+	Lines []Line
+}
+
+// Function - функция исходного кода
+type Function struct {
+	ID         uint64
+	Name       string
+	SystemName string
+	File       string
+	StartLine  int64
+}
+
+// Profile - профиль, описания полей соответствуют profile.proto
+type Profile struct {
+	SampleTypes []ValueType
+	Samples     []*Sample
+	Mappings    []*Mapping
+	Locations   []*Location
+	Functions   []*Function
+	// TimeNanos - время начала сбора профиля
+	TimeNanos int64
+	// DurationNanos - длительность сбора профиля
+	DurationNanos     int64
+	PeriodType        ValueType
+	Period            int64
+	Comments          []string
+	DefaultSampleType string
+}
+
+// Поля сообщений profile.proto
+const (
+	profileSampleType        = 1
+	profileSample            = 2
+	profileMapping           = 3
+	profileLocation          = 4
+	profileFunction          = 5
+	profileStringTable       = 6
+	profileTimeNanos         = 9
+	profileDurationNanos     = 10
+	profilePeriodType        = 11
+	profilePeriod            = 12
+	profileComment           = 13
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+	sampleLabel      = 3
+
+	labelKey     = 1
+	labelStr     = 2
+	labelNum     = 3
+	labelNumUnit = 4
+
+	mappingID           = 1
+	mappingMemoryStart  = 2
+	mappingMemoryLimit  = 3
+	mappingFileOffset   = 4
+	mappingFilename     = 5
+	mappingBuildID      = 6
+	mappingHasFunctions = 7
+
+	locationID        = 1
+	locationMappingID = 2
+	locationAddress   = 3
+	locationLine      = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+// stringTable - таблица строк профиля, первая строка всегда пустая
+type stringTable struct {
+	list  []string
+	index map[string]int64
+}
+
+func (s *stringTable) id(str string) int64 {
+	if id, ok := s.index[str]; ok {
+		return id
+	}
+
+	id := int64(len(s.list))
+	s.list = append(s.list, str)
+	s.index[str] = id
+
+	return id
+}
+
+// Write записывает профиль в w в сжатом gzip виде, как его пишет runtime/pprof
+func (p *Profile) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+
+	if _, err := zw.Write(p.Marshal()); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// Marshal кодирует профиль в protobuf
+func (p *Profile) Marshal() []byte {
+	var b buffer
+
+	strs := &stringTable{list: []string{""}, index: map[string]int64{"": 0}}
+
+	valueType := func(field int, vt ValueType) {
+		b.message(field, func(b *buffer) {
+			b.int64(valueTypeType, strs.id(vt.Type))
+			b.int64(valueTypeUnit, strs.id(vt.Unit))
+		})
+	}
+
+	for _, st := range p.SampleTypes {
+		valueType(profileSampleType, st)
+	}
+
+	for _, s := range p.Samples {
+		b.message(profileSample, func(b *buffer) {
+			ids := make([]uint64, len(s.Locations))
+			for i, loc := range s.Locations {
+				ids[i] = loc.ID
+			}
+
+			b.packedUint64(sampleLocationID, ids)
+			b.packedInt64(sampleValue, s.Values)
+
+			for _, l := range s.Labels {
+				b.message(sampleLabel, func(b *buffer) {
+					b.int64(labelKey, strs.id(l.Key))
+					b.int64(labelStr, strs.id(l.Str))
+					b.int64(labelNum, l.Num)
+					b.int64(labelNumUnit, strs.id(l.Unit))
+				})
+			}
+		})
+	}
+
+	for _, m := range p.Mappings {
+		b.message(profileMapping, func(b *buffer) {
+			b.uint64(mappingID, m.ID)
+			b.uint64(mappingMemoryStart, m.Start)
+			b.uint64(mappingMemoryLimit, m.Limit)
+			b.uint64(mappingFileOffset, m.Offset)
+			b.int64(mappingFilename, strs.id(m.File))
+			b.int64(mappingBuildID, strs.id(m.BuildID))
+			b.bool(mappingHasFunctions, m.HasFunctions)
+		})
+	}
+
+	for _, loc := range p.Locations {
+		b.message(profileLocation, func(b *buffer) {
+			b.uint64(locationID, loc.ID)
+
+			if loc.Mapping != nil {
+				b.uint64(locationMappingID, loc.Mapping.ID)
+			}
+
+			b.uint64(locationAddress, loc.Address)
+
+			for _, line := range loc.Lines {
+				b.message(locationLine, func(b *buffer) {
+					b.uint64(lineFunctionID, line.Function.ID)
+					b.int64(lineLine, line.Line)
+				})
+			}
+		})
+	}
+
+	for _, fn := range p.Functions {
+		b.message(profileFunction, func(b *buffer) {
+			b.uint64(functionID, fn.ID)
+			b.int64(functionName, strs.id(fn.Name))
+			b.int64(functionSystemName, strs.id(fn.SystemName))
+			b.int64(functionFilename, strs.id(fn.File))
+			b.int64(functionStartLine, fn.StartLine)
+		})
+	}
+
+	b.int64(profileTimeNanos, p.TimeNanos)
+	b.int64(profileDurationNanos, p.DurationNanos)
+
+	if p.PeriodType.Type != "" {
+		valueType(profilePeriodType, p.PeriodType)
+	}
+
+	b.int64(profilePeriod, p.Period)
+
+	for _, c := range p.Comments {
+		b.int64(profileComment, strs.id(c))
+	}
+
+	if p.DefaultSampleType != "" {
+		b.int64(profileDefaultSampleType, strs.id(p.DefaultSampleType))
+	}
+
+	// таблица строк заполняется при кодировании остальных полей, поэтому пишется последней
+	for _, s := range strs.list {
+		b.bytes(profileStringTable, []byte(s))
+	}
+
+	return b.data
+}
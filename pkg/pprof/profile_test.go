@@ -0,0 +1,267 @@
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/ebirukov/bstrace/internal/testutil"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestProfileRoundTrip(t *testing.T) {
+	mapping := &Mapping{ID: 1, Start: 0x400000, Limit: 0x452000, Offset: 0x1000, File: "/usr/bin/cat", BuildID: "abcdef", HasFunctions: true}
+	read := &Function{ID: 1, Name: "syscall.read", SystemName: "syscall.read"}
+	main := &Function{ID: 2, Name: "main", SystemName: "main", File: "cat.c", StartLine: 10}
+
+	readLoc := &Location{ID: 1, Lines: []Line{{Function: read}}}
+	mainLoc := &Location{ID: 2, Mapping: mapping, Address: 0x401234, Lines: []Line{{Function: main, Line: 42}}}
+	rawLoc := &Location{ID: 3, Mapping: mapping, Address: 0x405678}
+
+	want := &Profile{
+		SampleTypes: []ValueType{{Type: "syscalls", Unit: "count"}, {Type: "syscall_time", Unit: "nanoseconds"}},
+		Samples: []*Sample{
+			{
+				Locations: []*Location{readLoc, mainLoc, rawLoc},
+				Values:    []int64{3, 1500},
+				Labels:    []Label{{Key: "syscall", Str: "read"}, {Key: "pid", Num: 10}, {Key: "size", Num: 4096, Unit: "bytes"}},
+			},
+			{
+				Locations: []*Location{readLoc},
+				Values:    []int64{1, 0},
+			},
+		},
+		Mappings:          []*Mapping{mapping},
+		Locations:         []*Location{readLoc, mainLoc, rawLoc},
+		Functions:         []*Function{read, main},
+		TimeNanos:         1700000000000000000,
+		DurationNanos:     2000000000,
+		PeriodType:        ValueType{Type: "syscall_time", Unit: "nanoseconds"},
+		Period:            1,
+		Comments:          []string{"bstrace"},
+		DefaultSampleType: "syscall_time",
+	}
+
+	var buf bytes.Buffer
+	if err := want.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("profile is not gzipped: %v", err)
+	}
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("error reading gzip: %v", err)
+	}
+
+	got := unmarshalProfile(t, data)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip mismatch:\n  got:  %+v\n  want: %+v", got, want)
+	}
+}
+
+// unmarshalProfile разбирает profile.proto в Profile, проверяя, что таблица
+// строк начинается с пустой строки, а поля сэмплов упакованы
+func unmarshalProfile(t *testing.T, data []byte) *Profile {
+	t.Helper()
+
+	fields := parse(t, data)
+
+	var strs []string
+	for _, f := range fields {
+		if f.Num == profileStringTable {
+			strs = append(strs, string(f.Bytes))
+		}
+	}
+
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("string table must start with an empty string: %q", strs)
+	}
+
+	str := func(id uint64) string {
+		if id >= uint64(len(strs)) {
+			t.Fatalf("string index %d out of range %d", id, len(strs))
+		}
+
+		return strs[id]
+	}
+
+	valueType := func(data []byte) ValueType {
+		var vt ValueType
+		for _, f := range parse(t, data) {
+			switch f.Num {
+			case valueTypeType:
+				vt.Type = str(f.Varint)
+			case valueTypeUnit:
+				vt.Unit = str(f.Varint)
+			}
+		}
+
+		return vt
+	}
+
+	p := &Profile{}
+
+	functions := make(map[uint64]*Function)
+	mappings := make(map[uint64]*Mapping)
+
+	// функции и отображения нужны для мест, а места - для сэмплов
+	for _, f := range fields {
+		switch f.Num {
+		case profileFunction:
+			fn := &Function{}
+			for _, f := range parse(t, f.Bytes) {
+				switch f.Num {
+				case functionID:
+					fn.ID = f.Varint
+				case functionName:
+					fn.Name = str(f.Varint)
+				case functionSystemName:
+					fn.SystemName = str(f.Varint)
+				case functionFilename:
+					fn.File = str(f.Varint)
+				case functionStartLine:
+					fn.StartLine = int64(f.Varint)
+				}
+			}
+
+			functions[fn.ID] = fn
+			p.Functions = append(p.Functions, fn)
+		case profileMapping:
+			m := &Mapping{}
+			for _, f := range parse(t, f.Bytes) {
+				switch f.Num {
+				case mappingID:
+					m.ID = f.Varint
+				case mappingMemoryStart:
+					m.Start = f.Varint
+				case mappingMemoryLimit:
+					m.Limit = f.Varint
+				case mappingFileOffset:
+					m.Offset = f.Varint
+				case mappingFilename:
+					m.File = str(f.Varint)
+				case mappingBuildID:
+					m.BuildID = str(f.Varint)
+				case mappingHasFunctions:
+					m.HasFunctions = f.Varint != 0
+				}
+			}
+
+			mappings[m.ID] = m
+			p.Mappings = append(p.Mappings, m)
+		}
+	}
+
+	locations := make(map[uint64]*Location)
+
+	for _, f := range fields {
+		if f.Num != profileLocation {
+			continue
+		}
+
+		loc := &Location{}
+		for _, f := range parse(t, f.Bytes) {
+			switch f.Num {
+			case locationID:
+				loc.ID = f.Varint
+			case locationMappingID:
+				loc.Mapping = mappings[f.Varint]
+			case locationAddress:
+				loc.Address = f.Varint
+			case locationLine:
+				var line Line
+				for _, f := range parse(t, f.Bytes) {
+					switch f.Num {
+					case lineFunctionID:
+						line.Function = functions[f.Varint]
+					case lineLine:
+						line.Line = int64(f.Varint)
+					}
+				}
+
+				loc.Lines = append(loc.Lines, line)
+			}
+		}
+
+		locations[loc.ID] = loc
+		p.Locations = append(p.Locations, loc)
+	}
+
+	for _, f := range fields {
+		switch f.Num {
+		case profileSampleType:
+			p.SampleTypes = append(p.SampleTypes, valueType(f.Bytes))
+		case profileSample:
+			s := &Sample{}
+			for _, f := range parse(t, f.Bytes) {
+				switch f.Num {
+				case sampleLocationID, sampleValue:
+					if f.Wire != testutil.WireBytes {
+						t.Errorf("sample field %d is not packed", f.Num)
+					}
+
+					vs, err := f.Uints()
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					for _, v := range vs {
+						if f.Num == sampleLocationID {
+							s.Locations = append(s.Locations, locations[v])
+						} else {
+							s.Values = append(s.Values, int64(v))
+						}
+					}
+				case sampleLabel:
+					var l Label
+					for _, f := range parse(t, f.Bytes) {
+						switch f.Num {
+						case labelKey:
+							l.Key = str(f.Varint)
+						case labelStr:
+							l.Str = str(f.Varint)
+						case labelNum:
+							l.Num = int64(f.Varint)
+						case labelNumUnit:
+							l.Unit = str(f.Varint)
+						}
+					}
+
+					s.Labels = append(s.Labels, l)
+				}
+			}
+
+			p.Samples = append(p.Samples, s)
+		case profileTimeNanos:
+			p.TimeNanos = int64(f.Varint)
+		case profileDurationNanos:
+			p.DurationNanos = int64(f.Varint)
+		case profilePeriodType:
+			p.PeriodType = valueType(f.Bytes)
+		case profilePeriod:
+			p.Period = int64(f.Varint)
+		case profileComment:
+			p.Comments = append(p.Comments, str(f.Varint))
+		case profileDefaultSampleType:
+			p.DefaultSampleType = str(f.Varint)
+		}
+	}
+
+	return p
+}
+
+func parse(t *testing.T, data []byte) []testutil.ProtoField {
+	t.Helper()
+
+	fields, err := testutil.ParseProto(data)
+	if err != nil {
+		t.Fatalf("invalid protobuf: %v", err)
+	}
+
+	return fields
+}
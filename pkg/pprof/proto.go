@@ -0,0 +1,84 @@
+package pprof
+
+import (
+	"encoding/binary"
+)
+
+// Типы полей protobuf (wire type)
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// buffer - минимальный кодировщик protobuf, достаточный для profile.proto
+type buffer struct {
+	data []byte
+}
+
+func (b *buffer) varint(v uint64) {
+	b.data = binary.AppendUvarint(b.data, v)
+}
+
+func (b *buffer) key(field, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (b *buffer) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	b.key(field, wireVarint)
+	b.varint(v)
+}
+
+func (b *buffer) int64(field int, v int64) {
+	b.uint64(field, uint64(v))
+}
+
+func (b *buffer) bool(field int, v bool) {
+	if v {
+		b.uint64(field, 1)
+	}
+}
+
+func (b *buffer) bytes(field int, v []byte) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(v)))
+	b.data = append(b.data, v...)
+}
+
+// packedUint64 кодирует повторяющееся поле в упакованном виде
+func (b *buffer) packedUint64(field int, vs []uint64) {
+	if len(vs) == 0 {
+		return
+	}
+
+	var packed buffer
+	for _, v := range vs {
+		packed.varint(v)
+	}
+
+	b.bytes(field, packed.data)
+}
+
+func (b *buffer) packedInt64(field int, vs []int64) {
+	if len(vs) == 0 {
+		return
+	}
+
+	var packed buffer
+	for _, v := range vs {
+		packed.varint(uint64(v))
+	}
+
+	b.bytes(field, packed.data)
+}
+
+// message кодирует вложенное сообщение
+func (b *buffer) message(field int, encode func(b *buffer)) {
+	var msg buffer
+	encode(&msg)
+
+	b.bytes(field, msg.data)
+}
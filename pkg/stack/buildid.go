@@ -0,0 +1,71 @@
+package stack
+
+import (
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+)
+
+// Типы ELF notes с идентификатором сборки
+const (
+	noteGNUBuildID = 3
+	noteGoBuildID  = 4
+)
+
+// BuildID возвращает идентификатор сборки ELF файла: GNU build ID
+// (.note.gnu.build-id) в hex или, если его нет, Go build ID (.note.go.buildid)
+func BuildID(path string) (string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if id, ok := readNote(f, ".note.gnu.build-id", "GNU", noteGNUBuildID); ok {
+		return hex.EncodeToString(id), nil
+	}
+
+	if id, ok := readNote(f, ".note.go.buildid", "Go", noteGoBuildID); ok {
+		return string(id), nil
+	}
+
+	return "", errors.New("no build id")
+}
+
+// readNote читает описание ELF note с именем name и типом typ из секции section
+func readNote(f *elf.File, section, name string, typ uint32) ([]byte, bool) {
+	s := f.Section(section)
+	if s == nil {
+		return nil, false
+	}
+
+	data, err := s.Data()
+	if err != nil {
+		return nil, false
+	}
+
+	for len(data) >= 12 {
+		nameSize := uint64(f.ByteOrder.Uint32(data[0:4]))
+		descSize := uint64(f.ByteOrder.Uint32(data[4:8]))
+		noteType := f.ByteOrder.Uint32(data[8:12])
+		data = data[12:]
+
+		nameEnd := align4(nameSize)
+		descEnd := nameEnd + align4(descSize)
+		if uint64(len(data)) < descEnd || nameSize == 0 {
+			return nil, false
+		}
+
+		if noteType == typ && string(data[:nameSize-1]) == name {
+			return data[nameEnd : nameEnd+descSize], true
+		}
+
+		data = data[descEnd:]
+	}
+
+	return nil, false
+}
+
+func align4(n uint64) uint64 {
+	return (n + 3) &^ 3
+}
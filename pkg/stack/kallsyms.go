@@ -0,0 +1,104 @@
+package stack
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// kernelSymbol - символ ядра или модуля из /proc/kallsyms
+type kernelSymbol struct {
+	addr   uint64
+	name   string
+	module string
+}
+
+// Kallsyms - таблица символов ядра
+type Kallsyms struct {
+	syms []kernelSymbol
+}
+
+// LoadKallsyms читает символы ядра из /proc/kallsyms. Без CAP_SYSLOG
+// адреса в нём нулевые, и таблица получается пустой.
+func LoadKallsyms() (*Kallsyms, error) {
+	f, err := os.Open("/proc/kallsyms")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseKallsyms(f)
+}
+
+// ParseKallsyms разбирает таблицу символов в формате /proc/kallsyms:
+//
+//	ffffffff81234560 T vfs_read
+//	ffffffffc0a01000 t ext4_file_read_iter	[ext4]
+//
+// Используются только символы кода (типы t, T, w, W).
+func ParseKallsyms(r io.Reader) (*Kallsyms, error) {
+	k := &Kallsyms{}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		switch fields[1] {
+		case "t", "T", "w", "W":
+		default:
+			continue
+		}
+
+		addr, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kallsyms address %q: %w", fields[0], err)
+		}
+
+		if addr == 0 {
+			continue
+		}
+
+		sym := kernelSymbol{addr: addr, name: fields[2]}
+		if len(fields) > 3 {
+			sym.module = strings.Trim(fields[3], "[]")
+		}
+
+		k.syms = append(k.syms, sym)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(k.syms, func(i, j int) bool {
+		return k.syms[i].addr < k.syms[j].addr
+	})
+
+	return k, nil
+}
+
+// Symbolize находит функцию ядра для адреса
+func (k *Kallsyms) Symbolize(pc uint64) Frame {
+	frame := Frame{PC: pc, Kernel: true}
+
+	i := sort.Search(len(k.syms), func(i int) bool {
+		return k.syms[i].addr > pc
+	}) - 1
+	if i < 0 {
+		return frame
+	}
+
+	sym := k.syms[i]
+	frame.Func = sym.name
+	frame.FuncOffset = pc - sym.addr
+	frame.Path = sym.module
+
+	return frame
+}
@@ -0,0 +1,34 @@
+package stack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKallsyms(t *testing.T) {
+	k, err := ParseKallsyms(strings.NewReader(`ffffffff81000000 T _stext
+ffffffff81234560 T vfs_read
+ffffffff81234700 t rw_verify_area
+ffffffff82000000 D jiffies
+ffffffffc0a01000 t ext4_file_read_iter	[ext4]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pc   uint64
+		want string
+	}{
+		{0xffffffff8123457a, "[kernel] vfs_read+0x1a"},
+		{0xffffffff81234700, "[kernel] rw_verify_area+0x0"},
+		{0xffffffffc0a0105a, "[kernel] ext4_file_read_iter+0x5a [ext4]"},
+		{0xffffffff80000000, "[kernel] 0xffffffff80000000"},
+	}
+
+	for _, tt := range tests {
+		if got := k.Symbolize(tt.pc).String(); got != tt.want {
+			t.Errorf("Symbolize(%#x) = %q, want %q", tt.pc, got, tt.want)
+		}
+	}
+}
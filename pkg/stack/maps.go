@@ -0,0 +1,97 @@
+// Package stack восстанавливает стеки пользовательского пространства,
+// захваченные bpf программой: адреса, отображения исполняемых файлов и символы.
+package stack
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Mapping - исполняемое отображение файла в адресное пространство процесса
+// (строка /proc/PID/maps с правом x)
+type Mapping struct {
+	Start  uint64
+	Limit  uint64
+	Offset uint64
+	// Path - путь к файлу в файловой системе процесса
+	Path string
+	// File - путь, по которому файл доступен трассировщику
+	File string
+	// BuildID - идентификатор сборки файла, если известен
+	BuildID string
+
+	file fileID
+}
+
+// Contains сообщает, попадает ли адрес в отображение
+func (m *Mapping) Contains(addr uint64) bool {
+	return addr >= m.Start && addr < m.Limit
+}
+
+// ReadMaps читает исполняемые отображения файлов процесса pid
+func ReadMaps(pid uint32) ([]Mapping, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mappings []Mapping
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		m, ok, err := parseMapsLine(sc.Text())
+		if err != nil {
+			return nil, fmt.Errorf("/proc/%d/maps: %w", pid, err)
+		}
+
+		if ok {
+			mappings = append(mappings, m)
+		}
+	}
+
+	return mappings, sc.Err()
+}
+
+// parseMapsLine разбирает строку вида
+//
+//	00400000-00452000 r-xp 00000000 08:02 173521 /usr/bin/dbus-daemon
+//
+// Возвращает false для неисполняемых и анонимных отображений.
+func parseMapsLine(line string) (Mapping, bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return Mapping{}, false, fmt.Errorf("invalid line %q", line)
+	}
+
+	if len(fields) < 6 || !strings.Contains(fields[1], "x") || !strings.HasPrefix(fields[5], "/") {
+		return Mapping{}, false, nil
+	}
+
+	start, limit, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return Mapping{}, false, fmt.Errorf("invalid address range %q", fields[0])
+	}
+
+	var (
+		m   = Mapping{Path: strings.Join(fields[5:], " ")}
+		err error
+	)
+
+	if m.Start, err = strconv.ParseUint(start, 16, 64); err != nil {
+		return Mapping{}, false, fmt.Errorf("invalid address range %q: %w", fields[0], err)
+	}
+
+	if m.Limit, err = strconv.ParseUint(limit, 16, 64); err != nil {
+		return Mapping{}, false, fmt.Errorf("invalid address range %q: %w", fields[0], err)
+	}
+
+	if m.Offset, err = strconv.ParseUint(fields[2], 16, 64); err != nil {
+		return Mapping{}, false, fmt.Errorf("invalid offset %q: %w", fields[2], err)
+	}
+
+	return m, true, nil
+}
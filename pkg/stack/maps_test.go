@@ -0,0 +1,50 @@
+package stack
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseMapsLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Mapping
+		ok   bool
+	}{
+		{
+			line: "00400000-00452000 r-xp 00001000 08:02 173521      /usr/bin/dbus-daemon",
+			want: Mapping{Start: 0x400000, Limit: 0x452000, Offset: 0x1000, Path: "/usr/bin/dbus-daemon"},
+			ok:   true,
+		},
+		{line: "00651000-00652000 r--p 00051000 08:02 173521      /usr/bin/dbus-daemon"},
+		{line: "7ffd6a5f3000-7ffd6a5f5000 r-xp 00000000 00:00 0                          [vdso]"},
+		{line: "7f1c2a000000-7f1c2a021000 rw-p 00000000 00:00 0"},
+	}
+
+	for _, tt := range tests {
+		got, ok, err := parseMapsLine(tt.line)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.line, err)
+		}
+
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%q: got %+v %v, want %+v %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBuildID(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	id, err := BuildID(exe)
+	if err != nil {
+		t.Fatalf("BuildID(%s): %v", exe, err)
+	}
+
+	if id == "" {
+		t.Fatal("empty build id")
+	}
+}
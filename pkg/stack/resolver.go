@@ -0,0 +1,153 @@
+package stack
+
+import (
+	"fmt"
+	"github.com/cilium/ebpf"
+	"syscall"
+)
+
+// MaxDepth - глубина стека в карте stacks (MAX_STACK_DEPTH в strace.bpf.c)
+const MaxDepth = 127
+
+// Resolver получает стеки из bpf карты stacks и находит отображения
+// исполняемых файлов процессов, которым принадлежат адреса
+type Resolver struct {
+	stacks *ebpf.Map
+	// procs - исполняемые отображения процессов
+	procs map[uint32][]Mapping
+	// buildIDs - идентификаторы сборки по устройству и inode файла
+	buildIDs map[fileID]string
+	// symtabs - таблицы символов по идентификатору сборки
+	symtabs map[string]*symtab
+	// kallsyms - символы ядра, читаются при первом обращении
+	kallsyms *Kallsyms
+}
+
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// NewResolver создаёт Resolver для карты stacks; если карта не задана,
+// стеки недоступны, но отображения процессов находятся
+func NewResolver(stacks *ebpf.Map) *Resolver {
+	return &Resolver{
+		stacks:   stacks,
+		procs:    make(map[uint32][]Mapping),
+		buildIDs: make(map[fileID]string),
+		symtabs:  make(map[string]*symtab),
+	}
+}
+
+// Stack возвращает адреса стека id от вершины к корню
+func (r *Resolver) Stack(id int32) ([]uint64, error) {
+	if r.stacks == nil {
+		return nil, fmt.Errorf("stacks are not captured")
+	}
+
+	if id < 0 {
+		return nil, fmt.Errorf("stack was not captured: %w", syscall.Errno(-id))
+	}
+
+	var pcs [MaxDepth]uint64
+	if err := r.stacks.Lookup(uint32(id), &pcs); err != nil {
+		return nil, fmt.Errorf("error looking up stack %d: %w", id, err)
+	}
+
+	n := 0
+	for n < len(pcs) && pcs[n] != 0 {
+		n++
+	}
+
+	return pcs[:n], nil
+}
+
+// SymbolizeKernel находит функции ядра для адресов стека ядра
+func (r *Resolver) SymbolizeKernel(pcs []uint64) []Frame {
+	if r.kallsyms == nil {
+		k, err := LoadKallsyms()
+		if err != nil {
+			k = &Kallsyms{}
+		}
+
+		r.kallsyms = k
+	}
+
+	frames := make([]Frame, len(pcs))
+	for i, pc := range pcs {
+		frames[i] = r.kallsyms.Symbolize(pc)
+	}
+
+	return frames
+}
+
+// Mapping находит отображение процесса pid, которому принадлежит адрес.
+// Отображения читаются при первом обращении и перечитываются, если адрес
+// не найден (например, после dlopen).
+func (r *Resolver) Mapping(pid uint32, addr uint64) (*Mapping, bool) {
+	mappings, ok := r.procs[pid]
+	if ok {
+		if m, ok := find(mappings, addr); ok {
+			return m, true
+		}
+	}
+
+	mappings, err := r.readMaps(pid)
+	if err != nil {
+		return nil, false
+	}
+
+	r.procs[pid] = mappings
+
+	return find(mappings, addr)
+}
+
+// Forget удаляет отображения процесса pid. Вызывается, когда процесс
+// завершился или запустил новый исполняемый файл: иначе адреса нового
+// процесса с тем же pid находились бы в старых отображениях.
+func (r *Resolver) Forget(pid uint32) {
+	delete(r.procs, pid)
+}
+
+func find(mappings []Mapping, addr uint64) (*Mapping, bool) {
+	for i := range mappings {
+		if mappings[i].Contains(addr) {
+			return &mappings[i], true
+		}
+	}
+
+	return nil, false
+}
+
+func (r *Resolver) readMaps(pid uint32) ([]Mapping, error) {
+	mappings, err := ReadMaps(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range mappings {
+		m := &mappings[i]
+		// файлы процесса в другом mount namespace доступны через его корень
+		m.File = fmt.Sprintf("/proc/%d/root%s", pid, m.Path)
+		m.file, m.BuildID = r.buildID(m.File)
+	}
+
+	return mappings, nil
+}
+
+func (r *Resolver) buildID(file string) (fileID, string) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(file, &st); err != nil {
+		return fileID{}, ""
+	}
+
+	key := fileID{dev: uint64(st.Dev), ino: st.Ino}
+	if id, ok := r.buildIDs[key]; ok {
+		return key, id
+	}
+
+	id, _ := BuildID(file)
+	r.buildIDs[key] = id
+
+	return key, id
+}
@@ -0,0 +1,21 @@
+package stack
+
+import "testing"
+
+func TestResolverForget(t *testing.T) {
+	// процесса с pid 0 нет в /proc: отображения берутся только из кэша
+	const pid = 0
+
+	r := NewResolver(nil)
+	r.procs[pid] = []Mapping{{Start: 0x1000, Limit: 0x2000, Path: "/old/exe"}}
+
+	if m, ok := r.Mapping(pid, 0x1500); !ok || m.Path != "/old/exe" {
+		t.Fatalf("cached mapping: got %+v %v", m, ok)
+	}
+
+	r.Forget(pid)
+
+	if m, ok := r.Mapping(pid, 0x1500); ok {
+		t.Errorf("mapping after Forget: got %+v", m)
+	}
+}
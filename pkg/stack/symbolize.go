@@ -0,0 +1,215 @@
+package stack
+
+import (
+	"debug/elf"
+	"debug/gosym"
+	"fmt"
+	"sort"
+)
+
+// Frame - символизированный адрес стека
+type Frame struct {
+	PC uint64
+	// Kernel - адрес в ядре
+	Kernel bool
+	// Path - путь к исполняемому файлу в файловой системе процесса, пустой,
+	// если адрес не принадлежит отображению файла. Для адресов ядра - имя модуля.
+	Path string
+	// Offset - смещение адреса в файле
+	Offset uint64
+	// Func - имя функции, пустое, если символ не найден
+	Func string
+	// FuncOffset - смещение адреса от начала функции
+	FuncOffset uint64
+	// Source и Line - место в исходном коде, известно для Go программ
+	Source string
+	Line   int
+}
+
+// String форматирует кадр как strace -k:
+//
+//	/usr/lib/libc.so.6(__open64+0x5b) [0xf8c5b]
+//
+// Адреса ядра форматируются как в стеках ядра: "[kernel] ext4_file_read_iter+0x5a [ext4]".
+func (f Frame) String() string {
+	if f.Kernel {
+		str := fmt.Sprintf("[kernel] %#x", f.PC)
+		if f.Func != "" {
+			str = fmt.Sprintf("[kernel] %s+%#x", f.Func, f.FuncOffset)
+		}
+
+		if f.Path != "" {
+			str += " [" + f.Path + "]"
+		}
+
+		return str
+	}
+
+	if f.Path == "" {
+		return fmt.Sprintf("?? [%#x]", f.PC)
+	}
+
+	fn := ""
+	if f.Func != "" {
+		fn = fmt.Sprintf("%s+%#x", f.Func, f.FuncOffset)
+	}
+
+	return fmt.Sprintf("%s(%s) [%#x]", f.Path, fn, f.Offset)
+}
+
+// symbol - символ функции из таблицы символов ELF
+type symbol struct {
+	addr uint64
+	size uint64
+	name string
+}
+
+// symtab - символы исполняемого файла
+type symtab struct {
+	loads []elf.ProgHeader
+	syms  []symbol
+	// gotab - таблица pclntab Go программы, доступна даже в бинарниках без
+	// таблицы символов (собранных с -ldflags=-s)
+	gotab *gosym.Table
+}
+
+// loadSymtab читает символы ELF файла
+func loadSymtab(file string) (*symtab, error) {
+	f, err := elf.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &symtab{}
+
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD {
+			t.loads = append(t.loads, p.ProgHeader)
+		}
+	}
+
+	syms, _ := f.Symbols()
+	dynsyms, _ := f.DynamicSymbols()
+
+	for _, s := range append(syms, dynsyms...) {
+		if elf.ST_TYPE(s.Info) != elf.STT_FUNC || s.Value == 0 {
+			continue
+		}
+
+		t.syms = append(t.syms, symbol{addr: s.Value, size: s.Size, name: s.Name})
+	}
+
+	sort.Slice(t.syms, func(i, j int) bool {
+		return t.syms[i].addr < t.syms[j].addr
+	})
+
+	if pcln := f.Section(".gopclntab"); pcln != nil {
+		if text := f.Section(".text"); text != nil {
+			if data, err := pcln.Data(); err == nil {
+				t.gotab, _ = gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// vaddr переводит смещение в файле в виртуальный адрес ELF файла
+func (t *symtab) vaddr(off uint64) (uint64, bool) {
+	for _, p := range t.loads {
+		if off >= p.Off && off < p.Off+p.Filesz {
+			return off - p.Off + p.Vaddr, true
+		}
+	}
+
+	return 0, false
+}
+
+// lookup заполняет функцию и место в исходном коде по смещению в файле
+func (t *symtab) lookup(frame *Frame) {
+	addr, ok := t.vaddr(frame.Offset)
+	if !ok {
+		return
+	}
+
+	// адреса в стеке - адреса возврата, сама инструкция вызова находится перед ними
+	pc := addr - 1
+
+	if t.gotab != nil {
+		if source, line, fn := t.gotab.PCToLine(pc); fn != nil {
+			frame.Func = fn.Name
+			frame.FuncOffset = addr - fn.Entry
+			frame.Source = source
+			frame.Line = line
+
+			return
+		}
+	}
+
+	i := sort.Search(len(t.syms), func(i int) bool {
+		return t.syms[i].addr > pc
+	}) - 1
+	if i < 0 {
+		return
+	}
+
+	s := t.syms[i]
+	if s.size != 0 && pc >= s.addr+s.size {
+		return
+	}
+
+	frame.Func = s.name
+	frame.FuncOffset = addr - s.addr
+}
+
+// Symbolize находит функции для адресов стека процесса pid.
+// Таблицы символов кэшируются по идентификатору сборки файла.
+func (r *Resolver) Symbolize(pid uint32, pcs []uint64) []Frame {
+	frames := make([]Frame, len(pcs))
+
+	for i, pc := range pcs {
+		frame := &frames[i]
+		frame.PC = pc
+
+		m, ok := r.Mapping(pid, pc)
+		if !ok {
+			continue
+		}
+
+		frame.Path = m.Path
+		frame.Offset = pc - m.Start + m.Offset
+
+		if t := r.symtab(m); t != nil {
+			t.lookup(frame)
+		}
+	}
+
+	return frames
+}
+
+// symtab возвращает таблицу символов файла отображения m
+func (r *Resolver) symtab(m *Mapping) *symtab {
+	key := m.BuildID
+	if key == "" {
+		if m.file == (fileID{}) {
+			return nil
+		}
+
+		key = fmt.Sprintf("%d:%d", m.file.dev, m.file.ino)
+	}
+
+	if t, ok := r.symtabs[key]; ok {
+		return t
+	}
+
+	// ошибку не повторяем для каждого адреса: файл без символов остаётся без символов
+	t, err := loadSymtab(m.File)
+	if err != nil {
+		t = nil
+	}
+
+	r.symtabs[key] = t
+
+	return t
+}
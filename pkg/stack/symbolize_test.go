@@ -0,0 +1,31 @@
+package stack
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSymbolizeGo(t *testing.T) {
+	entry := uint64(reflect.ValueOf(loadSymtab).Pointer())
+
+	// адрес внутри функции, как адрес возврата из вызова
+	frames := NewResolver(nil).Symbolize(uint32(os.Getpid()), []uint64{entry + 8})
+	if len(frames) != 1 {
+		t.Fatalf("got %d frames", len(frames))
+	}
+
+	f := frames[0]
+	if !strings.HasSuffix(f.Func, "stack.loadSymtab") || f.FuncOffset != 8 {
+		t.Errorf("unexpected frame %+v", f)
+	}
+
+	if !strings.HasSuffix(f.Source, "symbolize.go") || f.Line == 0 {
+		t.Errorf("unexpected source %s:%d", f.Source, f.Line)
+	}
+
+	if !strings.Contains(f.String(), "stack.loadSymtab+0x8) [0x") {
+		t.Errorf("unexpected format %q", f.String())
+	}
+}
@@ -0,0 +1,253 @@
+package sysdesc
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"github.com/cilium/ebpf/btf"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed sysnum_*.tbl
+var sysnumFS embed.FS
+
+// archSyscallPrefix - префиксы обёрток системных вызовов в ядре по архитектурам
+var archSyscallPrefix = map[string]string{
+	"amd64": "__x64_sys_",
+	"arm64": "__arm64_sys_",
+}
+
+// protoPrefixes - функции ядра, прототипы которых повторяют сигнатуру системного вызова,
+// в порядке предпочтения. Обёртки __<arch>_sys_* принимают только pt_regs,
+// а __do_sys_* часто встраиваются компилятором и отсутствуют в BTF.
+var protoPrefixes = []string{"__do_sys_", "__se_sys_", "ksys_", "do_sys_"}
+
+// fdNames - имена аргументов, которые являются файловыми дескрипторами
+var fdNames = map[string]bool{
+	"fd": true, "dfd": true, "olddfd": true, "newdfd": true, "epfd": true,
+	"fd_in": true, "fd_out": true, "oldfd": true, "newfd": true, "pidfd": true,
+}
+
+// ptrRets - системные вызовы, возвращающие адрес в памяти процесса
+var ptrRets = map[string]bool{
+	"brk": true, "mmap": true, "mremap": true, "shmat": true,
+}
+
+// Numbers возвращает номера системных вызовов архитектуры arch: номер -> имя.
+// Номера берутся из встроенных таблиц sysnum_<arch>.tbl: BTF ядра не содержит
+// соответствия номеров и имён, а номера - часть ABI и не меняются между версиями.
+func Numbers(arch string) (map[uint32]string, error) {
+	data, err := sysnumFS.ReadFile("sysnum_" + arch + ".tbl")
+	if err != nil {
+		return nil, fmt.Errorf("unsupported arch %s: %w", arch, err)
+	}
+
+	numbers := make(map[uint32]string)
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("sysnum_%s.tbl:%d: invalid line %q", arch, line, text)
+		}
+
+		nr, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("sysnum_%s.tbl:%d: invalid number: %w", arch, line, err)
+		}
+
+		numbers[uint32(nr)] = fields[1]
+	}
+
+	return numbers, sc.Err()
+}
+
+// FromNumbers строит описания всех известных системных вызовов архитектуры
+// arch без сигнатур. Используется, когда BTF ядра недоступен, например при
+// разборе записи трассировки на другой машине.
+func FromNumbers(arch string) ([]Syscall, error) {
+	numbers, err := Numbers(arch)
+	if err != nil {
+		return nil, err
+	}
+
+	syscalls := make([]Syscall, 0, len(numbers))
+	for nr, name := range numbers {
+		syscalls = append(syscalls, Syscall{Name: name, Nr: map[string]uint32{arch: nr}, Untyped: true, RetPtr: ptrRets[name]})
+	}
+
+	sort.Slice(syscalls, func(i, j int) bool {
+		return syscalls[i].Nr[arch] < syscalls[j].Nr[arch]
+	})
+
+	return syscalls, nil
+}
+
+// FromBTF строит описания системных вызовов, реализованных ядром, по его BTF.
+// Из BTF берутся набор системных вызовов и их сигнатуры, номера - из Numbers.
+// Системные вызовы, обёртки которых отсутствуют в ядре, пропускаются.
+// Если прототип системного вызова не найден, описание помечается как Untyped.
+func FromBTF(spec *btf.Spec, arch string) ([]Syscall, error) {
+	prefix, ok := archSyscallPrefix[arch]
+	if !ok {
+		return nil, fmt.Errorf("unsupported arch %s", arch)
+	}
+
+	numbers, err := Numbers(arch)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := make(map[string]*btf.Func)
+	for typ := range spec.All() {
+		if fn, ok := typ.(*btf.Func); ok {
+			funcs[fn.Name] = fn
+		}
+	}
+
+	nrs := make([]uint32, 0, len(numbers))
+	for nr := range numbers {
+		nrs = append(nrs, nr)
+	}
+
+	sort.Slice(nrs, func(i, j int) bool { return nrs[i] < nrs[j] })
+
+	var syscalls []Syscall
+
+	for _, nr := range nrs {
+		name := numbers[nr]
+
+		kname, ok := kernelName(funcs, prefix, name)
+		if !ok {
+			continue
+		}
+
+		sc := Syscall{
+			Name:    name,
+			Nr:      map[string]uint32{arch: nr},
+			Untyped: true,
+			RetPtr:  ptrRets[name],
+		}
+
+		for _, p := range protoPrefixes {
+			fn, ok := funcs[p+kname]
+			if !ok {
+				continue
+			}
+
+			proto, ok := fn.Type.(*btf.FuncProto)
+			if !ok || len(proto.Params) > MaxArgs {
+				continue
+			}
+
+			sc.Args = make([]Arg, 0, len(proto.Params))
+			for _, param := range proto.Params {
+				sc.Args = append(sc.Args, Arg{Name: param.Name, Kind: btfArgKind(param)})
+			}
+
+			sc.Untyped = false
+
+			break
+		}
+
+		syscalls = append(syscalls, sc)
+	}
+
+	return syscalls, nil
+}
+
+// kernelName ищет имя системного вызова в ядре: часть вызовов реализована
+// под именами с префиксом new (newfstat, newuname и т.п.)
+func kernelName(funcs map[string]*btf.Func, prefix, name string) (string, bool) {
+	for _, kname := range []string{name, "new" + name} {
+		if _, ok := funcs[prefix+kname]; ok {
+			return kname, true
+		}
+	}
+
+	return "", false
+}
+
+func btfArgKind(param btf.FuncParam) ArgKind {
+	if td, ok := param.Type.(*btf.Typedef); ok && td.Name == "umode_t" {
+		return KindMode
+	}
+
+	switch typ := btf.UnderlyingType(param.Type).(type) {
+	case *btf.Pointer:
+		return KindPtr
+	case *btf.Int:
+		if fdNames[param.Name] {
+			return KindFd
+		}
+
+		if typ.Encoding == btf.Signed {
+			return KindInt
+		}
+
+		return KindUint
+	case *btf.Enum:
+		return KindInt
+	default:
+		return KindUint
+	}
+}
+
+// LoadKernel дополняет таблицу base описаниями системных вызовов из BTF
+// работающего ядра (/sys/kernel/btf/vmlinux)
+func LoadKernel(base *Table, arch string) (*Table, error) {
+	spec, err := btf.LoadKernelSpec()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kernel btf: %w", err)
+	}
+
+	syscalls, err := FromBTF(spec, arch)
+	if err != nil {
+		return nil, err
+	}
+
+	return base.Merge(syscalls)
+}
+
+// Merge возвращает новую таблицу, дополненную описаниями other.
+// Описания, номера которых уже есть в таблице, пропускаются.
+func (t *Table) Merge(other []Syscall) (*Table, error) {
+	merged := append([]Syscall(nil), t.syscalls...)
+
+	for _, sc := range other {
+		if _, ok := t.byName[sc.Name]; ok {
+			continue
+		}
+
+		if t.hasNr(sc) {
+			continue
+		}
+
+		merged = append(merged, sc)
+	}
+
+	table, err := NewTable(merged)
+	if err != nil {
+		return nil, fmt.Errorf("error merging syscall tables: %w", err)
+	}
+
+	return table, nil
+}
+
+func (t *Table) hasNr(sc Syscall) bool {
+	for arch, nr := range sc.Nr {
+		if _, ok := t.byNr[arch][nr]; ok {
+			return true
+		}
+	}
+
+	return false
+}
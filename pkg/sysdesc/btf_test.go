@@ -0,0 +1,52 @@
+package sysdesc
+
+import (
+	"github.com/cilium/ebpf/btf"
+	"reflect"
+	"testing"
+)
+
+func TestFromBTF(t *testing.T) {
+	spec, err := btf.LoadSpec("../../bpf_test/kernel/arm64/linux-5.10.0-32-arm64.btf")
+	if err != nil {
+		t.Fatalf("error loading btf: %v", err)
+	}
+
+	syscalls, err := FromBTF(spec, "arm64")
+	if err != nil {
+		t.Fatalf("FromBTF failed: %v", err)
+	}
+
+	table, err := Default.Merge(syscalls)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	// read описан в syscalls.sc, описание из BTF не должно его заменить
+	if sc, _ := table.ByNr("arm64", 63); sc.Name != "read" || sc.Untyped || sc.Args[1].Kind != KindBuf {
+		t.Errorf("Unexpected read syscall: %+v", sc)
+	}
+
+	dup3, ok := table.ByNr("arm64", 24)
+	if !ok {
+		t.Fatal("dup3 is not found")
+	}
+
+	expected := []Arg{
+		{Name: "oldfd", Kind: KindFd},
+		{Name: "newfd", Kind: KindFd},
+		{Name: "flags", Kind: KindInt},
+	}
+
+	if dup3.Name != "dup3" || dup3.Untyped || !reflect.DeepEqual(dup3.Args, expected) {
+		t.Errorf("Unexpected dup3 syscall: %+v", dup3)
+	}
+
+	if fstat, ok := table.ByNr("arm64", 80); !ok || fstat.Name != "fstat" {
+		t.Errorf("fstat must be found by kernel name newfstat: %+v", fstat)
+	}
+
+	if mmap, ok := table.ByNr("arm64", 222); !ok || mmap.Name != "mmap" || !mmap.RetPtr {
+		t.Errorf("mmap must return a pointer: %+v", mmap)
+	}
+}
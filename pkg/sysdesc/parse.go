@@ -0,0 +1,461 @@
+package sysdesc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Parse разбирает описания системных вызовов на языке описаний.
+//
+// Каждое описание имеет вид:
+//
+//	syscall имя [арх=номер ... ret=fd|ptr] (аргумент тип, ...)
+//
+// где ret=fd отмечает системные вызовы, возвращающие новый файловый дескриптор,
+// ret=ptr - возвращающие адрес, а тип аргумента - одно из:
+//
+//	int, uint, mode, ptr, path
+//	fd[close, ns]           - файловый дескриптор; close - дескриптор освобождается,
+//	                        ns - дескриптор пространства имён, тип которого определяет парсер
+//	flags:набор             - битовые флаги из именованного набора
+//	struct:имя[size=N]      - указатель на C-структуру размером N байт
+//	buf[len=argN|ret, size=N] - буфер с длиной из аргумента N или возвращаемого значения
+//	strv[count=N, str=N, size=N, env] - массив строк: не больше count строк длиной до str
+//	                        байт в size байтах; env - строки захватываются, только если
+//	                        включён захват окружения, иначе только подсчитываются
+//
+// Текст от '#' до конца строки считается комментарием.
+func Parse(r io.Reader) ([]Syscall, error) {
+	toks, err := tokenize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+
+	var syscalls []Syscall
+
+	for !p.eof() {
+		sc, err := p.syscall()
+		if err != nil {
+			return nil, err
+		}
+
+		syscalls = append(syscalls, sc)
+	}
+
+	return syscalls, nil
+}
+
+// ParseTable разбирает описания и строит по ним таблицу
+func ParseTable(r io.Reader) (*Table, error) {
+	syscalls, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTable(syscalls)
+}
+
+type token struct {
+	text string
+	line int
+}
+
+func tokenize(r io.Reader) ([]token, error) {
+	var toks []token
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+
+		for i := 0; i < len(text); {
+			c := rune(text[i])
+
+			switch {
+			case unicode.IsSpace(c):
+				i++
+			case strings.ContainsRune("[](),=:", c):
+				toks = append(toks, token{text: string(c), line: line})
+				i++
+			case isWordChar(c):
+				j := i
+				for j < len(text) && isWordChar(rune(text[j])) {
+					j++
+				}
+
+				toks = append(toks, token{text: text[i:j], line: line})
+				i = j
+			default:
+				return nil, fmt.Errorf("line %d: unexpected character %q", line, c)
+			}
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("error reading description: %w", err)
+	}
+
+	return toks, nil
+}
+
+func isWordChar(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.toks)
+}
+
+func (p *parser) peek() string {
+	if p.eof() {
+		return ""
+	}
+
+	return p.toks[p.pos].text
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	line := 0
+	if len(p.toks) > 0 {
+		line = p.toks[min(p.pos, len(p.toks)-1)].line
+	}
+
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) next() (string, error) {
+	if p.eof() {
+		return "", p.errorf("unexpected end of description")
+	}
+
+	tok := p.toks[p.pos].text
+	p.pos++
+
+	return tok, nil
+}
+
+func (p *parser) expect(want string) error {
+	tok, err := p.next()
+	if err != nil {
+		return err
+	}
+
+	if tok != want {
+		p.pos--
+
+		return p.errorf("expected %q, got %q", want, tok)
+	}
+
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	tok, err := p.next()
+	if err != nil {
+		return "", err
+	}
+
+	if !isWordChar(rune(tok[0])) {
+		p.pos--
+
+		return "", p.errorf("expected identifier, got %q", tok)
+	}
+
+	return tok, nil
+}
+
+func (p *parser) number() (int, error) {
+	tok, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.Atoi(tok)
+	if err != nil || n < 0 {
+		p.pos--
+
+		return 0, p.errorf("expected number, got %q", tok)
+	}
+
+	return n, nil
+}
+
+func (p *parser) syscall() (Syscall, error) {
+	var sc Syscall
+
+	if err := p.expect("syscall"); err != nil {
+		return sc, err
+	}
+
+	name, err := p.ident()
+	if err != nil {
+		return sc, err
+	}
+
+	sc.Name = name
+	sc.Nr = make(map[string]uint32)
+
+	if err := p.expect("["); err != nil {
+		return sc, err
+	}
+
+	for p.peek() != "]" {
+		arch, err := p.ident()
+		if err != nil {
+			return sc, err
+		}
+
+		if arch == "ret" {
+			if err := p.ret(&sc); err != nil {
+				return sc, err
+			}
+
+			continue
+		}
+
+		if _, ok := archMacros[arch]; !ok {
+			return sc, p.errorf("syscall %s: unknown arch %q", name, arch)
+		}
+
+		if err := p.expect("="); err != nil {
+			return sc, err
+		}
+
+		nr, err := p.number()
+		if err != nil {
+			return sc, err
+		}
+
+		sc.Nr[arch] = uint32(nr)
+	}
+
+	p.pos++
+
+	if err := p.expect("("); err != nil {
+		return sc, err
+	}
+
+	for p.peek() != ")" {
+		if len(sc.Args) > 0 {
+			if err := p.expect(","); err != nil {
+				return sc, err
+			}
+		}
+
+		arg, err := p.arg()
+		if err != nil {
+			return sc, fmt.Errorf("syscall %s: %w", name, err)
+		}
+
+		sc.Args = append(sc.Args, arg)
+	}
+
+	p.pos++
+
+	return sc, nil
+}
+
+// ret разбирает тип возвращаемого значения: ret=fd или ret=ptr
+func (p *parser) ret(sc *Syscall) error {
+	if err := p.expect("="); err != nil {
+		return err
+	}
+
+	kind, err := p.ident()
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case "fd":
+		sc.RetFd = true
+	case "ptr":
+		sc.RetPtr = true
+	default:
+		return p.errorf("syscall %s: unsupported return type %q", sc.Name, kind)
+	}
+
+	return nil
+}
+
+func (p *parser) arg() (Arg, error) {
+	var arg Arg
+
+	name, err := p.ident()
+	if err != nil {
+		return arg, err
+	}
+
+	kindName, err := p.ident()
+	if err != nil {
+		return arg, err
+	}
+
+	kind, ok := kindByName(kindName)
+	if !ok {
+		return arg, p.errorf("arg %s: unknown type %q", name, kindName)
+	}
+
+	arg.Name, arg.Kind = name, kind
+	if kind == KindBuf {
+		arg.LenArg = -1
+	}
+
+	if p.peek() == ":" {
+		p.pos++
+
+		param, err := p.ident()
+		if err != nil {
+			return arg, err
+		}
+
+		switch kind {
+		case KindFlags:
+			arg.Set = param
+		case KindStruct:
+			arg.Struct = param
+		default:
+			return arg, p.errorf("arg %s: type %s has no parameter", name, kind)
+		}
+	}
+
+	if p.peek() == "[" {
+		p.pos++
+
+		if err := p.options(&arg); err != nil {
+			return arg, err
+		}
+	}
+
+	switch {
+	case kind == KindFlags && arg.Set == "":
+		return arg, p.errorf("arg %s: flags set is required", name)
+	case kind == KindStruct && (arg.Struct == "" || arg.Size == 0):
+		return arg, p.errorf("arg %s: struct name and size are required", name)
+	case kind == KindBuf && arg.LenArg < 0:
+		return arg, p.errorf("arg %s: buffer length is required", name)
+	}
+
+	return arg, nil
+}
+
+func (p *parser) options(arg *Arg) error {
+	for p.peek() != "]" {
+		if p.peek() == "," {
+			p.pos++
+		}
+
+		opt, err := p.ident()
+		if err != nil {
+			return err
+		}
+
+		if opt == "close" {
+			if arg.Kind != KindFd {
+				return p.errorf("arg %s: close is allowed only for fd", arg.Name)
+			}
+
+			arg.Close = true
+
+			continue
+		}
+
+		if opt == "ns" {
+			if arg.Kind != KindFd {
+				return p.errorf("arg %s: ns is allowed only for fd", arg.Name)
+			}
+
+			arg.Ns = true
+
+			continue
+		}
+
+		if opt == "env" {
+			if arg.Kind != KindStrv {
+				return p.errorf("arg %s: env is allowed only for strv", arg.Name)
+			}
+
+			arg.Env = true
+
+			continue
+		}
+
+		if err := p.expect("="); err != nil {
+			return err
+		}
+
+		switch opt {
+		case "size":
+			if arg.Size, err = p.number(); err != nil {
+				return err
+			}
+		case "count", "str":
+			if arg.Kind != KindStrv {
+				return p.errorf("arg %s: %s is allowed only for strv", arg.Name, opt)
+			}
+
+			n, err := p.number()
+			if err != nil {
+				return err
+			}
+
+			if opt == "count" {
+				arg.Count = n
+			} else {
+				arg.StrSize = n
+			}
+		case "len":
+			if arg.Kind != KindBuf {
+				return p.errorf("arg %s: len is allowed only for buf", arg.Name)
+			}
+
+			val, err := p.ident()
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case val == "ret":
+				arg.LenArg = 0
+			case strings.HasPrefix(val, "arg"):
+				n, err := strconv.Atoi(val[3:])
+				if err != nil || n < 1 || n > MaxArgs {
+					return p.errorf("arg %s: invalid length arg %q", arg.Name, val)
+				}
+
+				arg.LenArg = n
+			default:
+				return p.errorf("arg %s: invalid length %q", arg.Name, val)
+			}
+		default:
+			return p.errorf("arg %s: unknown option %q", arg.Name, opt)
+		}
+	}
+
+	p.pos++
+
+	return nil
+}
+
+func kindByName(name string) (ArgKind, bool) {
+	for kind, n := range kindNames {
+		if n == name {
+			return kind, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,99 @@
+package sysdesc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTable(t *testing.T) {
+	const desc = `
+# комментарий
+syscall read [amd64=0 arm64=63] (fd fd, buf buf[len=ret, size=128], count uint)
+syscall close [amd64=3] (fd fd[close])
+syscall openat [amd64=257 ret=fd] (dirfd fd, path path, flags flags:open_flags, mode mode)
+syscall bpf [amd64=321] (cmd int, attr struct:bpf_attr[size=120], size uint)
+syscall execve [amd64=59] (filename path, argv strv[size=512, count=8], envp strv[size=128, str=64, env])
+`
+
+	table, err := ParseTable(strings.NewReader(desc))
+	if err != nil {
+		t.Fatalf("ParseTable failed: %v", err)
+	}
+
+	read, ok := table.ByNr("arm64", 63)
+	if !ok {
+		t.Fatal("read is not found by arm64 number")
+	}
+
+	expected := Syscall{
+		Name: "read",
+		Nr:   map[string]uint32{"amd64": 0, "arm64": 63},
+		Args: []Arg{
+			{Name: "fd", Kind: KindFd},
+			{Name: "buf", Kind: KindBuf, Size: 128},
+			{Name: "count", Kind: KindUint},
+		},
+	}
+
+	if !reflect.DeepEqual(*read, expected) {
+		t.Errorf("Unexpected syscall:\n  got:  %+v\n  want: %+v", *read, expected)
+	}
+
+	openat, _ := table.ByName("openat")
+	if arg := openat.Args[2]; arg.Kind != KindFlags || arg.Set != "open_flags" {
+		t.Errorf("Unexpected flags arg: %+v", arg)
+	}
+
+	if !openat.RetFd {
+		t.Error("openat must return fd")
+	}
+
+	if closeSc, _ := table.ByName("close"); !closeSc.Args[0].Close {
+		t.Error("close must release its fd argument")
+	}
+
+	execve, _ := table.ByName("execve")
+
+	expectedStrv := []Arg{
+		{Name: "argv", Kind: KindStrv, Size: 512, Offset: 256, Count: 8, StrSize: StrvStrSize},
+		{Name: "envp", Kind: KindStrv, Size: 128, Offset: 768, Count: StrvCount, StrSize: 64, Env: true},
+	}
+
+	if !reflect.DeepEqual(execve.Args[1:], expectedStrv) {
+		t.Errorf("Unexpected strv args:\n  got:  %+v\n  want: %+v", execve.Args[1:], expectedStrv)
+	}
+
+	if _, ok := table.ByNr("arm64", 257); ok {
+		t.Error("openat must not be found by amd64 number on arm64")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		desc string
+		err  string
+	}{
+		{"unknown type", "syscall x [amd64=1] (a string)", `line 1: arg a: unknown type "string"`},
+		{"unknown arch", "syscall x [mips=1] ()", `line 1: syscall x: unknown arch "mips"`},
+		{"buf without length", "syscall x [amd64=1] (b buf)", "line 1: arg b: buffer length is required"},
+		{"close not fd", "syscall x [amd64=1] (a int[close])", "line 1: arg a: close is allowed only for fd"},
+		{"ns not fd", "syscall x [amd64=1] (a int[ns])", "line 1: arg a: ns is allowed only for fd"},
+		{"env not strv", "syscall x [amd64=1] (a path[env])", "line 1: arg a: env is allowed only for strv"},
+		{"strv too many strings", "syscall x [amd64=1] (a strv[count=64])", "arg a: string count 64 exceeds 32"},
+		{"unknown ret", "syscall x [amd64=1 ret=path] ()", `line 1: syscall x: unsupported return type "path"`},
+		{"flags without set", "syscall x [amd64=1] (f flags)", "line 1: arg f: flags set is required"},
+		{"duplicate number", "syscall x [amd64=1] ()\nsyscall y [amd64=1] ()", "syscalls x and y have the same number 1 on amd64"},
+		{"unterminated", "syscall x [amd64=1] (fd fd", "unexpected end of description"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTable(strings.NewReader(tt.desc))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Unexpected error:\n  got:  %v\n  want: %s", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+# Описания системных вызовов, для которых генерируются bpf парсеры и декодеры событий.
+# После изменения файла нужно выполнить `task generate` и пересобрать bpf программы.
+
+syscall read [amd64=0 arm64=63] (fd fd, buf buf[len=ret], count uint)
+syscall write [amd64=1 arm64=64] (fd fd, buf buf[len=arg3], count uint)
+syscall close [amd64=3 arm64=57] (fd fd[close])
+syscall openat [amd64=257 arm64=56 ret=fd] (dirfd fd, path path, flags flags:open_flags, mode mode)
+syscall bpf [amd64=321 arm64=280] (cmd int, attr struct:bpf_attr[size=120], size uint)
+syscall execve [amd64=59 arm64=221] (filename path, argv strv[size=512], envp strv[size=256, env])
+syscall execveat [amd64=322 arm64=281] (dirfd fd, filename path, argv strv[size=512], envp strv[size=256, env], flags flags:at_flags)
+
+# Порядок аргументов clone после parent_tid зависит от архитектуры (child_tid и tls
+# на amd64 и tls и child_tid на arm64), поэтому они не описываются. Младший байт
+# flags - сигнал, отправляемый родителю при завершении потомка.
+syscall clone [amd64=56 arm64=220] (flags flags:clone_flags, stack ptr, parent_tid ptr)
+# Кроме struct clone_args (88 байт) захватывается массив set_tid (до 32 pid_t)
+syscall clone3 [amd64=435 arm64=435] (cl_args struct:clone_args[size=216], size uint)
+syscall unshare [amd64=272 arm64=97] (flags flags:unshare_flags)
+syscall setns [amd64=308 arm64=268] (fd fd[ns], nstype flags:ns_types)
@@ -0,0 +1,283 @@
+package sysdesc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+)
+
+// ArgKind - тип аргумента системного вызова
+type ArgKind int
+
+const (
+	KindInt    ArgKind = iota // знаковое целое
+	KindUint                  // беззнаковое целое
+	KindFd                    // файловый дескриптор
+	KindPath                  // путь, захваченный парсером из памяти процесса
+	KindFlags                 // битовые флаги
+	KindMode                  // права доступа к файлу
+	KindPtr                   // указатель без разбора содержимого
+	KindStruct                // указатель на структуру, захваченную парсером
+	KindBuf                   // буфер с длиной из аргумента или возвращаемого значения
+	KindStrv                  // массив строк, завершённый NULL (argv, envp)
+)
+
+var kindNames = map[ArgKind]string{
+	KindInt:    "int",
+	KindUint:   "uint",
+	KindFd:     "fd",
+	KindPath:   "path",
+	KindFlags:  "flags",
+	KindMode:   "mode",
+	KindPtr:    "ptr",
+	KindStruct: "struct",
+	KindBuf:    "buf",
+	KindStrv:   "strv",
+}
+
+func (k ArgKind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ArgKind(%d)", int(k))
+}
+
+// Captured сообщает, копирует ли парсер данные аргументов этого типа в область данных записи
+func (k ArgKind) Captured() bool {
+	return k == KindPath || k == KindStruct || k == KindBuf || k == KindStrv
+}
+
+// Arg - описание аргумента системного вызова
+type Arg struct {
+	Name string
+	Kind ArgKind
+	// Set - имя набора флагов для KindFlags
+	Set string
+	// Struct - имя C-структуры для KindStruct
+	Struct string
+	// Size - размер захватываемых данных
+	Size int
+	// LenArg - номер аргумента (с 1), содержащего длину буфера KindBuf; 0 - длина из возвращаемого значения
+	LenArg int
+	// Offset - смещение захваченных данных в области данных записи
+	Offset int
+	// Close - системный вызов освобождает файловый дескриптор KindFd
+	Close bool
+	// Ns - дескриптор KindFd ссылается на пространство имён: парсер определяет
+	// его тип и inode по файлу дескриптора
+	Ns bool
+	// Count - максимальное число захватываемых строк KindStrv
+	Count int
+	// StrSize - максимальная длина каждой строки KindStrv, включая завершающий ноль
+	StrSize int
+	// Env - строки KindStrv захватываются, только если включён захват окружения
+	// процессов; иначе они только подсчитываются
+	Env bool
+}
+
+// Captured сообщает, копирует ли парсер данные аргумента в область данных записи:
+// кроме захватываемых типов, это дескрипторы пространств имён
+func (a Arg) Captured() bool {
+	return a.Kind.Captured() || a.Ns
+}
+
+// Out сообщает, заполняется ли аргумент системным вызовом, т.е. известно ли
+// его значение только на выходе из системного вызова
+func (a Arg) Out() bool {
+	return a.Kind == KindBuf && a.LenArg == 0
+}
+
+// Syscall - описание системного вызова
+type Syscall struct {
+	Name string
+	// Nr - номера системного вызова по архитектурам (в терминах GOARCH)
+	Nr   map[string]uint32
+	Args []Arg
+	// Untyped - сигнатура системного вызова неизвестна, аргументы выводятся без разбора
+	Untyped bool
+	// RetFd - системный вызов возвращает новый файловый дескриптор
+	RetFd bool
+	// RetPtr - системный вызов возвращает адрес (mmap, brk), который выводится в шестнадцатеричном виде
+	RetPtr bool
+}
+
+// Table - таблица описаний системных вызовов
+type Table struct {
+	syscalls []Syscall
+	byName   map[string]*Syscall
+	byNr     map[string]map[uint32]*Syscall
+}
+
+// NewTable строит таблицу и вычисляет смещения захватываемых данных
+func NewTable(syscalls []Syscall) (*Table, error) {
+	t := &Table{
+		syscalls: syscalls,
+		byName:   make(map[string]*Syscall, len(syscalls)),
+		byNr:     make(map[string]map[uint32]*Syscall),
+	}
+
+	for i := range t.syscalls {
+		sc := &t.syscalls[i]
+
+		if _, ok := t.byName[sc.Name]; ok {
+			return nil, fmt.Errorf("duplicate syscall %s", sc.Name)
+		}
+
+		if len(sc.Args) > MaxArgs {
+			return nil, fmt.Errorf("syscall %s: too many arguments %d", sc.Name, len(sc.Args))
+		}
+
+		if err := layout(sc); err != nil {
+			return nil, fmt.Errorf("syscall %s: %w", sc.Name, err)
+		}
+
+		t.byName[sc.Name] = sc
+
+		for arch, nr := range sc.Nr {
+			if t.byNr[arch] == nil {
+				t.byNr[arch] = make(map[uint32]*Syscall)
+			}
+
+			if other, ok := t.byNr[arch][nr]; ok {
+				return nil, fmt.Errorf("syscalls %s and %s have the same number %d on %s", other.Name, sc.Name, nr, arch)
+			}
+
+			t.byNr[arch][nr] = sc
+		}
+	}
+
+	return t, nil
+}
+
+// layout раскладывает захватываемые аргументы последовательно в области данных записи
+func layout(sc *Syscall) error {
+	off := 0
+
+	for i := range sc.Args {
+		arg := &sc.Args[i]
+		if !arg.Captured() {
+			continue
+		}
+
+		if arg.Ns {
+			arg.Size = NsFdSize
+		}
+
+		if arg.Size == 0 {
+			arg.Size = StrSize
+		}
+
+		if arg.Kind == KindBuf {
+			if arg.LenArg < 0 || arg.LenArg > len(sc.Args) {
+				return fmt.Errorf("arg %s: length arg %d out of range", arg.Name, arg.LenArg)
+			}
+
+			if arg.Size > StrSize {
+				return fmt.Errorf("arg %s: buffer size %d exceeds %d", arg.Name, arg.Size, StrSize)
+			}
+		}
+
+		if arg.Kind == KindStrv {
+			if err := strvLayout(arg); err != nil {
+				return err
+			}
+		}
+
+		arg.Offset = off
+		off += arg.Size
+	}
+
+	if off > DataSize {
+		return fmt.Errorf("captured data size %d exceeds %d", off, DataSize)
+	}
+
+	return nil
+}
+
+// strvLayout задаёт ограничения массива строк по умолчанию и проверяет их
+func strvLayout(arg *Arg) error {
+	if arg.Count == 0 {
+		arg.Count = StrvCount
+	}
+
+	if arg.StrSize == 0 {
+		arg.StrSize = StrvStrSize
+	}
+
+	switch {
+	case arg.Count > MaxStrvCount:
+		return fmt.Errorf("arg %s: string count %d exceeds %d", arg.Name, arg.Count, MaxStrvCount)
+	case arg.StrSize > StrSize:
+		return fmt.Errorf("arg %s: string size %d exceeds %d", arg.Name, arg.StrSize, StrSize)
+	case arg.Size < StrvHeaderSize+arg.StrSize:
+		return fmt.Errorf("arg %s: size %d is less than header and one string %d", arg.Name, arg.Size, StrvHeaderSize+arg.StrSize)
+	}
+
+	return nil
+}
+
+// Syscalls возвращает все описания в порядке объявления
+func (t *Table) Syscalls() []Syscall {
+	return t.syscalls
+}
+
+// ByName ищет описание системного вызова по имени
+func (t *Table) ByName(name string) (*Syscall, bool) {
+	sc, ok := t.byName[name]
+
+	return sc, ok
+}
+
+// ByNr ищет описание системного вызова по номеру для заданной архитектуры
+func (t *Table) ByNr(arch string, nr uint32) (*Syscall, bool) {
+	sc, ok := t.byNr[arch][nr]
+
+	return sc, ok
+}
+
+// Hash возвращает хеш описаний системных вызовов с известной сигнатурой и
+// встроенных таблиц номеров. Раскладка захваченных данных в записях событий
+// определяется описаниями, а имена остальных системных вызовов при разборе
+// записи - таблицами номеров, поэтому по совпадению хешей можно судить о
+// совместимости записи трассировки с декодером.
+func (t *Table) Hash() string {
+	h := sha256.New()
+
+	for _, sc := range t.syscalls {
+		if sc.Untyped {
+			continue
+		}
+
+		arches := make([]string, 0, len(sc.Nr))
+		for arch := range sc.Nr {
+			arches = append(arches, arch)
+		}
+
+		sort.Strings(arches)
+
+		fmt.Fprintf(h, "%s", sc.Name)
+
+		for _, arch := range arches {
+			fmt.Fprintf(h, " %s=%d", arch, sc.Nr[arch])
+		}
+
+		for _, arg := range sc.Args {
+			fmt.Fprintf(h, " (%s %s %s %s %d %d %d %d %d %t)", arg.Name, arg.Kind, arg.Set, arg.Struct, arg.Size, arg.LenArg, arg.Offset, arg.Count, arg.StrSize, arg.Ns)
+		}
+
+		fmt.Fprintln(h)
+	}
+
+	for _, arch := range slices.Sorted(maps.Keys(archMacros)) {
+		// таблица встроена в программу, ошибка чтения невозможна
+		data, _ := sysnumFS.ReadFile("sysnum_" + arch + ".tbl")
+		fmt.Fprintf(h, "sysnum %s %d\n", arch, len(data))
+		h.Write(data)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
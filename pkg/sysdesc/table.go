@@ -0,0 +1,54 @@
+package sysdesc
+
+import (
+	"bytes"
+	_ "embed"
+)
+
+const (
+	// MaxArgs - максимальное число аргументов системного вызова
+	MaxArgs = 6
+	// DataSize - размер области данных записи (SC_DATA_SIZE в common.h)
+	DataSize = 1024
+	// StrSize - максимальная длина захватываемой строки (SC_STR_SIZE в common.h)
+	StrSize = 256
+	// StrvHeaderSize - размер заголовка захваченного массива строк (struct strv_header в common.h)
+	StrvHeaderSize = 16
+	// MaxStrvCount - максимальное число захватываемых строк массива: обрезанные
+	// строки отмечаются битами 32-битной маски
+	MaxStrvCount = 32
+	// StrvCount и StrvStrSize - число строк и длина строки массива по умолчанию
+	StrvCount   = 16
+	StrvStrSize = 128
+	// NsFdSize - размер сведений о пространстве имён дескриптора (struct ns_fd в common.h)
+	NsFdSize = 8
+)
+
+// archMacros - соответствие архитектур GOARCH макросам __TARGET_ARCH_* в bpf программах
+var archMacros = map[string]string{
+	"amd64": "x86",
+	"arm64": "arm64",
+}
+
+// ArchMacro возвращает суффикс макроса __TARGET_ARCH_* для архитектуры GOARCH
+func ArchMacro(arch string) (string, bool) {
+	m, ok := archMacros[arch]
+
+	return m, ok
+}
+
+//go:embed syscalls.sc
+var defaultDesc []byte
+
+// Default - описания системных вызовов из syscalls.sc, по которым сгенерированы
+// парсеры kprog/src/parser и типизированные события pkg/event
+var Default = mustTable(defaultDesc)
+
+func mustTable(desc []byte) *Table {
+	t, err := ParseTable(bytes.NewReader(desc))
+	if err != nil {
+		panic("sysdesc: invalid syscalls.sc: " + err.Error())
+	}
+
+	return t
+}